@@ -0,0 +1,106 @@
+package prehit
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	rtmetrics "runtime/metrics"
+	"time"
+)
+
+const (
+	autosizeHigh = 0.90 // shrink the cache when memory usage is above this part of the limit
+	autosizeLow  = 0.75 // grow the cache when memory usage is below this part of the limit
+	autosizeStep = 0.10 // part of the [min, max] range changed by one adjustment
+)
+
+// autosize is a configuration of memory-pressure-aware sizing.
+type autosize struct {
+	min      uint
+	max      uint
+	interval time.Duration
+	usage    func() (used uint64, limit uint64)
+}
+
+// memoryusage returns the memory used by the Go runtime and the soft memory limit.
+// The limit is zero when GOMEMLIMIT is not set.
+func memoryusage() (uint64, uint64) {
+	limit := debug.SetMemoryLimit(-1)
+	if limit <= 0 || limit == math.MaxInt64 {
+		return 0, 0
+	}
+
+	samples := []rtmetrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	rtmetrics.Read(samples)
+
+	for _, sample := range samples {
+		if sample.Value.Kind() != rtmetrics.KindUint64 {
+			return 0, 0
+		}
+	}
+
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64(), uint64(limit)
+}
+
+func (c *Cache[K, V]) autosize(a *autosize) {
+	if a.interval <= 0 {
+		c.logger.Warning("Auto size interval must be positive - auto size is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.adjust(a)
+		}
+	}
+}
+
+// adjust changes the effective max size according to memory usage.
+// Usage between the low and high watermarks keeps the size unchanged (hysteresis).
+func (c *Cache[K, V]) adjust(a *autosize) {
+	used, limit := a.usage()
+	if limit == 0 { // no memory limit
+		return
+	}
+
+	ratio := float64(used) / float64(limit)
+	step := uint(float64(a.max-a.min) * autosizeStep)
+	if step == 0 {
+		step = 1
+	}
+
+	c.mutex.Lock()
+	size := c.maxsize
+	switch {
+	case ratio > autosizeHigh && size > a.min:
+		if size-a.min > step {
+			size -= step
+		} else {
+			size = a.min
+		}
+	case ratio < autosizeLow && size < a.max:
+		if a.max-size > step {
+			size += step
+		} else {
+			size = a.max
+		}
+	}
+	previous := c.maxsize
+	if size != previous {
+		c.resize(size)
+	}
+	c.mutex.Unlock()
+
+	if size != previous {
+		c.logger.Info(fmt.Sprintf("Cache max size changed from %d to %d, memory usage is %.1f%% of the limit", previous, size, ratio*100))
+	}
+}
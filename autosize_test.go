@@ -0,0 +1,106 @@
+package prehit
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func TestCacheAdjust(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewCache[string, int](WithAutoSize(10, 110, time.Hour), WithMetrics(metrics))
+	defer c.Close()
+
+	if c.maxsize != 110 {
+		t.Error("Auto size must start from the upper bound")
+	}
+
+	for i := 0; i < 110; i++ {
+		c.Set(fmt.Sprint(i), i, time.Second)
+	}
+
+	var used uint64
+	a := &autosize{min: 10, max: 110, usage: func() (uint64, uint64) { return used, 100 }}
+
+	// high memory usage
+	used = 95
+	c.adjust(a)
+	if c.maxsize != 100 || c.size != 100 || metrics.evicted != 10 {
+		t.Error("Cache must shrink on high memory usage")
+	}
+
+	// the oldest items are evicted
+	if _, ok := c.Get("9"); ok {
+		t.Error("Cache must evict from the tail")
+	}
+
+	// hysteresis
+	used = 80
+	c.adjust(a)
+	if c.maxsize != 100 {
+		t.Error("Cache must keep the size between watermarks")
+	}
+
+	// min bound
+	used = 95
+	for i := 0; i < 20; i++ {
+		c.adjust(a)
+	}
+	if c.maxsize != 10 || c.size != 10 || metrics.count != 10 {
+		t.Error("Cache must not shrink below min")
+	}
+
+	// low memory usage
+	used = 50
+	c.adjust(a)
+	if c.maxsize != 20 {
+		t.Error("Cache must grow on low memory usage")
+	}
+
+	for i := 0; i < 20; i++ {
+		c.adjust(a)
+	}
+	if c.maxsize != 110 {
+		t.Error("Cache must not grow above max")
+	}
+
+	// no limit
+	a.usage = func() (uint64, uint64) { return 1000, 0 }
+	c.adjust(a)
+	if c.maxsize != 110 {
+		t.Error("Cache must not change size without memory limit")
+	}
+}
+
+func TestCacheAutoSize(t *testing.T) {
+	c := NewCache[string, int](WithAutoSize(100, 10, time.Millisecond))
+	if c.maxsize != 100 {
+		t.Error("Auto size bounds must be ordered")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	c.Close()
+	c.Close()
+
+	c.Set("test", 1, time.Second)
+	if _, ok := c.Get("test"); !ok {
+		t.Error("Cache must be usable after close")
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	previous := debug.SetMemoryLimit(1 << 40)
+	defer debug.SetMemoryLimit(previous)
+
+	used, limit := memoryusage()
+	if used == 0 || limit != 1<<40 {
+		t.Error("Memory usage failed")
+	}
+
+	debug.SetMemoryLimit(math.MaxInt64)
+	if _, limit := memoryusage(); limit != 0 {
+		t.Error("Memory limit must be zero when it is not set")
+	}
+}
@@ -0,0 +1,292 @@
+package prehit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.melnyk.org/mlog"
+	"go.melnyk.org/mlog/nolog"
+
+	"go.melnyk.org/prehit/internal/hashing"
+)
+
+const (
+	// entry header: expiration (8 bytes), key length (4 bytes), value length (4 bytes)
+	bytesheader = 16
+
+	defaultsegments    = 16
+	defaultsegmentsize = 1 << 20
+)
+
+// BytesCache is a cache for byte slice values.
+// Keys and values are appended into large preallocated byte arenas organized as a ring of
+// segments, and the index maps hashed keys to offsets, so the garbage collector does not
+// have to scan millions of small slices. When the ring wraps, the entries of the oldest
+// segment are evicted, and entries read from the oldest segment are moved to the head.
+// The capacity of the cache is defined by WithArena, WithMaxSize is only used as a hint
+// for the index size.
+type BytesCache struct {
+	logger   mlog.Logger
+	index    map[uint64]uint64 // key hash -> segment<<32 | offset
+	segments [][]byte
+	current  uint32
+	maxsize  uint
+	size     uint
+	metrics  Metrics
+	mutex    sync.RWMutex
+}
+
+// NewBytesCache creates a new byte slice cache.
+// It honours WithLogger, WithMaxSize, WithMetrics and WithArena, other options are ignored
+// with a warning.
+func NewBytesCache(o ...Option) *BytesCache {
+	local := &options{
+		logger:      nolog.NewLogbook().Joiner().Join(""), // default logger
+		maxsize:     1000,                                 // default max size
+		metrics:     &nometrics{},                         // no metrics by default
+		segments:    defaultsegments,                      // default arena
+		segmentsize: defaultsegmentsize,
+	}
+
+	for _, option := range o {
+		option.apply(local)
+	}
+	for _, name := range local.cacheonly() {
+		local.logger.Warning(fmt.Sprintf("%s is not supported by BytesCache - it is ignored", name))
+	}
+
+	segments := make([][]byte, local.segments)
+	for i := range segments {
+		segments[i] = make([]byte, 0, local.segmentsize)
+	}
+
+	return &BytesCache{
+		logger:   local.logger,
+		index:    make(map[uint64]uint64, local.maxsize),
+		segments: segments,
+		current:  0,
+		maxsize:  local.maxsize,
+		size:     0,
+		metrics:  local.metrics,
+	}
+}
+
+func location(segment, offset uint32) uint64 {
+	return uint64(segment)<<32 | uint64(offset)
+}
+
+// entry returns the entry stored at the location.
+func (c *BytesCache) entry(loc uint64) (key []byte, value []byte, expiration int64) {
+	segment := c.segments[loc>>32]
+	offset := uint32(loc)
+	expiration = int64(binary.LittleEndian.Uint64(segment[offset:]))
+	keylen := binary.LittleEndian.Uint32(segment[offset+8:])
+	valuelen := binary.LittleEndian.Uint32(segment[offset+12:])
+	start := offset + bytesheader
+	key = segment[start : start+keylen]
+	value = segment[start+keylen : start+keylen+valuelen]
+	return key, value, expiration
+}
+
+// Get returns a copy of the value for a key.
+func (c *BytesCache) Get(key string) ([]byte, bool) {
+	now := time.Now().UnixNano()
+	hash := hashing.FNV64a(key)
+	c.mutex.RLock()
+
+	if loc, found := c.index[hash]; found {
+		k, v, expiration := c.entry(loc)
+		if string(k) == key {
+			if expiration > now {
+				value := append([]byte(nil), v...)
+				movetohead := uint32(loc>>32) == c.oldest() && len(c.segments) > 1
+				c.mutex.RUnlock()
+
+				if movetohead { // oldest segment will be overwritten first
+					c.mutex.Lock()
+					c.movetohead(key, hash)
+					c.mutex.Unlock()
+				}
+				c.metrics.Hit()
+				return value, true
+			} else {
+				// remove expired element - mutex relock is needed
+				c.mutex.RUnlock()
+				c.mutex.Lock()
+				c.deleteexpired(key, hash, now)
+				c.mutex.Unlock()
+				c.metrics.Miss()
+				c.metrics.Evict()
+				c.metrics.Delete()
+				return nil, false
+			}
+		}
+	}
+
+	c.mutex.RUnlock()
+	c.metrics.Miss()
+
+	return nil, false
+}
+
+// oldest returns the segment which will be overwritten next.
+func (c *BytesCache) oldest() uint32 {
+	return (c.current + 1) % uint32(len(c.segments))
+}
+
+func (c *BytesCache) movetohead(key string, hash uint64) {
+	if loc, found := c.index[hash]; found { // it can be changes in cache, extra check is needed
+		if uint32(loc>>32) == c.oldest() {
+			k, v, expiration := c.entry(loc)
+			if string(k) == key {
+				// copy is needed - the segment can be recycled by append
+				value := append([]byte(nil), v...)
+				if newloc, ok := c.append(key, hash, value, expiration); ok {
+					c.index[hash] = newloc
+				}
+			}
+		}
+	}
+}
+
+func (c *BytesCache) deleteexpired(key string, hash uint64, tm int64) {
+	if loc, found := c.index[hash]; found { // it can be changes in cache, extra check is needed
+		k, _, expiration := c.entry(loc)
+		if string(k) == key && expiration <= tm {
+			c.remove(hash)
+		}
+	}
+}
+
+func (c *BytesCache) remove(hash uint64) {
+	delete(c.index, hash)
+	if c.size > 0 {
+		c.size--
+	} else {
+		c.logger.Warning("Inconsistency in the cache structure - more items deleted than expected")
+		c.metrics.Error()
+	}
+}
+
+// append writes the entry to the current segment, recycling the oldest segment if needed.
+func (c *BytesCache) append(key string, hash uint64, value []byte, expiration int64) (uint64, bool) {
+	length := bytesheader + len(key) + len(value)
+	if length > cap(c.segments[c.current]) {
+		c.logger.Warning("Cache entry is bigger than the arena segment")
+		c.metrics.Error()
+		return 0, false
+	}
+
+	if len(c.segments[c.current])+length > cap(c.segments[c.current]) {
+		c.current = c.oldest()
+		c.recycle(c.current, hash)
+	}
+
+	segment := c.segments[c.current]
+	offset := uint32(len(segment))
+	segment = binary.LittleEndian.AppendUint64(segment, uint64(expiration))
+	segment = binary.LittleEndian.AppendUint32(segment, uint32(len(key)))
+	segment = binary.LittleEndian.AppendUint32(segment, uint32(len(value)))
+	segment = append(segment, key...)
+	segment = append(segment, value...)
+	c.segments[c.current] = segment
+
+	return location(c.current, offset), true
+}
+
+// recycle evicts all entries of the segment which are still referenced by the index.
+// The entry with the skip hash is about to be rewritten and is not counted as evicted.
+func (c *BytesCache) recycle(segment uint32, skip uint64) {
+	data := c.segments[segment]
+	for offset := uint32(0); offset < uint32(len(data)); {
+		loc := location(segment, offset)
+		k, v, _ := c.entry(loc)
+		hash := hashing.FNV64a(string(k))
+		if hash != skip {
+			if current, found := c.index[hash]; found && current == loc {
+				c.remove(hash)
+				c.metrics.Delete()
+				c.metrics.Evict()
+			}
+		}
+		offset += bytesheader + uint32(len(k)) + uint32(len(v))
+	}
+	c.segments[segment] = data[:0]
+}
+
+// Set stores a copy of the value for a key.
+func (c *BytesCache) Set(key string, v []byte, ttl time.Duration) {
+	c.logger.Verbose("Set cache")
+	expiration := time.Now().Add(ttl).UnixNano()
+	hash := hashing.FNV64a(key)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	update := false
+	if loc, found := c.index[hash]; found {
+		if k, _, _ := c.entry(loc); string(k) == key {
+			update = true
+		} else { // hash collision - the other key is evicted
+			c.remove(hash)
+			c.metrics.Delete()
+			c.metrics.Evict()
+		}
+	}
+
+	loc, ok := c.append(key, hash, v, expiration)
+	if !ok {
+		if update { // stale value must not be served
+			c.remove(hash)
+			c.metrics.Delete()
+		}
+		return
+	}
+
+	c.index[hash] = loc
+	if update {
+		c.metrics.Update()
+		return
+	}
+
+	c.size++
+	c.metrics.Add()
+}
+
+// Delete removes a key from the cache.
+func (c *BytesCache) Delete(key ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, k := range key {
+		hash := hashing.FNV64a(k)
+		if loc, found := c.index[hash]; found {
+			if stored, _, _ := c.entry(loc); string(stored) == k {
+				c.remove(hash)
+				c.metrics.Delete()
+			}
+		}
+	}
+}
+
+// Reset clears the cache.
+func (c *BytesCache) Reset() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i := uint(0); i < c.size; i++ {
+		c.metrics.Delete()
+	}
+
+	for i := range c.segments {
+		c.segments[i] = c.segments[i][:0]
+	}
+
+	// recreate index
+	c.index = make(map[uint64]uint64, c.maxsize)
+	c.current = 0
+	c.size = 0
+
+	return nil
+}
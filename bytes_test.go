@@ -0,0 +1,156 @@
+package prehit
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBytesCacheBasic(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewBytesCache(WithArena(4, 1024), WithMetrics(metrics))
+
+	// Add case
+	c.Set("test", []byte("value"), time.Second)
+	if v, ok := c.Get("test"); !ok || !bytes.Equal(v, []byte("value")) {
+		t.Error("Cache set failed")
+	}
+
+	// Update case
+	c.Set("test", []byte("value2"), time.Second)
+	if v, ok := c.Get("test"); !ok || !bytes.Equal(v, []byte("value2")) {
+		t.Error("Cache update failed")
+	}
+
+	if metrics.count != 1 || metrics.updates != 1 || metrics.hits != 2 {
+		t.Error("Cache metrics failed")
+	}
+
+	// Returned value is a copy
+	v, _ := c.Get("test")
+	v[0] = 'X'
+	if v, _ := c.Get("test"); !bytes.Equal(v, []byte("value2")) {
+		t.Error("Cache get returned arena memory")
+	}
+
+	// Delete case
+	c.Delete("test", "unknown")
+	if _, ok := c.Get("test"); ok {
+		t.Error("Cache delete failed")
+	}
+
+	if metrics.count != 0 || metrics.miss != 1 || metrics.errors != 0 {
+		t.Error("Cache metrics failed")
+	}
+
+	// Too big entry
+	c.Set("big", make([]byte, 2048), time.Second)
+	if _, ok := c.Get("big"); ok || metrics.errors != 1 {
+		t.Error("Cache accepted entry bigger than segment")
+	}
+}
+
+func TestBytesCacheGetExpired(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewBytesCache(WithArena(4, 1024), WithMetrics(metrics))
+	c.Set("test", []byte("value"), 0)
+
+	if v, ok := c.Get("test"); ok || v != nil {
+		t.Error("Cache get failed")
+	}
+
+	if metrics.count != 0 || metrics.evicted != 1 || metrics.miss != 1 || c.size != 0 {
+		t.Error("Cache metrics failed")
+	}
+}
+
+func TestBytesCacheEviction(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewBytesCache(WithArena(3, 64), WithMetrics(metrics))
+
+	// every entry takes 16+5+11 = 32 bytes, two entries per segment
+	for i := 0; i < 6; i++ {
+		c.Set(fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%06d", i)), time.Second)
+	}
+
+	if metrics.count != 6 || metrics.evicted != 0 {
+		t.Error("Cache metrics failed")
+	}
+
+	// the ring wraps and the oldest segment is recycled
+	c.Set("key06", []byte("value000006"), time.Second)
+
+	if metrics.count != 5 || metrics.evicted != 2 || metrics.count != int(c.size) {
+		t.Error("Cache eviction failed")
+	}
+
+	if _, ok := c.Get("key00"); ok {
+		t.Error("Cache eviction failed")
+	}
+
+	// key02 lives in the oldest segment now and is moved to the head on read
+	if v, ok := c.Get("key02"); !ok || string(v) != "value000002" {
+		t.Error("Cache get failed")
+	}
+
+	c.Set("key07", []byte("value000007"), time.Second)
+	c.Set("key08", []byte("value000008"), time.Second)
+
+	if _, ok := c.Get("key02"); !ok {
+		t.Error("Cache move to head failed")
+	}
+
+	if _, ok := c.Get("key03"); ok {
+		t.Error("Cache eviction failed")
+	}
+
+	if metrics.count != int(c.size) || metrics.errors != 0 {
+		t.Error("Cache metrics failed")
+	}
+}
+
+func TestBytesCacheReset(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewBytesCache(WithMetrics(metrics))
+	c.Set("test1", []byte("1"), time.Second)
+	c.Set("test2", []byte("2"), time.Second)
+
+	c.Reset()
+
+	if _, ok := c.Get("test1"); ok {
+		t.Error("Cache reset failed")
+	}
+
+	if metrics.count != 0 || c.size != 0 || len(c.index) != 0 {
+		t.Error("Cache reset failed")
+	}
+}
+
+// cache benchmark test
+func BenchmarkBytesCacheSet(b *testing.B) {
+	c := NewBytesCache()
+	value := make([]byte, 128)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Set(fmt.Sprint(i%100000), value, time.Second)
+	}
+}
+
+func BenchmarkBytesCacheGet(b *testing.B) {
+	c := NewBytesCache()
+	value := make([]byte, 128)
+	for i := 0; i < 10000; i++ {
+		c.Set(fmt.Sprint(i), value, 100*time.Second)
+	}
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(keys[i%len(keys)])
+	}
+}
@@ -1,11 +1,16 @@
 package prehit
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
 	"go.melnyk.org/mlog"
 	"go.melnyk.org/mlog/nolog"
+	"go.melnyk.org/prehit/invalidation"
+	"go.melnyk.org/prehit/trace"
 )
 
 // cacheItem is a single item in the cache.
@@ -15,6 +20,60 @@ type cacheItem[K comparable, V any] struct {
 	key        K
 	value      V
 	expiration time.Time
+	extra      *itemextra // nil for plain values without optional features
+}
+
+// itemextra is the state of an item used only by optional features: negative entries,
+// early expiration, extended metrics, costs and write-behind.
+type itemextra struct {
+	status  Status
+	err     error
+	delta   time.Duration
+	created time.Time // set with ExtendedMetrics only
+	cost    uint64    // set with WithCost only
+	dirty   uint64    // write-behind sequence of the unwritten value, 0 if written
+}
+
+func (i *cacheItem[K, V]) status() Status {
+	if i.extra == nil {
+		return Found
+	}
+	return i.extra.status
+}
+
+func (i *cacheItem[K, V]) err() error {
+	if i.extra == nil {
+		return nil
+	}
+	return i.extra.err
+}
+
+func (i *cacheItem[K, V]) delta() time.Duration {
+	if i.extra == nil {
+		return 0
+	}
+	return i.extra.delta
+}
+
+func (i *cacheItem[K, V]) created() time.Time {
+	if i.extra == nil {
+		return time.Time{}
+	}
+	return i.extra.created
+}
+
+func (i *cacheItem[K, V]) cost() uint64 {
+	if i.extra == nil {
+		return 0
+	}
+	return i.extra.cost
+}
+
+func (i *cacheItem[K, V]) dirty() uint64 {
+	if i.extra == nil {
+		return 0
+	}
+	return i.extra.dirty
 }
 
 // Cache is a simple in-memory cache.
@@ -28,6 +87,35 @@ type Cache[K comparable, V any] struct {
 	metrics Metrics
 	mutex   sync.RWMutex
 	pool    *sync.Pool
+
+	negative NegativeMetrics
+	stats    *stats
+	extended ExtendedMetrics
+	cost     func(V) uint64
+	hotkeys  *hotkeys[K]
+	mrc      *mrc
+	tracer   *trace.Writer
+	errorttl time.Duration
+	beta     float64
+	random   func() float64
+	name     string
+	registry *Registry
+
+	validation  bool
+	evicted     func(K, V, EvictReason, time.Time)
+	store       Store[K, V]
+	behind      *writebehind[K]
+	writes      *keylocks // write-through only
+	storeerrors func([]K, error)
+	bus         invalidation.Bus
+	keycodec    KeyCodec[K]
+	origin      string
+	events      chan invalidation.Event
+	stopbus     func()
+	published   sync.WaitGroup
+
+	done   chan struct{}
+	closed sync.Once
 }
 
 // NewCache creates a new cache.
@@ -42,7 +130,11 @@ func NewCache[K comparable, V any](o ...Option) *Cache[K, V] {
 		option.apply(local)
 	}
 
-	return &Cache[K, V]{
+	if local.autosize != nil { // effective max size starts from the upper bound
+		local.maxsize = local.autosize.max
+	}
+
+	c := &Cache[K, V]{
 		logger:  local.logger,
 		index:   make(map[K]*cacheItem[K, V], local.maxsize),
 		maxsize: local.maxsize,
@@ -55,48 +147,209 @@ func NewCache[K comparable, V any](o ...Option) *Cache[K, V] {
 				return new(cacheItem[K, V])
 			},
 		},
+		done:     make(chan struct{}),
+		negative: &nometrics{},
+		stats:    newstats(time.Now()),
+		tracer:   local.tracer,
+		errorttl: local.errorttl,
+		beta:     local.beta,
+		random:   rand.Float64,
+		name:     local.name,
+
+		validation: local.validation,
+	}
+
+	if negative, ok := local.metrics.(NegativeMetrics); ok {
+		c.negative = negative
+	}
+
+	if local.hotkeys > 0 {
+		c.hotkeys = newhotkeys[K](local.hotkeys)
+	}
+
+	if local.mrcrate > 0 {
+		c.mrc = newmrc(local.mrcrate, local.maxsize)
+	}
+
+	if extended, ok := local.metrics.(ExtendedMetrics); ok {
+		c.extended = extended
+	}
+
+	if local.cost != nil {
+		if cost, ok := local.cost.(func(V) uint64); ok {
+			c.cost = cost
+		} else {
+			c.logger.Warning("Cost function does not match the cache value type - it is ignored")
+		}
+	}
+
+	if local.evicted != nil {
+		if evicted, ok := local.evicted.(func(K, V, EvictReason, time.Time)); ok {
+			c.evicted = evicted
+		} else {
+			c.logger.Warning("Evict callback does not match the cache key and value types - it is ignored")
+		}
+	}
+
+	if local.store != nil {
+		if store, ok := local.store.store.(Store[K, V]); !ok {
+			c.logger.Warning("Store does not match the cache key and value types - it is ignored")
+		} else if local.store.behind && local.store.interval <= 0 {
+			c.logger.Warning("Write-behind interval must be positive - the store is ignored")
+		} else {
+			c.store = store
+			if !local.store.behind {
+				c.writes = &keylocks{}
+			} else {
+				c.behind = &writebehind[K]{
+					interval: local.store.interval,
+					batch:    local.store.batch,
+					max:      local.maxpending,
+					pending:  make(map[K]pendingwrite),
+					signal:   make(chan struct{}, 1),
+				}
+				c.behind.wg.Add(1)
+				go c.writebehind()
+			}
+		}
+	}
+
+	if local.storeerrors != nil {
+		if handler, ok := local.storeerrors.(func([]K, error)); ok {
+			c.storeerrors = handler
+		} else {
+			c.logger.Warning("Store error handler does not match the cache key type - it is ignored")
+		}
 	}
+
+	if local.bus != nil {
+		c.startinvalidation(local.bus, local.keycodec)
+	}
+
+	if local.autosize != nil {
+		go c.autosize(local.autosize)
+	}
+
+	if c.name != "" {
+		registry := local.registry
+		if registry == nil {
+			registry = DefaultRegistry
+		}
+		if err := registry.register(c); err != nil {
+			c.logger.Warning(err.Error() + " - the cache is not registered")
+		} else {
+			c.registry = registry
+		}
+	}
+
+	return c
 }
 
+// Get returns a value for a key.
+// Negative entries stored by SetMissing and SetError are reported as not found.
 func (c *Cache[K, V]) Get(key K) (V, bool) {
+	value, status, _ := c.Lookup(key)
+	return value, status == Found
+}
+
+// Lookup returns a value for a key and the status of the key.
+// The cached error is returned for the Failed status.
+func (c *Cache[K, V]) Lookup(key K) (V, Status, error) {
 	now := time.Now()
+	e := c.lookup(key, now)
+	c.tracklatency(OpGet, now)
+	return e.value, e.status, e.err
+}
+
+// entry is a snapshot of a cache item returned by lookup.
+type entry[V any] struct {
+	value      V
+	status     Status
+	err        error
+	expiration time.Time
+	delta      time.Duration
+}
+
+func (c *Cache[K, V]) lookup(key K, now time.Time) entry[V] {
+	e := c.find(key, now)
+	if c.tracer != nil {
+		c.tracer.Write(trace.Event{Time: now, Op: trace.Get, Key: hashkey(key)})
+	}
+	if c.mrc != nil {
+		c.mrc.access(hashkey(key))
+	}
+	if c.hotkeys != nil {
+		if e.status == Unknown {
+			c.hotkeys.misses.add(key)
+		} else {
+			c.hotkeys.hits.add(key)
+		}
+	}
+	return e
+}
+
+func (c *Cache[K, V]) find(key K, now time.Time) entry[V] {
 	c.mutex.RLock()
 
 	if item, found := c.index[key]; found {
 		if item != nil {
 			if item.expiration.After(now) {
-				value := item.value
+				e := entry[V]{
+					value:      item.value,
+					status:     item.status(),
+					err:        item.err(),
+					expiration: item.expiration,
+					delta:      item.delta(),
+				}
 				movetohead := (item.next == nil) && (c.size > 1)
 				c.mutex.RUnlock()
 
 				if movetohead { // last Item and more than one item
 					c.mutex.Lock()
 					c.movetohead(key)
+					c.check()
 					c.mutex.Unlock()
 				}
-				c.metrics.Hit()
-				return value, true
+				switch e.status {
+				case Missing:
+					c.trackmissinghit()
+				case Failed:
+					c.trackerrorhit()
+				default:
+					c.trackhit()
+				}
+				return e
 			} else {
 				// remove expired element - mutex relock is needed
+				created, cost := item.created(), item.cost()
 				c.mutex.RUnlock()
 				c.mutex.Lock()
-				c.deleteexpired(key, now)
+				deleted := c.deleteexpired(key, now)
+				c.check()
 				c.mutex.Unlock()
-				c.metrics.Miss()
-				c.metrics.Evict()
-				c.metrics.Delete()
-				return *new(V), false
+				c.trackmiss()
+				if deleted {
+					c.trackevict(EvictExpired, created, cost)
+					c.trackdelete()
+				}
+				return entry[V]{}
 			}
 		} else {
 			c.logger.Warning("Inconsistency in the cache structure - cache item cannot be nil")
-			c.metrics.Error()
+			c.trackerror()
+			c.mutex.RUnlock()
+			c.mutex.Lock()
+			c.repair()
+			c.mutex.Unlock()
+			c.trackmiss()
+			return entry[V]{}
 		}
 	}
 
 	c.mutex.RUnlock()
-	c.metrics.Miss()
+	c.trackmiss()
 
-	return *new(V), false
+	return entry[V]{}
 }
 
 func (c *Cache[K, V]) movetohead(key K) {
@@ -118,10 +371,11 @@ func (c *Cache[K, V]) movetohead(key K) {
 	}
 }
 
-func (c *Cache[K, V]) deleteexpired(key K, tm time.Time) {
+// deleteexpired removes the item if it is still expired and reports whether it is removed.
+func (c *Cache[K, V]) deleteexpired(key K, tm time.Time) bool {
 	if item, found := c.index[key]; found { // it can be changes in cache, extra check is needed
 		if item != nil {
-			if item.expiration.Before(tm) {
+			if !item.expiration.After(tm) && item.dirty() == 0 { // dirty items wait for write-behind
 				if item.next != nil {
 					item.next.prev = item.prev
 				}
@@ -136,32 +390,136 @@ func (c *Cache[K, V]) deleteexpired(key K, tm time.Time) {
 				}
 				item.prev = nil
 				item.next = nil
+			} else { // the item is updated by another goroutine or not written yet
+				return false
 			}
 		} else {
 			c.logger.Warning("Inconsistency in the cache structure - item element cannot be nil")
-			c.metrics.Error()
+			c.trackerror()
+			delete(c.index, key)
+			c.repair()
+			return false
 		}
 		delete(c.index, key)
+		c.evict(item, EvictExpired)
 		c.pool.Put(item)
 		if c.size > 0 {
 			c.size--
 		} else {
 			c.logger.Warning("Inconsistency in the cache structure - more items deleted than expected")
-			c.metrics.Error()
+			c.trackerror()
+			c.repair()
 		}
+		return true
 	}
+	return false
 }
 
 // Set stores a value for a key.
 func (c *Cache[K, V]) Set(key K, v V, ttl time.Duration) {
 	c.logger.Verbose("Set cache")
-	expiration := time.Now().Add(ttl)
+	c.set(setalways, key, v, ttl, 0, Found, nil)
+}
+
+// SetMissing remembers that the key does not exist.
+func (c *Cache[K, V]) SetMissing(key K, ttl time.Duration) {
+	c.logger.Verbose("Set missing cache")
+	c.set(setalways, key, *new(V), ttl, 0, Missing, nil)
+}
+
+// SetError remembers that loading of the key failed with the error.
+// The entry lives for the TTL set by WithErrorTTL, errors are not cached without it.
+func (c *Cache[K, V]) SetError(key K, err error) {
+	if c.errorttl <= 0 {
+		return
+	}
+	c.logger.Verbose("Set error cache")
+	c.set(setalways, key, *new(V), c.errorttl, 0, Failed, err)
+}
+
+// setmode is a condition of storing a value by set.
+type setmode int
+
+const (
+	setalways  setmode = iota // store the value
+	setabsent                 // store the value only if the key is not in the cache
+	setpresent                // store the value only if the key is in the cache
+	setrestore                // store the value only if the key is not in the cache, without propagation
+)
+
+func (c *Cache[K, V]) set(mode setmode, key K, v V, ttl time.Duration, delta time.Duration, status Status, err error) (stored bool) {
+	now := time.Now()
+	expiration := now.Add(ttl)
+	var cost uint64
+	if c.cost != nil {
+		cost = c.cost(v)
+	}
+	if c.extended != nil {
+		defer c.tracklatency(OpSet, now) // deferred before unlock to run after it
+	}
+	if c.hotkeys != nil {
+		c.hotkeys.writes.add(key)
+	}
+	if c.tracer != nil { // only stored values are traced, rejected Add and Replace are not
+		defer func() { // deferred before unlock to run after it
+			if stored {
+				e := trace.Event{Time: now, Op: trace.Set, Key: hashkey(key), TTL: ttl}
+				if ttl <= 0 {
+					e.TTL, e.Expired = 0, true
+				}
+				c.tracer.Write(e)
+			}
+		}()
+	}
+	if mode != setrestore { // the store and the cache see changes of the key in the same order
+		unlock := c.lockkeys(key)
+		defer unlock()
+	}
+	var rejected error
+	defer func() { // deferred before unlock to run after it
+		if rejected != nil {
+			c.storefailed([]K{key}, rejected)
+		}
+	}()
+	if mode == setabsent || mode == setpresent { // conditions are checked before the write-through
+		c.mutex.RLock()
+		item, found := c.index[key]
+		admitted := c.admits(mode, item, found, now)
+		c.mutex.RUnlock()
+		if !admitted {
+			return false
+		}
+	}
+	if c.store != nil && c.behind == nil && status == Found && mode != setrestore {
+		if c.writethrough([]Entry[K, V]{{Key: key, Value: v, Expiration: expiration}}) != nil {
+			return false
+		}
+	}
+	if c.bus != nil && mode != setrestore {
+		c.publish(invalidation.Event{Keys: c.encodekeys([]K{key})})
+	}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	defer c.check() // deferred after unlock to run before it
 
-	if item, found := c.index[key]; found {
+	item, found := c.index[key]
+	if !c.admits(mode, item, found, now) {
+		return false
+	}
+
+	var dirty uint64
+	if c.behind != nil && status == Found && mode != setrestore {
+		if !c.admitspending(key) {
+			rejected = ErrPendingLimit
+			return false
+		}
+		dirty = c.markdirty(key, false)
+	}
+
+	if found && item != nil {
 		item.value = v
 		item.expiration = expiration
+		c.setextra(item, status, err, delta, now, cost, dirty)
 		if item.next == nil { // last item
 			if c.size > 1 { // more than one item
 				// move item from the tail to the head
@@ -173,34 +531,21 @@ func (c *Cache[K, V]) Set(key K, v V, ttl time.Duration) {
 				c.head = item
 			}
 		}
-		c.metrics.Update()
-		return
+		c.trackupdate()
+		return true
 	}
 
-	if c.size == c.maxsize { // we reached max size,
+	if c.size >= c.maxsize { // we reached max size,
 		// remove the last item
-		if c.tail != nil {
-			item := c.tail
-			c.tail = c.tail.prev
-			if c.tail != nil { // more than one item
-				c.tail.next = nil
-			} else { // list is empty
-				c.head = nil
-			}
-			c.size--
-			delete(c.index, item.key)
-			item.prev = nil
-			c.pool.Put(item)
-			c.metrics.Delete()
-			c.metrics.Evict()
-		}
+		c.evicttail()
 	}
 
 	// add new item to the head
-	item := c.pool.Get().(*cacheItem[K, V])
+	item = c.pool.Get().(*cacheItem[K, V])
 	item.key = key
 	item.value = v
 	item.expiration = expiration
+	c.setextra(item, status, err, delta, now, cost, dirty)
 	item.prev = nil
 	item.next = c.head
 
@@ -213,14 +558,211 @@ func (c *Cache[K, V]) Set(key K, v V, ttl time.Duration) {
 	c.head = item
 	c.index[key] = item
 	c.size++
-	c.metrics.Add()
+	c.trackadd()
+	return true
+}
+
+// setextra sets the optional state of the item, it is allocated only if needed.
+func (c *Cache[K, V]) setextra(item *cacheItem[K, V], status Status, err error, delta time.Duration, now time.Time, cost uint64, dirty uint64) {
+	if status == Found && err == nil && delta == 0 && dirty == 0 && c.extended == nil && c.cost == nil {
+		item.extra = nil
+		return
+	}
+
+	if item.extra == nil {
+		item.extra = new(itemextra)
+	}
+	*item.extra = itemextra{status: status, err: err, delta: delta, cost: cost, dirty: dirty}
+	if c.extended != nil {
+		item.extra.created = now
+	}
+}
+
+// admits reports whether the set mode allows to store a value over the item, the caller holds the lock.
+func (c *Cache[K, V]) admits(mode setmode, item *cacheItem[K, V], found bool, now time.Time) bool {
+	live := found && item != nil && item.expiration.After(now)
+	switch {
+	case live && (mode == setabsent || mode == setrestore):
+		return false
+	case !live && mode == setpresent:
+		return false
+	}
+	return true
+}
+
+// Add stores a value for a key only if the key is not in the cache and reports whether it is stored.
+// In the write-through mode the value is written to the store first, like by Set; concurrent
+// changes of the key wait, so only an admitted value is written.
+func (c *Cache[K, V]) Add(key K, v V, ttl time.Duration) bool {
+	return c.set(setabsent, key, v, ttl, 0, Found, nil)
+}
+
+// Replace stores a value for a key only if the key is in the cache and reports whether it is stored.
+// In the write-through mode the value is written to the store first, like by Add.
+func (c *Cache[K, V]) Replace(key K, v V, ttl time.Duration) bool {
+	return c.set(setpresent, key, v, ttl, 0, Found, nil)
+}
+
+// Touch changes the TTL of a key and reports whether the key is in the cache.
+func (c *Cache[K, V]) Touch(key K, ttl time.Duration) bool {
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	item, found := c.index[key]
+	if !found || item == nil || !item.expiration.After(now) {
+		return false
+	}
+	item.expiration = now.Add(ttl)
+	return true
+}
+
+// TTL returns the remaining TTL of a key and reports whether the key is in the cache.
+// Unlike Get, it changes neither the order of items nor statistics.
+func (c *Cache[K, V]) TTL(key K) (time.Duration, bool) {
+	now := time.Now()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	item, found := c.index[key]
+	if !found || item == nil || !item.expiration.After(now) {
+		return 0, false
+	}
+	return item.expiration.Sub(now), true
+}
+
+// Len returns the number of items in the cache including expired ones not removed yet.
+func (c *Cache[K, V]) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return int(c.size)
+}
+
+// evicttail removes the last item from the cache and reports whether an item is removed.
+// Dirty items waiting for write-behind are skipped.
+func (c *Cache[K, V]) evicttail() bool {
+	item := c.tail
+	for item != nil && item.dirty() != 0 {
+		item = item.prev
+	}
+	if item == nil {
+		if c.behind != nil && c.tail != nil { // all items are dirty
+			c.signalflush()
+		}
+		return false
+	}
+
+	if item.next != nil {
+		item.next.prev = item.prev
+	} else {
+		c.tail = item.prev
+	}
+	if item.prev != nil {
+		item.prev.next = item.next
+	} else {
+		c.head = item.next
+	}
+	item.prev = nil
+	item.next = nil
+	c.size--
+	delete(c.index, item.key)
+	c.evict(item, EvictCapacity)
+	c.pool.Put(item)
+	c.trackdelete()
+	c.trackevict(EvictCapacity, item.created(), item.cost())
+	return true
+}
+
+// Resize changes the max size of the cache and evicts items from the tail if needed.
+// With WithAutoSize the size is adjusted again on the next interval.
+func (c *Cache[K, V]) Resize(size uint) {
+	c.mutex.Lock()
+	previous := c.maxsize
+	c.resize(size)
+	c.mutex.Unlock()
+
+	c.logger.Info(fmt.Sprintf("Cache max size changed from %d to %d", previous, size))
+}
+
+// Name returns the name set by WithName.
+func (c *Cache[K, V]) Name() string {
+	return c.name
+}
+
+// evict reports the evicted item to the callback set by WithEvictCallback.
+// Negative entries are not reported.
+func (c *Cache[K, V]) evict(item *cacheItem[K, V], reason EvictReason) {
+	if c.evicted != nil && item.status() == Found {
+		c.evicted(item.key, item.value, reason, item.expiration)
+	}
+}
+
+// resize changes the max size of the cache and evicts items from the tail if needed.
+func (c *Cache[K, V]) resize(size uint) {
+	c.maxsize = size
+	for c.size > c.maxsize && c.evicttail() {
+	}
+	if c.mrc != nil {
+		c.mrc.resize(size)
+	}
+	c.check()
 }
 
 // Delete removes a key from the cache.
 func (c *Cache[K, V]) Delete(key ...K) {
+	if c.extended != nil {
+		defer c.tracklatency(OpDelete, time.Now()) // deferred before unlock to run after it
+	}
+	if c.tracer != nil {
+		now := time.Now()
+		for _, k := range key {
+			c.tracer.Write(trace.Event{Time: now, Op: trace.Delete, Key: hashkey(k)})
+		}
+	}
+	unlock := c.lockkeys(key...)
+	defer unlock()
+	var rejected []K
+	defer func() { // deferred before unlock to run after it
+		if len(rejected) > 0 {
+			c.storefailed(rejected, ErrPendingLimit)
+		}
+	}()
+	if c.store != nil && c.behind == nil {
+		entries := make([]Entry[K, V], len(key))
+		for i, k := range key {
+			entries[i] = Entry[K, V]{Key: k, Deleted: true}
+		}
+		c.writethrough(entries) // the keys are removed from the cache anyway
+	}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	defer c.check() // deferred after unlock to run before it
+
+	if c.behind != nil {
+		accepted := key[:0:0]
+		for _, k := range key {
+			if !c.admitspending(k) {
+				rejected = append(rejected, k)
+				continue
+			}
+			c.markdirty(k, true)
+			accepted = append(accepted, k)
+		}
+		key = accepted
+	}
+	if c.bus != nil && len(key) > 0 {
+		c.publish(invalidation.Event{Keys: c.encodekeys(key)})
+	}
+
+	c.remove(key)
+}
 
+// remove removes keys from the cache, the caller holds the write lock.
+func (c *Cache[K, V]) remove(key []K) {
+	corrupted := false
 	for _, k := range key {
 		if item, found := c.index[k]; found {
 			if item != nil {
@@ -240,37 +782,104 @@ func (c *Cache[K, V]) Delete(key ...K) {
 				item.next = nil
 
 				c.pool.Put(item)
+			} else {
+				c.logger.Warning("Inconsistency in the cache structure - cache item cannot be nil")
+				c.trackerror()
+				corrupted = true
 			}
 			delete(c.index, k)
-			c.metrics.Delete()
+			c.trackdelete()
 			if c.size > 0 {
 				c.size--
 			} else {
 				c.logger.Warning("Inconsistency in the cache structure - more items deleted than expected")
-				c.metrics.Error()
+				c.trackerror()
+				corrupted = true
 			}
 		}
 	}
+
+	if corrupted {
+		c.repair()
+	}
 }
 
 // Reset clears the cache.
+// Pending write-behind changes are written first, the cache is not cleared if it fails.
+// Items changed concurrently after the flush are kept until write-behind writes them.
 func (c *Cache[K, V]) Reset() error {
+	if c.extended != nil {
+		defer c.tracklatency(OpReset, time.Now()) // deferred before unlock to run after it
+	}
+	if c.behind != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), storetimeout)
+		err := c.Flush(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	for c.head != nil {
-		item := c.head
-		c.head = c.head.next
-		item.prev = nil
-		item.next = nil
-		c.pool.Put(item)
-		c.metrics.Delete()
+	if c.bus != nil {
+		c.publish(invalidation.Event{Reset: true})
+	}
+
+	c.clear()
+	return nil
+}
+
+// clear removes all items except dirty ones changed after the last flush, the caller holds
+// the write lock. Dirty items are kept in order until write-behind writes them.
+func (c *Cache[K, V]) clear() {
+	var head, tail *cacheItem[K, V]
+	var size uint
+	index := make(map[K]*cacheItem[K, V], c.maxsize)
+
+	for item := c.head; item != nil; {
+		next := item.next
+		if item.dirty() != 0 {
+			item.prev = tail
+			item.next = nil
+			if tail != nil {
+				tail.next = item
+			} else {
+				head = item
+			}
+			tail = item
+			index[item.key] = item
+			size++
+		} else {
+			item.prev = nil
+			item.next = nil
+			c.pool.Put(item)
+			c.trackdelete()
+		}
+		item = next
 	}
 
 	// recreate index
-	c.index = make(map[K]*cacheItem[K, V], c.maxsize)
-	c.tail = nil
-	c.size = 0
+	c.index = index
+	c.head = head
+	c.tail = tail
+	c.size = size
+	c.check()
+}
 
-	return nil
+// Close stops background activities of the cache, removes it from the registry
+// and flushes pending write-behind changes. The cache stays usable after Close,
+// but later changes are written to the store only by Flush.
+func (c *Cache[K, V]) Close() error {
+	var err error
+	c.closed.Do(func() {
+		close(c.done)
+		if c.registry != nil {
+			c.registry.deregister(c)
+		}
+		c.closeinvalidation()
+		err = c.closestore()
+	})
+
+	return err
 }
@@ -501,6 +501,75 @@ func TestCacheReset(t *testing.T) {
 	}
 }
 
+func TestCacheAddReplace(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20), WithValidation(true))
+
+	if !c.Add("test", 1, time.Second) || c.Add("test", 2, time.Second) {
+		t.Error("Cache add failed")
+	}
+	if v, _ := c.Get("test"); v != 1 {
+		t.Error("Cache add must not overwrite")
+	}
+
+	if !c.Replace("test", 3, time.Second) || c.Replace("other", 4, time.Second) {
+		t.Error("Cache replace failed")
+	}
+	if v, _ := c.Get("test"); v != 3 {
+		t.Error("Cache replace must overwrite")
+	}
+	if _, ok := c.Get("other"); ok {
+		t.Error("Cache replace must not add")
+	}
+
+	// expired keys are absent
+	c.Set("expired", 1, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if c.Replace("expired", 2, time.Second) || !c.Add("expired", 3, time.Second) {
+		t.Error("Expired key must be absent")
+	}
+
+	if c.Len() != 2 {
+		t.Errorf("Unexpected length %d", c.Len())
+	}
+}
+
+func TestCacheTouch(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20))
+	c.Set("test", 1, 5*time.Millisecond)
+
+	if !c.Touch("test", time.Hour) || c.Touch("other", time.Hour) {
+		t.Error("Cache touch failed")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := c.Get("test"); !ok {
+		t.Error("Touched key must not expire")
+	}
+
+	c.Touch("test", -time.Second)
+	if _, ok := c.Get("test"); ok || c.Touch("test", time.Hour) {
+		t.Error("Key must expire after touch with negative TTL")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20))
+	c.Set("test", 1, time.Hour)
+	c.Set("expired", 2, -time.Second)
+
+	if ttl, ok := c.TTL("test"); !ok || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Unexpected TTL %v", ttl)
+	}
+	if _, ok := c.TTL("expired"); ok {
+		t.Error("Expired key must have no TTL")
+	}
+	if _, ok := c.TTL("other"); ok {
+		t.Error("Missed key must have no TTL")
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Error("TTL must not change statistics")
+	}
+}
+
 func TestCacheInternal(t *testing.T) {
 	c := NewCache[string, int](WithMaxSize(10))
 	c.Set("test1", 1, time.Second)
@@ -678,3 +747,31 @@ func BenchmarkTimeNow(b *testing.B) {
 	}
 	_ = res
 }
+
+func TestCacheItemExtra(t *testing.T) {
+	c := NewCache[string, int]()
+
+	// plain values do not allocate the optional state
+	c.Set("a", 1, time.Hour)
+	if c.index["a"].extra != nil {
+		t.Error("Plain value must not have extra state")
+	}
+
+	c.SetMissing("a", time.Hour)
+	if item := c.index["a"]; item.extra == nil || item.status() != Missing || !item.created().IsZero() {
+		t.Errorf("Unexpected extra state %+v", item.extra)
+	}
+
+	// the state is dropped when the value becomes plain again
+	c.Set("a", 1, time.Hour)
+	if item := c.index["a"]; item.extra != nil || item.status() != Found {
+		t.Error("Extra state must be dropped")
+	}
+
+	// creation time and cost are kept only for their features
+	e := NewCache[string, int](WithMetrics(&extendedmetrics{}), WithCost(func(v int) uint64 { return uint64(v) }))
+	e.Set("a", 3, time.Hour)
+	if item := e.index["a"]; item.created().IsZero() || item.cost() != 3 {
+		t.Errorf("Unexpected extra state %+v", item.extra)
+	}
+}
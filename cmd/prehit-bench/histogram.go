@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// subbuckets is a number of linear sub-buckets per power of two, the relative error is 1/8.
+const subbuckets = 8
+
+// histogram counts latencies in logarithmic buckets.
+type histogram struct {
+	counts [64 * subbuckets]uint64
+	total  uint64
+}
+
+// bucket returns the bucket index for the value.
+func bucket(v uint64) int {
+	if v < subbuckets {
+		return int(v)
+	}
+	exp := bits.Len64(v) - 4 // keep 3 bits of the mantissa after the leading one
+	return (exp+1)*subbuckets + int(v>>uint(exp)) - subbuckets
+}
+
+// upper returns the largest value in the bucket.
+func upper(index int) uint64 {
+	if index < subbuckets {
+		return uint64(index)
+	}
+	exp := index/subbuckets - 1
+	mantissa := uint64(index%subbuckets + subbuckets)
+	return (mantissa+1)<<uint(exp) - 1
+}
+
+func (h *histogram) add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucket(uint64(d))]++
+	h.total++
+}
+
+func (h *histogram) merge(other *histogram) {
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.total += other.total
+}
+
+// quantile returns the upper bound of the bucket containing the quantile q in [0, 1].
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.total))
+	if rank >= h.total {
+		rank = h.total - 1
+	}
+	var seen uint64
+	for i, count := range h.counts {
+		seen += count
+		if seen > rank {
+			return time.Duration(upper(i))
+		}
+	}
+	return time.Duration(upper(len(h.counts) - 1))
+}
@@ -0,0 +1,156 @@
+// Command prehit-bench runs synthetic workloads concurrently against prehit.Cache
+// and prints throughput, latency percentiles and the hit ratio.
+//
+// Usage:
+//
+//	prehit-bench [-workload zipf|uniform|scan|shifting] [-keys 1000000] [-size 100000] [-skew 1.1]
+//	             [-reads 0.9] [-ttl fixed:1m] [-workers 8] [-duration 10s] [-seed 1]
+//
+// Workers use the cache-aside pattern: a missed read is followed by Set of the key.
+// Latencies include the fill after a miss.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.melnyk.org/prehit"
+	"go.melnyk.org/prehit/workload"
+)
+
+// result is a result of a benchmark run.
+type result struct {
+	ops       uint64
+	hits      uint64
+	misses    uint64
+	elapsed   time.Duration
+	latencies histogram
+}
+
+func (r *result) ratio() float64 {
+	if r.hits+r.misses == 0 {
+		return 0
+	}
+	return float64(r.hits) / float64(r.hits+r.misses)
+}
+
+func (r *result) throughput() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.ops) / r.elapsed.Seconds()
+}
+
+func (r *result) merge(other *result) {
+	r.ops += other.ops
+	r.hits += other.hits
+	r.misses += other.misses
+	r.latencies.merge(&other.latencies)
+}
+
+// bench runs the workers against a cache of the size for the duration.
+func bench(spec workload.Spec, size uint, workers int, duration time.Duration, seed int64) (*result, error) {
+	generators := make([]*workload.Workload, workers)
+	for i := range generators {
+		w, err := spec.New(seed + int64(i))
+		if err != nil {
+			return nil, err
+		}
+		generators[i] = w
+	}
+
+	c := prehit.NewCache[uint64, uint64](prehit.WithMaxSize(size))
+	defer c.Close()
+
+	results := make([]result, workers)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := range generators {
+		wg.Add(1)
+		go func(w *workload.Workload, res *result) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				op := w.Next()
+				begin := time.Now()
+				if op.Read {
+					if _, ok := c.Get(op.Key); ok {
+						res.hits++
+					} else {
+						res.misses++
+						c.Set(op.Key, op.Key, op.TTL)
+					}
+				} else {
+					c.Set(op.Key, op.Key, op.TTL)
+				}
+				res.latencies.add(time.Since(begin))
+				res.ops++
+			}
+		}(generators[i], &results[i])
+	}
+
+	time.Sleep(duration)
+	close(done)
+	wg.Wait()
+
+	total := &result{elapsed: time.Since(start)}
+	for i := range results {
+		total.merge(&results[i])
+	}
+	return total, nil
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("prehit-bench", flag.ContinueOnError)
+	distribution := flags.String("workload", "zipf", "key distribution: zipf, uniform, scan or shifting")
+	keys := flags.Uint64("keys", 1000000, "number of distinct keys")
+	size := flags.Uint("size", 100000, "cache max size")
+	skew := flags.Float64("skew", 1.1, "zipf skew, greater than 1")
+	reads := flags.Float64("reads", 0.9, "part of reads in [0, 1]")
+	ttl := flags.String("ttl", "fixed:1m", "TTL distribution: fixed:1m, uniform:10s-1m or exp:30s")
+	workers := flags.Int("workers", runtime.GOMAXPROCS(0), "number of concurrent workers")
+	duration := flags.Duration("duration", 10*time.Second, "duration of the run")
+	seed := flags.Int64("seed", 1, "random seed of the first worker")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *size == 0 || *workers <= 0 || *duration <= 0 {
+		return fmt.Errorf("size, workers and duration must be positive")
+	}
+
+	spec := workload.Spec{Distribution: *distribution, Keys: *keys, Skew: *skew, Reads: *reads, TTL: *ttl}
+	res, err := bench(spec, *size, *workers, *duration, *seed)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "workers\tops\tops/sec\tp50\tp99\tp99.9\thit ratio\t")
+	fmt.Fprintf(w, "%d\t%d\t%.0f\t%v\t%v\t%v\t%.4f\t\n", *workers, res.ops, res.throughput(),
+		res.latencies.quantile(0.5), res.latencies.quantile(0.99), res.latencies.quantile(0.999), res.ratio())
+	return w.Flush()
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "prehit-bench:", err)
+		os.Exit(1)
+	}
+}
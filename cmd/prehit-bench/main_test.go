@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit/workload"
+)
+
+func TestHistogram(t *testing.T) {
+	// every value fits into its bucket
+	for _, v := range []uint64{0, 1, 7, 8, 9, 15, 16, 17, 100, 1000, 123456789} {
+		i := bucket(v)
+		if v > upper(i) || (i > 0 && v <= upper(i-1)) {
+			t.Errorf("Value %d is out of bucket %d", v, i)
+		}
+	}
+
+	var h histogram
+	if h.quantile(0.99) != 0 {
+		t.Error("Empty histogram must have zero quantiles")
+	}
+	for i := 1; i <= 100; i++ {
+		h.add(time.Duration(i) * time.Microsecond)
+	}
+	if p50 := h.quantile(0.5); p50 < 50*time.Microsecond || p50 > 57*time.Microsecond {
+		t.Errorf("Unexpected p50 %v", p50)
+	}
+	if p99 := h.quantile(0.99); p99 < 99*time.Microsecond || p99 > 112*time.Microsecond {
+		t.Errorf("Unexpected p99 %v", p99)
+	}
+}
+
+func TestBench(t *testing.T) {
+	spec := workload.Spec{Distribution: "uniform", Keys: 100, Reads: 0.9, TTL: "fixed:1m"}
+	res, err := bench(spec, 100, 2, 20*time.Millisecond, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ops == 0 || res.ops != res.latencies.total {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	// all keys fit into the cache
+	if res.misses > 100 || res.ratio() < 0.5 {
+		t.Errorf("Unexpected hit ratio %f", res.ratio())
+	}
+
+	if _, err := bench(workload.Spec{Distribution: "unknown", Keys: 100}, 100, 1, time.Millisecond, 1); err == nil {
+		t.Error("Expected error for unknown workload")
+	}
+}
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"-keys", "1000", "-size", "100", "-workers", "2", "-duration", "10ms"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	for _, args := range [][]string{
+		{"extra"},
+		{"-workers", "0"},
+		{"-workload", "unknown"},
+		{"-ttl", "none"},
+	} {
+		if err := run(args, &out); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
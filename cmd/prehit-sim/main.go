@@ -0,0 +1,203 @@
+// Command prehit-sim replays cache access traces against prehit.Cache with different
+// max sizes and prints hit ratios and throughput.
+//
+// Usage:
+//
+//	prehit-sim [-format prehit|arc|lirs|twitter] [-sizes 1000,10000] [-fill auto|true|false] [-ttl 24h] trace
+//
+// Traces in the native format are recorded by prehit.WithTrace. Block traces (ARC, LIRS)
+// contain reads only, so missed keys are stored after the lookup (fill). TTLs are applied
+// in real time, so expirations are not reproduced in fast replays.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.melnyk.org/prehit"
+	"go.melnyk.org/prehit/trace"
+)
+
+// result is a result of a single replay.
+type result struct {
+	size    uint
+	events  uint64
+	hits    uint64
+	misses  uint64
+	elapsed time.Duration
+}
+
+func (r result) ratio() float64 {
+	if r.hits+r.misses == 0 {
+		return 0
+	}
+	return float64(r.hits) / float64(r.hits+r.misses)
+}
+
+func (r result) throughput() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.events) / r.elapsed.Seconds()
+}
+
+// simulate replays the source against a cache of the size.
+// With fill, missed keys are stored after Get. Set events without TTL use the default TTL,
+// values stored already expired are replayed as expired.
+func simulate(src trace.Source, size uint, fill bool, ttl time.Duration) (result, error) {
+	c := prehit.NewCache[uint64, struct{}](prehit.WithMaxSize(size))
+	res := result{size: size}
+
+	start := time.Now()
+	for {
+		e, err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+
+		res.events++
+		switch e.Op {
+		case trace.Get:
+			if _, ok := c.Get(e.Key); ok {
+				res.hits++
+			} else {
+				res.misses++
+				if fill {
+					c.Set(e.Key, struct{}{}, ttl)
+				}
+			}
+		case trace.Set:
+			switch {
+			case e.Expired: // replayed as stored, the value expires at once
+				c.Set(e.Key, struct{}{}, 0)
+			case e.TTL > 0:
+				c.Set(e.Key, struct{}{}, e.TTL)
+			default:
+				c.Set(e.Key, struct{}{}, ttl)
+			}
+		case trace.Delete:
+			c.Delete(e.Key)
+		}
+	}
+	res.elapsed = time.Since(start)
+
+	return res, nil
+}
+
+// open opens the trace file in the format.
+func open(path string, format string) (trace.Source, io.Closer, error) {
+	var in io.ReadCloser = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		in = f
+	}
+
+	switch format {
+	case "prehit":
+		r, err := trace.NewReader(in)
+		if err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		return r, in, nil
+	case "arc":
+		return trace.NewARCReader(in), in, nil
+	case "lirs":
+		return trace.NewLIRSReader(in), in, nil
+	case "twitter":
+		return trace.NewTwitterReader(in), in, nil
+	default:
+		in.Close()
+		return nil, nil, fmt.Errorf("unknown trace format %q", format)
+	}
+}
+
+// parsesizes parses a comma separated list of sizes.
+func parsesizes(list string) ([]uint, error) {
+	var sizes []uint
+	for _, field := range strings.Split(list, ",") {
+		size, err := strconv.ParseUint(strings.TrimSpace(field), 10, 0)
+		if err != nil || size == 0 {
+			return nil, fmt.Errorf("invalid size %q", field)
+		}
+		sizes = append(sizes, uint(size))
+	}
+	return sizes, nil
+}
+
+// parsefill resolves the fill mode for the format.
+func parsefill(mode string, format string) (bool, error) {
+	switch mode {
+	case "auto":
+		return format == "arc" || format == "lirs", nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid fill mode %q", mode)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("prehit-sim", flag.ContinueOnError)
+	format := flags.String("format", "prehit", "trace format: prehit, arc, lirs or twitter")
+	sizelist := flags.String("sizes", "1000,10000,100000", "comma separated cache sizes")
+	fillmode := flags.String("fill", "auto", "store missed keys after Get: auto, true or false")
+	ttl := flags.Duration("ttl", 24*time.Hour, "TTL of stored keys without TTL in the trace")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("exactly one trace file is expected (- for stdin)")
+	}
+	path := flags.Arg(0)
+	if path == "-" && strings.Contains(*sizelist, ",") {
+		return fmt.Errorf("stdin can be replayed for one size only")
+	}
+
+	sizes, err := parsesizes(*sizelist)
+	if err != nil {
+		return err
+	}
+	fill, err := parsefill(*fillmode, *format)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "size\tevents\thits\tmisses\thit ratio\tops/sec\t")
+	for _, size := range sizes {
+		src, closer, err := open(path, *format)
+		if err != nil {
+			return err
+		}
+		res, err := simulate(src, size, fill, *ttl)
+		closer.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%.4f\t%.0f\t\n", res.size, res.events, res.hits, res.misses, res.ratio(), res.throughput())
+	}
+	return w.Flush()
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "prehit-sim:", err)
+		os.Exit(1)
+	}
+}
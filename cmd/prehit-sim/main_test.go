@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit/trace"
+)
+
+// events is a source of prepared events.
+type events []trace.Event
+
+func (e *events) Read() (trace.Event, error) {
+	if len(*e) == 0 {
+		return trace.Event{}, io.EOF
+	}
+	next := (*e)[0]
+	*e = (*e)[1:]
+	return next, nil
+}
+
+func TestSimulate(t *testing.T) {
+	// cyclic access of 3 blocks
+	var src trace.Source = trace.NewLIRSReader(strings.NewReader(strings.Repeat("1\n2\n3\n", 10)))
+	res, err := simulate(src, 3, true, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.events != 30 || res.hits != 27 || res.misses != 3 || res.ratio() != 0.9 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+
+	// without fill nothing is stored
+	src = trace.NewLIRSReader(strings.NewReader(strings.Repeat("1\n2\n3\n", 10)))
+	if res, _ := simulate(src, 3, false, time.Hour); res.hits != 0 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+
+	// values stored expired are not found, Set without TTL uses the default
+	src = &events{
+		{Op: trace.Set, Key: 1, Expired: true},
+		{Op: trace.Set, Key: 2},
+		{Op: trace.Get, Key: 1},
+		{Op: trace.Get, Key: 2},
+	}
+	if res, _ := simulate(src, 3, false, time.Hour); res.hits != 1 || res.misses != 1 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+
+	if (result{}).ratio() != 0 || (result{}).throughput() != 0 {
+		t.Error("Empty result must have zero ratio and throughput")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "trace.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := trace.NewWriter(f)
+	for i := 0; i < 100; i++ {
+		key := uint64(i % 10)
+		w.Write(trace.Event{Time: time.Now(), Op: trace.Get, Key: key})
+		w.Write(trace.Event{Time: time.Now(), Op: trace.Set, Key: key, TTL: time.Hour})
+	}
+	w.Write(trace.Event{Time: time.Now(), Op: trace.Delete, Key: 1})
+	w.Flush()
+	f.Close()
+
+	var out bytes.Buffer
+	if err := run([]string{"-sizes", "5,10", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "0.9000") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"-format", "unknown", path},
+		{"-sizes", "x", path},
+		{"-fill", "maybe", path},
+		{"-sizes", "1,2", "-"},
+		{filepath.Join(dir, "missing")},
+	} {
+		if err := run(args, &out); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
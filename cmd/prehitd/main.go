@@ -0,0 +1,156 @@
+// Command prehitd hosts prehit.Cache[string, []byte] and serves the memcached text
+// protocol subset over TCP and Unix sockets, the Redis protocol and the HTTP API over TCP
+// for services in other languages.
+//
+// Usage:
+//
+//	prehitd [-listen :11211] [-unix /run/prehitd.sock] [-resp :6379] [-http :8080] [-token secret]
+//	        [-size 1000000] [-maxvalue 1048576]
+//
+// An empty -listen disables memcached TCP, the Unix socket is served when -unix is set,
+// the Redis protocol when -resp is set and the HTTP API when -http is set. The bearer token
+// of the HTTP API defaults to the PREHITD_TOKEN environment variable.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.melnyk.org/prehit"
+	"go.melnyk.org/prehit/server"
+)
+
+// listener is a listener of a protocol.
+type listener struct {
+	net.Listener
+	protocol string
+}
+
+// listen opens the TCP and Unix listeners, a stale Unix socket file is removed.
+func listen(address string, unix string, resp string, api string) ([]listener, error) {
+	var listeners []listener
+	open := func(protocol string, network string, address string) error {
+		l, err := net.Listen(network, address)
+		if err != nil {
+			closeall(listeners)
+			return err
+		}
+		listeners = append(listeners, listener{Listener: l, protocol: protocol})
+		return nil
+	}
+
+	if address != "" {
+		if err := open("memcached", "tcp", address); err != nil {
+			return nil, err
+		}
+	}
+
+	if unix != "" {
+		if err := os.Remove(unix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			closeall(listeners)
+			return nil, err
+		}
+		if err := open("memcached", "unix", unix); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp != "" {
+		if err := open("redis", "tcp", resp); err != nil {
+			return nil, err
+		}
+	}
+
+	if api != "" {
+		if err := open("http", "tcp", api); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no listen address")
+	}
+	return listeners, nil
+}
+
+func closeall(listeners []listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// run serves the cache until the context is done or a listener fails.
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	flags := flag.NewFlagSet("prehitd", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	address := flags.String("listen", ":11211", "TCP address of the memcached protocol, empty to disable")
+	unix := flags.String("unix", "", "Unix socket path of the memcached protocol")
+	resp := flags.String("resp", "", "TCP address of the Redis protocol")
+	api := flags.String("http", "", "TCP address of the HTTP API")
+	token := flags.String("token", os.Getenv("PREHITD_TOKEN"), "bearer token of the HTTP API")
+	size := flags.Uint("size", 1000000, "cache max size in items")
+	maxvalue := flags.Int("maxvalue", 1<<20, "max value size in bytes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *size == 0 || *maxvalue <= 0 {
+		return fmt.Errorf("size and maxvalue must be positive")
+	}
+
+	listeners, err := listen(*address, *unix, *resp, *api)
+	if err != nil {
+		return err
+	}
+
+	c := prehit.NewCache[string, []byte](prehit.WithMaxSize(*size), prehit.WithName("prehitd"))
+	defer c.Close()
+	s := server.New(c, server.WithMaxValue(*maxvalue), server.WithToken(*token))
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		fmt.Fprintf(stderr, "prehitd: serving %s protocol on %s %s\n", l.protocol, l.Addr().Network(), l.Addr())
+		serve := s.ServeMemcache
+		switch l.protocol {
+		case "redis":
+			serve = s.ServeRESP
+		case "http":
+			serve = s.ServeREST
+		}
+		go func(l net.Listener) {
+			errs <- serve(l)
+		}(l.Listener)
+	}
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errs:
+	}
+
+	s.Close()
+	if *unix != "" {
+		os.Remove(*unix)
+	}
+	return err
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "prehitd:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "prehitd.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, []string{"-listen", "", "-unix", socket, "-size", "10"}, io.Discard) }()
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("unix", socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("set a 0 0 1\r\na\r\nget a\r\n"))
+	r := bufio.NewReader(conn)
+	var lines []string
+	for len(lines) < 4 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if got := strings.Join(lines, "|"); got != "STORED|VALUE a 0 1|a|END" {
+		t.Errorf("Unexpected response %q", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server is not stopped")
+	}
+}
+
+func TestRunArguments(t *testing.T) {
+	for _, args := range [][]string{
+		{"-size", "0"},
+		{"-listen", ""},
+		{"extra"},
+	} {
+		if err := run(context.Background(), args, io.Discard); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
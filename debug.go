@@ -0,0 +1,296 @@
+package prehit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	debugkeys    = 10   // default number of most and least recently used keys shown by the debug handler
+	debugmaxkeys = 1000 // max number of most and least recently used keys shown by the debug handler
+)
+
+// DebugItem is a description of a cache item returned by the debug handler.
+type DebugItem struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	TTL    string `json:"ttl"` // remaining time to live, negative for expired items
+	Value  string `json:"value,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DebugState is a snapshot of the cache returned by the debug handler.
+type DebugState struct {
+	Size    uint        `json:"size"`
+	MaxSize uint        `json:"maxsize"`
+	Stats   Stats       `json:"stats"`
+	MRU     []DebugItem `json:"mru"` // from the head of the list
+	LRU     []DebugItem `json:"lru"` // from the tail of the list
+}
+
+// Debug options
+type debugoptions struct {
+	admin bool
+	parse any
+}
+
+// DebugOption is an option of the debug handler.
+type DebugOption interface {
+	apply(*debugoptions)
+}
+
+type adminOption bool
+
+func (o adminOption) apply(opts *debugoptions) {
+	opts.admin = bool(o)
+}
+
+// WithAdmin enables admin actions (delete of a key and reset) of the debug handler.
+// They are disabled by default.
+func WithAdmin(enabled bool) DebugOption {
+	return adminOption(enabled)
+}
+
+type keyparserOption struct {
+	parse any
+}
+
+func (o keyparserOption) apply(opts *debugoptions) {
+	opts.parse = o.parse
+}
+
+// WithKeyParser sets the function converting keys from requests to cache keys.
+// By default string keys are used as is, and other keys are parsed by fmt.Sscan.
+func WithKeyParser[K comparable](parse func(string) (K, error)) DebugOption {
+	return keyparserOption{parse: parse}
+}
+
+// debughandler serves the debug endpoints of a cache.
+type debughandler[K comparable, V any] struct {
+	cache *Cache[K, V]
+	admin bool
+	parse func(string) (K, error)
+}
+
+// DebugHandler returns an http.Handler for inspection of the cache without a debugger:
+//
+//	GET  /?n=10          - size, capacity, stats and n (up to 1000) most and least recently used keys
+//	GET  /key?key=k      - a single key, the lookup does not change the order or statistics
+//	POST /delete?key=k   - removes the key (admin)
+//	POST /reset          - clears the cache (admin)
+//
+// Use http.StripPrefix to mount the handler under a path.
+func (c *Cache[K, V]) DebugHandler(o ...DebugOption) http.Handler {
+	local := &debugoptions{}
+	for _, option := range o {
+		option.apply(local)
+	}
+
+	h := &debughandler[K, V]{cache: c, admin: local.admin, parse: parsekey[K]}
+	if local.parse != nil {
+		if parse, ok := local.parse.(func(string) (K, error)); ok {
+			h.parse = parse
+		} else {
+			c.logger.Warning("Key parser does not match the cache key type - it is ignored")
+		}
+	}
+
+	return h
+}
+
+// parsekey is the default key parser.
+func parsekey[K comparable](s string) (K, error) {
+	var key K
+	if p, ok := any(&key).(*string); ok {
+		*p = s
+		return key, nil
+	}
+	_, err := fmt.Sscan(s, &key)
+	return key, err
+}
+
+func (h *debughandler[K, V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/") {
+	case "":
+		h.state(w, r)
+	case "key":
+		h.key(w, r)
+	case "delete":
+		h.delete(w, r)
+	case "reset":
+		h.reset(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *debughandler[K, V]) state(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := debugkeys
+	if s := r.URL.Query().Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return
+		}
+		n = v
+	}
+	if n > debugmaxkeys {
+		n = debugmaxkeys
+	}
+
+	state := DebugState{Stats: h.cache.Stats(), MRU: []DebugItem{}, LRU: []DebugItem{}}
+	var mru, lru []debugsnapshot[K, V]
+
+	c := h.cache
+	c.mutex.RLock()
+	state.Size, state.MaxSize = c.size, c.maxsize
+	for item := c.head; item != nil && len(mru) < n; item = item.next {
+		mru = append(mru, snapshot(item))
+	}
+	for item := c.tail; item != nil && len(lru) < n; item = item.prev {
+		lru = append(lru, snapshot(item))
+	}
+	c.mutex.RUnlock()
+
+	// keys are formatted without the lock, their String methods may be slow
+	now := time.Now()
+	for _, item := range mru {
+		state.MRU = append(state.MRU, item.describe(now, false))
+	}
+	for _, item := range lru {
+		state.LRU = append(state.LRU, item.describe(now, false))
+	}
+
+	writejson(w, state)
+}
+
+func (h *debughandler[K, V]) key(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, ok := h.requestkey(w, r)
+	if !ok {
+		return
+	}
+
+	c := h.cache
+	c.mutex.RLock()
+	item, found := c.index[key]
+	var d debugsnapshot[K, V]
+	if found && item != nil {
+		d = snapshot(item)
+	}
+	c.mutex.RUnlock()
+
+	if !found || item == nil {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+
+	writejson(w, d.describe(time.Now(), true))
+}
+
+func (h *debughandler[K, V]) delete(w http.ResponseWriter, r *http.Request) {
+	if !h.allowed(w, r) {
+		return
+	}
+	key, ok := h.requestkey(w, r)
+	if !ok {
+		return
+	}
+
+	h.cache.logger.Info(fmt.Sprintf("Key %v deleted by the debug handler", key))
+	h.cache.Delete(key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *debughandler[K, V]) reset(w http.ResponseWriter, r *http.Request) {
+	if !h.allowed(w, r) {
+		return
+	}
+
+	h.cache.logger.Info("Cache reset by the debug handler")
+	if err := h.cache.Reset(); err != nil {
+		http.Error(w, "reset failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowed checks an admin action is enabled and requested by POST.
+func (h *debughandler[K, V]) allowed(w http.ResponseWriter, r *http.Request) bool {
+	if !h.admin {
+		http.Error(w, "admin actions are disabled", http.StatusForbidden)
+		return false
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func (h *debughandler[K, V]) requestkey(w http.ResponseWriter, r *http.Request) (K, bool) {
+	query := r.URL.Query()
+	if !query.Has("key") {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return *new(K), false
+	}
+	key, err := h.parse(query.Get("key"))
+	if err != nil {
+		http.Error(w, "invalid key: "+err.Error(), http.StatusBadRequest)
+		return *new(K), false
+	}
+	return key, true
+}
+
+// debugsnapshot is a copy of an item taken under the cache lock and described after it.
+type debugsnapshot[K comparable, V any] struct {
+	key        K
+	value      V
+	status     Status
+	err        error
+	expiration time.Time
+}
+
+// snapshot copies the item, the caller holds the cache lock.
+func snapshot[K comparable, V any](item *cacheItem[K, V]) debugsnapshot[K, V] {
+	return debugsnapshot[K, V]{
+		key:        item.key,
+		value:      item.value,
+		status:     item.status(),
+		err:        item.err(),
+		expiration: item.expiration,
+	}
+}
+
+// describe formats the item, the value is included on request.
+func (s debugsnapshot[K, V]) describe(now time.Time, value bool) DebugItem {
+	d := DebugItem{
+		Key:    fmt.Sprint(s.key),
+		Status: s.status.String(),
+		TTL:    s.expiration.Sub(now).String(),
+	}
+	if value && s.status == Found {
+		d.Value = fmt.Sprint(s.value)
+	}
+	if s.err != nil {
+		d.Error = s.err.Error()
+	}
+	return d
+}
+
+func writejson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,205 @@
+package prehit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func debugrequest(t *testing.T, h http.Handler, method string, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestDebugState(t *testing.T) {
+	c := NewCache[int, string](WithMaxSize(10))
+	for i := 0; i < 5; i++ {
+		c.Set(i, strconv.Itoa(i), time.Hour)
+	}
+	c.SetMissing(5, time.Hour)
+
+	h := c.DebugHandler()
+	w := debugrequest(t, h, http.MethodGet, "/?n=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d", w.Code)
+	}
+
+	var state DebugState
+	if err := json.NewDecoder(w.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Size != 6 || state.MaxSize != 10 || state.Stats.Adds != 6 {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if len(state.MRU) != 2 || state.MRU[0].Key != "5" || state.MRU[0].Status != "missing" || state.MRU[1].Key != "4" {
+		t.Errorf("Unexpected MRU %+v", state.MRU)
+	}
+	if len(state.LRU) != 2 || state.LRU[0].Key != "0" || state.LRU[1].Key != "1" {
+		t.Errorf("Unexpected LRU %+v", state.LRU)
+	}
+	if ttl, err := time.ParseDuration(state.MRU[0].TTL); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Unexpected TTL %s", state.MRU[0].TTL)
+	}
+
+	// n is capped
+	c.Resize(2 * debugmaxkeys)
+	for i := 0; i < 2*debugmaxkeys; i++ {
+		c.Set(i, "", time.Hour)
+	}
+	state = DebugState{}
+	json.NewDecoder(debugrequest(t, h, http.MethodGet, "/?n=1000000").Body).Decode(&state)
+	if len(state.MRU) != debugmaxkeys || len(state.LRU) != debugmaxkeys {
+		t.Errorf("Unexpected %d MRU and %d LRU keys", len(state.MRU), len(state.LRU))
+	}
+
+	if w := debugrequest(t, h, http.MethodGet, "/?n=x"); w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodPost, "/"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodGet, "/unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+}
+
+func TestDebugKey(t *testing.T) {
+	c := NewCache[int, string](WithMaxSize(10), WithErrorTTL(time.Hour))
+	c.Set(1, "one", time.Hour)
+	c.Set(2, "two", time.Hour)
+	c.SetError(3, errors.New("failed"))
+
+	h := c.DebugHandler()
+	w := debugrequest(t, h, http.MethodGet, "/key?key=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d", w.Code)
+	}
+	var item DebugItem
+	json.NewDecoder(w.Body).Decode(&item)
+	if item.Key != "2" || item.Value != "two" || item.Status != "found" {
+		t.Errorf("Unexpected item %+v", item)
+	}
+
+	w = debugrequest(t, h, http.MethodGet, "/key?key=3")
+	item = DebugItem{}
+	json.NewDecoder(w.Body).Decode(&item)
+	if item.Status != "failed" || item.Error != "failed" || item.Value != "" {
+		t.Errorf("Unexpected item %+v", item)
+	}
+
+	// lookups do not change the order and statistics
+	debugrequest(t, h, http.MethodGet, "/key?key=1")
+	if st := c.Stats(); st.Hits != 0 || c.tail.key != 1 {
+		t.Error("Debug lookup must not affect the cache")
+	}
+
+	if w := debugrequest(t, h, http.MethodGet, "/key?key=4"); w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodGet, "/key"); w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodGet, "/key?key=x"); w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+}
+
+// reentrant uses the cache when it is formatted.
+type reentrant struct {
+	cache *Cache[int, reentrant]
+}
+
+func (r reentrant) String() string {
+	r.cache.Set(0, r, time.Hour)
+	return "reentrant"
+}
+
+func TestDebugFormatUnlocked(t *testing.T) {
+	c := NewCache[int, reentrant]()
+	c.Set(1, reentrant{cache: c}, time.Hour)
+
+	// values are formatted after the lock is released
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		debugrequest(t, c.DebugHandler(), http.MethodGet, "/key?key=1")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Value must be formatted without the lock")
+	}
+}
+
+func TestDebugKeyParser(t *testing.T) {
+	type key struct{ a, b string }
+	c := NewCache[key, int]()
+	c.Set(key{"a", "b"}, 1, time.Hour)
+
+	parse := func(s string) (key, error) {
+		if len(s) != 3 {
+			return key{}, errors.New("invalid key")
+		}
+		return key{s[:1], s[2:]}, nil
+	}
+	h := c.DebugHandler(WithKeyParser(parse))
+	if w := debugrequest(t, h, http.MethodGet, "/key?key=a:b"); w.Code != http.StatusOK {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodGet, "/key?key=ab"); w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+
+	// mismatched parser is ignored
+	s := NewCache[string, int]()
+	s.Set("a b", 1, time.Hour)
+	h = s.DebugHandler(WithKeyParser(parse))
+	if w := debugrequest(t, h, http.MethodGet, "/key?key=a+b"); w.Code != http.StatusOK {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+}
+
+func TestDebugAdmin(t *testing.T) {
+	c := NewCache[string, int]()
+	c.Set("a", 1, time.Hour)
+	c.Set("b", 2, time.Hour)
+
+	h := c.DebugHandler()
+	if w := debugrequest(t, h, http.MethodPost, "/delete?key=a"); w.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodPost, "/reset"); w.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+
+	h = c.DebugHandler(WithAdmin(true))
+	if w := debugrequest(t, h, http.MethodGet, "/delete?key=a"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodPost, "/delete?key=a"); w.Code != http.StatusNoContent {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("Key must be deleted")
+	}
+	if w := debugrequest(t, h, http.MethodPost, "/reset"); w.Code != http.StatusNoContent {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if c.size != 0 {
+		t.Error("Cache must be empty")
+	}
+
+	// failed reset is reported
+	c = NewCache[string, int](WithWriteBehind[string, int](&memorystore[string, int]{fail: true}, time.Hour, 100))
+	c.Set("a", 1, time.Hour)
+	h = c.DebugHandler(WithAdmin(true))
+	if w := debugrequest(t, h, http.MethodPost, "/reset"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+}
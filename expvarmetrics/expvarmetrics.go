@@ -0,0 +1,104 @@
+// Package expvarmetrics implements prehit.Metrics publishing counters into an expvar.Map.
+package expvarmetrics
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// Metrics is a prehit.Metrics (and prehit.NegativeMetrics, prehit.WeightedMetrics) implementation
+// backed by expvar integers of a named cache.
+type Metrics struct {
+	hits        *expvar.Int
+	misses      *expvar.Int
+	errors      *expvar.Int
+	adds        *expvar.Int
+	updates     *expvar.Int
+	evictions   *expvar.Int
+	deletes     *expvar.Int
+	missinghits *expvar.Int
+	errorhits   *expvar.Int
+}
+
+func (m *Metrics) Hit()        { m.hits.Add(1) }
+func (m *Metrics) Miss()       { m.misses.Add(1) }
+func (m *Metrics) Error()      { m.errors.Add(1) }
+func (m *Metrics) Add()        { m.adds.Add(1) }
+func (m *Metrics) Update()     { m.updates.Add(1) }
+func (m *Metrics) Evict()      { m.evictions.Add(1) }
+func (m *Metrics) Delete()     { m.deletes.Add(1) }
+func (m *Metrics) MissingHit() { m.missinghits.Add(1) }
+func (m *Metrics) ErrorHit()   { m.errorhits.Add(1) }
+
+func (m *Metrics) HitN(n uint64)        { m.hits.Add(int64(n)) }
+func (m *Metrics) MissN(n uint64)       { m.misses.Add(int64(n)) }
+func (m *Metrics) MissingHitN(n uint64) { m.missinghits.Add(int64(n)) }
+func (m *Metrics) ErrorHitN(n uint64)   { m.errorhits.Add(int64(n)) }
+
+// New creates metrics published into the parent map under the cache name.
+// The counters of the cache are kept in a nested map:
+//
+//	{"users": {"hits": 10, "misses": 2, ..., "items": 8}}
+//
+// New panics if the name is already used in the parent map, as expvar.Publish does.
+func New(parent *expvar.Map, name string) *Metrics {
+	m := &Metrics{
+		hits:        new(expvar.Int),
+		misses:      new(expvar.Int),
+		errors:      new(expvar.Int),
+		adds:        new(expvar.Int),
+		updates:     new(expvar.Int),
+		evictions:   new(expvar.Int),
+		deletes:     new(expvar.Int),
+		missinghits: new(expvar.Int),
+		errorhits:   new(expvar.Int),
+	}
+
+	cache := new(expvar.Map).Init()
+	cache.Set("hits", m.hits)
+	cache.Set("misses", m.misses)
+	cache.Set("errors", m.errors)
+	cache.Set("adds", m.adds)
+	cache.Set("updates", m.updates)
+	cache.Set("evictions", m.evictions)
+	cache.Set("deletes", m.deletes)
+	cache.Set("missing_hits", m.missinghits)
+	cache.Set("error_hits", m.errorhits)
+	cache.Set("items", expvar.Func(func() any {
+		deletes := m.deletes.Value() // load deletes first to never report negative number
+		adds := m.adds.Value()
+		if adds < deletes {
+			return int64(0)
+		}
+		return adds - deletes
+	}))
+	names.Lock()
+	defer names.Unlock()
+	if parent.Get(name) != nil {
+		panic(fmt.Sprintf("expvarmetrics: reuse of cache name %q", name))
+	}
+	parent.Set(name, cache)
+
+	return m
+}
+
+var (
+	names         sync.Mutex // serializes checks and sets of cache names
+	published     *expvar.Map
+	publishedonce sync.Once
+)
+
+// Publish creates metrics published under the cache name in the process-wide "prehit" map
+// served by the expvar handler (/debug/vars). It panics if the name is already published.
+func Publish(name string) *Metrics {
+	publishedonce.Do(func() {
+		if v, ok := expvar.Get("prehit").(*expvar.Map); ok {
+			published = v
+			return
+		}
+		published = expvar.NewMap("prehit")
+	})
+
+	return New(published, name)
+}
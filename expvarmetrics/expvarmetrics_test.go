@@ -0,0 +1,75 @@
+package expvarmetrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+func TestNew(t *testing.T) {
+	parent := new(expvar.Map).Init()
+	c := prehit.NewCache[string, int](prehit.WithMaxSize(1), prehit.WithMetrics(New(parent, "users")))
+
+	c.Set("a", 1, time.Second)
+	c.Set("b", 2, time.Second)
+	c.Get("b")
+	c.Get("a")
+	c.SetMissing("c", time.Second)
+	c.Lookup("c")
+
+	values := map[string]map[string]int64{}
+	if err := json.Unmarshal([]byte(parent.String()), &values); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{
+		"hits":         1,
+		"misses":       1,
+		"errors":       0,
+		"adds":         3,
+		"updates":      0,
+		"evictions":    2,
+		"deletes":      2,
+		"missing_hits": 1,
+		"error_hits":   0,
+		"items":        1,
+	}
+	for name, value := range expected {
+		if values["users"][name] != value {
+			t.Errorf("Unexpected %s value %d", name, values["users"][name])
+		}
+	}
+}
+
+func TestNewDuplicate(t *testing.T) {
+	parent := new(expvar.Map).Init()
+	New(parent, "users")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on a duplicate name")
+		}
+	}()
+	New(parent, "users")
+}
+
+func TestPublish(t *testing.T) {
+	m := Publish("orders")
+	m.Hit()
+
+	if Publish("other") == nil {
+		t.Error("Expected metrics to be created")
+	}
+
+	published, ok := expvar.Get("prehit").(*expvar.Map)
+	if !ok {
+		t.Fatal("Expected prehit map to be published")
+	}
+
+	if published.Get("orders") == nil || published.Get("other") == nil {
+		t.Error("Expected caches to be published")
+	}
+}
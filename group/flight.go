@@ -0,0 +1,53 @@
+package group
+
+import (
+	"context"
+	"sync"
+)
+
+// call is an in-flight load of a key.
+type call struct {
+	wg    sync.WaitGroup
+	ctx   context.Context // context of the caller running the load
+	value any
+	err   error
+}
+
+// flight coalesces concurrent loads of the same key into one.
+type flight struct {
+	mutex sync.Mutex
+	calls map[string]*call
+}
+
+// do runs the load once for concurrent callers of the key and reports whether
+// the result is shared with another caller. The load runs with the context of the first
+// caller, other callers retry if the load is interrupted by that context being done.
+func (f *flight) do(ctx context.Context, key string, load func() (any, error)) (any, error, bool) {
+	for {
+		f.mutex.Lock()
+		if f.calls == nil {
+			f.calls = make(map[string]*call)
+		}
+		if c, found := f.calls[key]; found {
+			f.mutex.Unlock()
+			c.wg.Wait()
+			if c.err != nil && c.ctx.Err() != nil && ctx.Err() == nil {
+				continue // the error belongs to the cancelled caller
+			}
+			return c.value, c.err, true
+		}
+		c := &call{ctx: ctx}
+		c.wg.Add(1)
+		f.calls[key] = c
+		f.mutex.Unlock()
+
+		c.value, c.err = load()
+		c.wg.Done()
+
+		f.mutex.Lock()
+		delete(f.calls, key)
+		f.mutex.Unlock()
+
+		return c.value, c.err, false
+	}
+}
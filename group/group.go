@@ -0,0 +1,293 @@
+// Package group implements a peer-to-peer distributed cache on top of prehit.Cache.
+//
+// Every key is owned by one peer picked by a consistent hash ring. The owner loads the value
+// and keeps it in its main cache, other peers fetch it from the owner and keep a short-lived
+// replica in a small hot cache. Concurrent loads and fetches of a key are coalesced.
+package group
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+// Loader loads the value of an owned key from the source of truth.
+// prehit.ErrNotFound is passed to callers on other peers as is.
+type Loader[V any] func(ctx context.Context, key string) (V, error)
+
+// Peer fetches encoded values of a group from another instance.
+type Peer interface {
+	Fetch(ctx context.Context, group string, key string) ([]byte, error)
+}
+
+// Server serves encoded values of owned keys to other peers, it is implemented by Group.
+type Server interface {
+	Serve(ctx context.Context, key string) ([]byte, error)
+}
+
+// Transport connects groups of different instances.
+type Transport interface {
+	// Peer returns the client of the peer at the address.
+	Peer(address string) Peer
+	// Register makes the group of the instance at the address available to peers.
+	Register(address string, group string, s Server)
+}
+
+// Stats is a snapshot of group counters.
+type Stats struct {
+	Gets       uint64 // number of Get calls
+	MainHits   uint64 // hits of owned keys
+	HotHits    uint64 // hits of replicas of remote keys
+	Loads      uint64 // loads of owned keys (and of remote keys when the owner fails)
+	Fetches    uint64 // fetches from owners
+	PeerErrors uint64 // failed fetches
+	Coalesced  uint64 // loads and fetches shared with concurrent callers
+	Served     uint64 // requests of other peers
+}
+
+// Group is a named set of keys distributed over peers.
+type Group[V any] struct {
+	name      string
+	self      string
+	load      Loader[V]
+	codec     prehit.Codec[V]
+	transport Transport
+	ttl       time.Duration
+	hotttl    time.Duration
+	replicas  int
+
+	main *prehit.Cache[string, V]
+	hot  *prehit.Cache[string, V]
+
+	mutex sync.RWMutex
+	ring  *Ring
+	peers map[string]Peer
+
+	flight flight // loads and fetches of Get
+	served flight // loads for other peers, never joins fetches to avoid waiting on each other
+	stats  struct {
+		gets, mainhits, hothits, loads, fetches, peererrors, coalesced, served atomic.Uint64
+	}
+}
+
+// New creates a group of the instance with the address self and registers it in the transport.
+// Until SetPeers is called all keys are owned by the instance.
+func New[V any](name string, self string, load Loader[V], codec prehit.Codec[V], transport Transport, o ...Option) *Group[V] {
+	local := &options{
+		replicas: defaultreplicas, // default virtual nodes
+		ttl:      time.Hour,       // default TTL of owned keys
+		hotsize:  100,             // default hot cache size
+		hotttl:   time.Minute,     // default TTL of replicas
+	}
+
+	for _, option := range o {
+		option.apply(local)
+	}
+
+	g := &Group[V]{
+		name:      name,
+		self:      self,
+		load:      load,
+		codec:     codec,
+		transport: transport,
+		ttl:       local.ttl,
+		hotttl:    local.hotttl,
+		replicas:  local.replicas,
+		main:      prehit.NewCache[string, V](local.cache...),
+		ring:      NewRing(local.replicas),
+		peers:     make(map[string]Peer),
+	}
+	if local.hotsize > 0 {
+		g.hot = prehit.NewCache[string, V](prehit.WithMaxSize(local.hotsize))
+	}
+
+	transport.Register(self, name, g)
+	return g
+}
+
+// Name returns the name of the group.
+func (g *Group[V]) Name() string {
+	return g.name
+}
+
+// SetPeers replaces the set of peers, the addresses include the instance itself.
+func (g *Group[V]) SetPeers(addresses ...string) {
+	ring := NewRing(g.replicas)
+	ring.Add(addresses...)
+
+	peers := make(map[string]Peer, len(addresses))
+	for _, address := range addresses {
+		if address != g.self {
+			peers[address] = g.transport.Peer(address)
+		}
+	}
+
+	g.mutex.Lock()
+	g.ring = ring
+	g.peers = peers
+	g.mutex.Unlock()
+}
+
+// Owner returns the address of the peer owning the key.
+func (g *Group[V]) Owner(key string) string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	if owner := g.ring.Get(key); owner != "" {
+		return owner
+	}
+	return g.self
+}
+
+// owner returns the peer owning the key, nil for the instance itself.
+func (g *Group[V]) owner(key string) Peer {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	return g.peers[g.ring.Get(key)]
+}
+
+// Get returns the value of the key from the local caches, from the owner or from the loader.
+func (g *Group[V]) Get(ctx context.Context, key string) (V, error) {
+	g.stats.gets.Add(1)
+
+	if v, ok := g.main.Get(key); ok {
+		g.stats.mainhits.Add(1)
+		return v, nil
+	}
+	if g.hot != nil {
+		if v, ok := g.hot.Get(key); ok {
+			g.stats.hothits.Add(1)
+			return v, nil
+		}
+	}
+
+	v, err, shared := g.flight.do(ctx, key, func() (any, error) {
+		peer := g.owner(key)
+		if peer == nil {
+			return g.loadlocal(ctx, key)
+		}
+
+		v, err := g.fetch(ctx, peer, key)
+		if err == nil || errors.Is(err, prehit.ErrNotFound) {
+			return v, err
+		}
+
+		// the owner is unavailable, the value is loaded here and kept as a replica, not as owned
+		g.stats.peererrors.Add(1)
+		return g.loadreplica(ctx, key)
+	})
+	if shared {
+		g.stats.coalesced.Add(1)
+	}
+	if err != nil {
+		return *new(V), err
+	}
+	value, _ := v.(V) // nil interface values are returned as zero values
+	return value, nil
+}
+
+// loadlocal loads an owned key and keeps it in the main cache.
+func (g *Group[V]) loadlocal(ctx context.Context, key string) (any, error) {
+	if v, ok := g.main.Get(key); ok { // loaded by a concurrent flight
+		return v, nil
+	}
+	g.stats.loads.Add(1)
+	v, err := g.load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	g.main.Set(key, v, g.ttl)
+	return v, nil
+}
+
+// loadreplica loads a key of the failed owner and keeps it in the hot cache for the TTL of replicas,
+// so callers do not hit the loader until the owner is back.
+func (g *Group[V]) loadreplica(ctx context.Context, key string) (any, error) {
+	g.stats.loads.Add(1)
+	v, err := g.load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if g.hot != nil {
+		g.hot.Set(key, v, g.hotttl)
+	}
+	return v, nil
+}
+
+// fetch gets the value from the owner and keeps the replica in the hot cache.
+func (g *Group[V]) fetch(ctx context.Context, peer Peer, key string) (any, error) {
+	g.stats.fetches.Add(1)
+	data, err := peer.Fetch(ctx, g.name, key)
+	if err != nil {
+		return nil, err
+	}
+	v, err := g.codec.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if g.hot != nil {
+		g.hot.Set(key, v, g.hotttl)
+	}
+	return v, nil
+}
+
+// Serve returns the encoded value of the key for another peer.
+// The key is loaded here even if the ring of this instance disagrees during membership changes.
+func (g *Group[V]) Serve(ctx context.Context, key string) ([]byte, error) {
+	g.stats.served.Add(1)
+
+	v, ok := g.main.Get(key)
+	if !ok {
+		loaded, err, shared := g.served.do(ctx, key, func() (any, error) {
+			return g.loadlocal(ctx, key)
+		})
+		if shared {
+			g.stats.coalesced.Add(1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		v, _ = loaded.(V)
+	}
+	return g.codec.Encode(v)
+}
+
+// Remove removes the key from local caches, replicas on other peers expire by their TTL.
+func (g *Group[V]) Remove(key string) {
+	g.main.Delete(key)
+	if g.hot != nil {
+		g.hot.Delete(key)
+	}
+}
+
+// Main returns the cache of owned keys.
+func (g *Group[V]) Main() *prehit.Cache[string, V] {
+	return g.main
+}
+
+// Stats returns the counters of the group.
+func (g *Group[V]) Stats() Stats {
+	return Stats{
+		Gets:       g.stats.gets.Load(),
+		MainHits:   g.stats.mainhits.Load(),
+		HotHits:    g.stats.hothits.Load(),
+		Loads:      g.stats.loads.Load(),
+		Fetches:    g.stats.fetches.Load(),
+		PeerErrors: g.stats.peererrors.Load(),
+		Coalesced:  g.stats.coalesced.Load(),
+		Served:     g.stats.served.Load(),
+	}
+}
+
+// Close closes the caches of the group.
+func (g *Group[V]) Close() error {
+	if g.hot != nil {
+		g.hot.Close()
+	}
+	return g.main.Close()
+}
@@ -0,0 +1,306 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+// source is a loader counting loads.
+type source struct {
+	loads atomic.Int64
+	delay time.Duration
+}
+
+func (s *source) load(ctx context.Context, key string) (string, error) {
+	s.loads.Add(1)
+	time.Sleep(s.delay)
+	if key == "missing" {
+		return "", prehit.ErrNotFound
+	}
+	if key == "broken" {
+		return "", errors.New("source is down")
+	}
+	return "value of " + key, nil
+}
+
+// cluster creates groups of the addresses connected by the transport.
+func cluster(t *testing.T, transport Transport, addresses []string, src *source, o ...Option) []*Group[string] {
+	groups := make([]*Group[string], len(addresses))
+	for i, address := range addresses {
+		g := New[string]("test", address, src.load, prehit.JSONCodec[string]{}, transport, o...)
+		t.Cleanup(func() { g.Close() })
+		groups[i] = g
+	}
+	for _, g := range groups {
+		g.SetPeers(addresses...)
+	}
+	return groups
+}
+
+// keyof returns a key owned by the address.
+func keyof(g *Group[string], address string) string {
+	for i := 0; ; i++ {
+		if key := strconv.Itoa(i); g.Owner(key) == address {
+			return key
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	ctx := context.Background()
+	src := &source{}
+	groups := cluster(t, NewLocalTransport(), []string{"a", "b"}, src)
+	a, b := groups[0], groups[1]
+
+	key := keyof(a, "b")
+	if v, err := a.Get(ctx, key); err != nil || v != "value of "+key {
+		t.Fatalf("Unexpected value %q %v", v, err)
+	}
+
+	// the owner keeps the value, the other peer keeps a replica
+	if _, ok := b.Main().Get(key); !ok {
+		t.Error("Owner must keep the value")
+	}
+	if _, ok := a.Main().Get(key); ok {
+		t.Error("Remote key must not be kept as owned")
+	}
+	a.Get(ctx, key)
+	b.Get(ctx, key)
+	if src.loads.Load() != 1 {
+		t.Errorf("Expected one load, got %d", src.loads.Load())
+	}
+	if st := a.Stats(); st.Fetches != 1 || st.HotHits != 1 || st.Gets != 2 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+	if st := b.Stats(); st.Served != 1 || st.MainHits != 1 || st.Loads != 1 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+
+	// errors of the owner
+	if _, err := a.Get(ctx, "missing"); !errors.Is(err, prehit.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := a.Get(ctx, "broken"); err == nil {
+		t.Error("Expected load error")
+	}
+
+	a.Remove(key)
+	if _, ok := a.hot.Get(key); ok {
+		t.Error("Replica must be removed")
+	}
+}
+
+func TestGroupSingleOwner(t *testing.T) {
+	src := &source{}
+	g := New[string]("test", "self", src.load, prehit.JSONCodec[string]{}, NewLocalTransport(), WithHotCache(0, 0))
+	defer g.Close()
+
+	// without peers all keys are owned
+	if g.Owner("key") != "self" {
+		t.Error("Instance must own all keys")
+	}
+	if v, err := g.Get(context.Background(), "key"); err != nil || v != "value of key" {
+		t.Errorf("Unexpected value %q %v", v, err)
+	}
+	if g.Name() != "test" {
+		t.Error("Unexpected name")
+	}
+}
+
+func TestGroupCoalescing(t *testing.T) {
+	ctx := context.Background()
+	src := &source{delay: 50 * time.Millisecond}
+	groups := cluster(t, NewLocalTransport(), []string{"a", "b"}, src)
+	a := groups[0]
+
+	for _, owner := range []string{"a", "b"} {
+		key := keyof(a, owner)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := a.Get(ctx, key); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	if src.loads.Load() != 2 {
+		t.Errorf("Expected two loads, got %d", src.loads.Load())
+	}
+	if st := a.Stats(); st.Coalesced == 0 || st.Fetches != 1 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
+
+// slowtransport delays fetches so concurrent flights overlap.
+type slowtransport struct {
+	*LocalTransport
+	delay time.Duration
+}
+
+func (t slowtransport) Peer(address string) Peer {
+	return slowpeer{Peer: t.LocalTransport.Peer(address), delay: t.delay}
+}
+
+type slowpeer struct {
+	Peer
+	delay time.Duration
+}
+
+func (p slowpeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	time.Sleep(p.delay)
+	return p.Peer.Fetch(ctx, group, key)
+}
+
+func TestGroupDisagreeingRings(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	src := &source{}
+	groups := cluster(t, slowtransport{LocalTransport: NewLocalTransport(), delay: 50 * time.Millisecond}, []string{"a", "b"}, src)
+	a, b := groups[0], groups[1]
+
+	// during a membership change each instance considers the other one the owner
+	a.SetPeers("b")
+	b.SetPeers("a")
+
+	var wg sync.WaitGroup
+	for _, g := range []*Group[string]{a, b} {
+		wg.Add(1)
+		go func(g *Group[string]) {
+			defer wg.Done()
+			if v, err := g.Get(ctx, "key"); err != nil || v != "value of key" {
+				t.Errorf("Unexpected value %q %v", v, err)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestFlightCancelledLeader(t *testing.T) {
+	var f flight
+	leader, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+
+	go f.do(leader, "key", func() (any, error) {
+		close(started)
+		<-leader.Done()
+		return nil, leader.Err()
+	})
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, err, _ := f.do(context.Background(), "key", func() (any, error) { return "value", nil })
+		if err != nil || v != "value" {
+			t.Errorf("Unexpected value %v %v", v, err)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestGroupNilInterface(t *testing.T) {
+	load := func(context.Context, string) (any, error) { return nil, nil }
+	g := New[any]("test", "self", load, prehit.JSONCodec[any]{}, NewLocalTransport())
+	defer g.Close()
+
+	if v, err := g.Get(context.Background(), "key"); err != nil || v != nil {
+		t.Errorf("Unexpected value %v %v", v, err)
+	}
+	if _, err := g.Serve(context.Background(), "other"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGroupPeerFailure(t *testing.T) {
+	ctx := context.Background()
+	src := &source{}
+	transport := NewLocalTransport()
+	groups := cluster(t, transport, []string{"a", "b"}, src)
+	a := groups[0]
+
+	transport.Unregister("b")
+	key := keyof(a, "b")
+	if v, err := a.Get(ctx, key); err != nil || v != "value of "+key {
+		t.Fatalf("Unexpected value %q %v", v, err)
+	}
+	if st := a.Stats(); st.PeerErrors != 1 || st.Loads != 1 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+	if _, ok := a.Main().Get(key); ok {
+		t.Error("Key of the failed owner must not be kept as owned")
+	}
+
+	// the fallback value is kept as a replica
+	if v, err := a.Get(ctx, key); err != nil || v != "value of "+key {
+		t.Fatalf("Unexpected value %q %v", v, err)
+	}
+	if st := a.Stats(); st.Loads != 1 || st.HotHits != 1 || src.loads.Load() != 1 {
+		t.Errorf("Fallback value must be cached, stats %+v", st)
+	}
+}
+
+func TestHTTPTransport(t *testing.T) {
+	ctx := context.Background()
+	src := &source{}
+
+	ta, tb := NewHTTPTransport(nil, ""), NewHTTPTransport(nil, "")
+	sa, sb := httptest.NewServer(ta), httptest.NewServer(tb)
+	defer sa.Close()
+	defer sb.Close()
+
+	a := New[string]("test group", sa.URL, src.load, prehit.JSONCodec[string]{}, ta)
+	b := New[string]("test group", sb.URL, src.load, prehit.JSONCodec[string]{}, tb)
+	defer a.Close()
+	defer b.Close()
+	a.SetPeers(sa.URL, sb.URL)
+	b.SetPeers(sa.URL, sb.URL)
+
+	key := keyof(a, sb.URL) + "/with spaces"
+	for a.Owner(key) != sb.URL {
+		key += "x"
+	}
+	if v, err := a.Get(ctx, key); err != nil || v != "value of "+key {
+		t.Fatalf("Unexpected value %q %v", v, err)
+	}
+	if st := b.Stats(); st.Served != 1 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+
+	peer := ta.Peer(sb.URL)
+	if _, err := peer.Fetch(ctx, "test group", "missing"); !errors.Is(err, prehit.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := peer.Fetch(ctx, "test group", "broken"); err == nil || errors.Is(err, prehit.ErrNotFound) {
+		t.Errorf("Expected load error, got %v", err)
+	}
+	if _, err := peer.Fetch(ctx, "unknown", "key"); err == nil || errors.Is(err, prehit.ErrNotFound) {
+		t.Errorf("Expected unknown group error, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	tb.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultBasePath+"nokey", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	tb.ServeHTTP(w, httptest.NewRequest(http.MethodPost, DefaultBasePath+"test/key", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+}
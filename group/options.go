@@ -0,0 +1,72 @@
+package group
+
+import (
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+// Options
+type options struct {
+	replicas int
+	ttl      time.Duration
+	hotsize  uint
+	hotttl   time.Duration
+	cache    []prehit.Option
+}
+
+// Option is a set of options for the group.
+type Option interface {
+	apply(*options)
+}
+
+type replicasOption int
+
+func (o replicasOption) apply(opts *options) {
+	opts.replicas = int(o)
+}
+
+// WithReplicas sets the number of virtual nodes of every peer on the hash ring.
+func WithReplicas(replicas int) Option {
+	return replicasOption(replicas)
+}
+
+type ttlOption time.Duration
+
+func (o ttlOption) apply(opts *options) {
+	opts.ttl = time.Duration(o)
+}
+
+// WithTTL sets the TTL of loaded values of owned keys.
+func WithTTL(ttl time.Duration) Option {
+	return ttlOption(ttl)
+}
+
+type hotcacheOption struct {
+	size uint
+	ttl  time.Duration
+}
+
+func (o hotcacheOption) apply(opts *options) {
+	opts.hotsize = o.size
+	opts.hotttl = o.ttl
+}
+
+// WithHotCache sets the size and the TTL of replicas of remote keys.
+// The TTL bounds the staleness of replicas, zero size disables them.
+func WithHotCache(size uint, ttl time.Duration) Option {
+	return hotcacheOption{size: size, ttl: ttl}
+}
+
+type cacheOption struct {
+	options []prehit.Option
+}
+
+func (o cacheOption) apply(opts *options) {
+	opts.cache = append(opts.cache, o.options...)
+}
+
+// WithCacheOptions sets options of the cache of owned keys (size, metrics, logger).
+func WithCacheOptions(o ...prehit.Option) Option {
+	return cacheOption{options: o}
+}
@@ -0,0 +1,66 @@
+package group
+
+import (
+	"sort"
+	"strconv"
+
+	"go.melnyk.org/prehit/internal/hashing"
+)
+
+// defaultreplicas is the default number of virtual nodes of a peer on the ring.
+const defaultreplicas = 50
+
+// hash returns a well spread 64-bit hash of the string.
+// FNV alone clusters similar short strings on the ring, the hash is mixed.
+func hash(s string) uint64 {
+	return hashing.Mix64(hashing.FNV64a(s))
+}
+
+// Ring is a consistent hash ring of peers with virtual nodes.
+// Adding or removing a peer moves only the keys of that peer. Ring is not safe for
+// concurrent use, Group replaces its ring as a whole.
+type Ring struct {
+	replicas int
+	hashes   []uint64
+	owners   map[uint64]string
+}
+
+// NewRing creates an empty ring with the number of virtual nodes per peer.
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = defaultreplicas
+	}
+	return &Ring{replicas: replicas, owners: make(map[uint64]string)}
+}
+
+// Add places peers on the ring.
+func (r *Ring) Add(peers ...string) {
+	for _, peer := range peers {
+		for i := 0; i < r.replicas; i++ {
+			h := hash(strconv.Itoa(i) + "-" + peer)
+			if _, found := r.owners[h]; !found {
+				r.hashes = append(r.hashes, h)
+			}
+			r.owners[h] = peer
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Get returns the owner of the key, it is empty for an empty ring.
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// Len returns the number of virtual nodes.
+func (r *Ring) Len() int {
+	return len(r.hashes)
+}
@@ -0,0 +1,48 @@
+package group
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(0)
+	if r.Get("key") != "" {
+		t.Error("Empty ring must not have owners")
+	}
+
+	r.Add("a", "b", "c")
+	if r.Len() != 3*defaultreplicas {
+		t.Errorf("Unexpected number of virtual nodes %d", r.Len())
+	}
+
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		owner := r.Get(key)
+		counts[owner]++
+		owners[key] = owner
+	}
+	for _, peer := range []string{"a", "b", "c"} {
+		if counts[peer] < 2000 || counts[peer] > 4700 {
+			t.Errorf("Unbalanced ring %v", counts)
+			break
+		}
+	}
+
+	// only keys of the new peer move
+	r.Add("d")
+	moved := 0
+	for key, owner := range owners {
+		if now := r.Get(key); now != owner {
+			if now != "d" {
+				t.Fatalf("Key %s moved from %s to %s", key, owner, now)
+			}
+			moved++
+		}
+	}
+	if moved < 1500 || moved > 3500 {
+		t.Errorf("Unexpected number of moved keys %d", moved)
+	}
+}
@@ -0,0 +1,189 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"go.melnyk.org/prehit"
+)
+
+const (
+	// DefaultBasePath is the path prefix of group requests served by HTTPTransport.
+	DefaultBasePath = "/_prehit/"
+
+	maxvalue = 64 << 20 // max size of a fetched value
+)
+
+// ErrUnknownGroup is returned for groups not registered at the peer.
+var ErrUnknownGroup = errors.New("unknown group")
+
+// HTTPTransport connects peers over HTTP. It is an http.Handler serving
+// GET {base path}{group}/{key} requests of other peers.
+type HTTPTransport struct {
+	client   *http.Client
+	basepath string
+
+	mutex  sync.RWMutex
+	groups map[string]Server
+}
+
+// NewHTTPTransport creates an HTTP transport using the client, nil means http.DefaultClient.
+// The base path is DefaultBasePath when empty.
+func NewHTTPTransport(client *http.Client, basepath string) *HTTPTransport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if basepath == "" {
+		basepath = DefaultBasePath
+	}
+	return &HTTPTransport{client: client, basepath: basepath, groups: make(map[string]Server)}
+}
+
+// Register makes the group available to peers, the address is served by the caller.
+func (t *HTTPTransport) Register(address string, group string, s Server) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.groups[group] = s
+}
+
+// Peer returns the client of the peer with the base URL, for example "http://10.0.0.1:8080".
+func (t *HTTPTransport) Peer(address string) Peer {
+	return &httppeer{client: t.client, base: strings.TrimSuffix(address, "/") + t.basepath}
+}
+
+func (t *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.EscapedPath(), t.basepath)
+	escapedgroup, escapedkey, found := strings.Cut(path, "/")
+	group, err1 := url.PathUnescape(escapedgroup)
+	key, err2 := url.PathUnescape(escapedkey)
+	if !found || err1 != nil || err2 != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	t.mutex.RLock()
+	s, found := t.groups[group]
+	t.mutex.RUnlock()
+	if !found {
+		http.Error(w, ErrUnknownGroup.Error(), http.StatusNotFound)
+		return
+	}
+
+	data, err := s.Serve(r.Context(), key)
+	if errors.Is(err, prehit.ErrNotFound) {
+		w.Header().Set("X-Prehit-Not-Found", "1")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// httppeer fetches values from a peer over HTTP.
+type httppeer struct {
+	client *http.Client
+	base   string
+}
+
+func (p *httppeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	u := p.base + url.PathEscape(group) + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && resp.Header.Get("X-Prehit-Not-Found") != "" {
+		io.Copy(io.Discard, resp.Body)
+		return nil, prehit.ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("peer %s: %s: %s", p.base, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxvalue+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxvalue {
+		return nil, fmt.Errorf("peer %s: value is too large", p.base)
+	}
+	return data, nil
+}
+
+// LocalTransport connects groups of instances in the same process, mostly for tests.
+type LocalTransport struct {
+	mutex sync.RWMutex
+	nodes map[string]map[string]Server // address -> group -> server
+}
+
+// NewLocalTransport creates an in-process transport.
+func NewLocalTransport() *LocalTransport {
+	return &LocalTransport{nodes: make(map[string]map[string]Server)}
+}
+
+// Register makes the group of the instance at the address available to peers.
+func (t *LocalTransport) Register(address string, group string, s Server) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.nodes[address] == nil {
+		t.nodes[address] = make(map[string]Server)
+	}
+	t.nodes[address][group] = s
+}
+
+// Unregister removes the instance at the address, its peers get errors as from a failed peer.
+func (t *LocalTransport) Unregister(address string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.nodes, address)
+}
+
+// Peer returns the client of the instance at the address.
+func (t *LocalTransport) Peer(address string) Peer {
+	return &localpeer{transport: t, address: address}
+}
+
+type localpeer struct {
+	transport *LocalTransport
+	address   string
+}
+
+func (p *localpeer) Fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	p.transport.mutex.RLock()
+	s, found := p.transport.nodes[p.address][group]
+	p.transport.mutex.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("peer %s: %w", p.address, ErrUnknownGroup)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.Serve(ctx, key)
+}
@@ -0,0 +1,40 @@
+package prehit
+
+import (
+	"fmt"
+
+	"go.melnyk.org/prehit/internal/hashing"
+)
+
+// hashkey returns a stable 64-bit hash of the key.
+// Strings and integers are hashed directly, other keys are hashed by their fmt representation.
+func hashkey[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return hashing.FNV64a(k)
+	case int:
+		return hashing.Mix64(uint64(k))
+	case int8:
+		return hashing.Mix64(uint64(k))
+	case int16:
+		return hashing.Mix64(uint64(k))
+	case int32:
+		return hashing.Mix64(uint64(k))
+	case int64:
+		return hashing.Mix64(uint64(k))
+	case uint:
+		return hashing.Mix64(uint64(k))
+	case uint8:
+		return hashing.Mix64(uint64(k))
+	case uint16:
+		return hashing.Mix64(uint64(k))
+	case uint32:
+		return hashing.Mix64(uint64(k))
+	case uint64:
+		return hashing.Mix64(k)
+	case uintptr:
+		return hashing.Mix64(uint64(k))
+	default:
+		return hashing.FNV64a(fmt.Sprint(key))
+	}
+}
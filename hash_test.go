@@ -0,0 +1,37 @@
+package prehit
+
+import (
+	"testing"
+
+	"go.melnyk.org/prehit/internal/hashing"
+)
+
+func TestHashKey(t *testing.T) {
+	type pair struct {
+		a int
+		b string
+	}
+
+	if hashkey("a") != hashing.FNV64a("a") {
+		t.Error("String key hash failed")
+	}
+
+	if hashkey(1) != hashkey(int64(1)) || hashkey(1) == hashkey(2) {
+		t.Error("Integer key hash failed")
+	}
+
+	if hashkey(pair{1, "a"}) != hashkey(pair{1, "a"}) || hashkey(pair{1, "a"}) == hashkey(pair{2, "a"}) {
+		t.Error("Struct key hash failed")
+	}
+
+	// sequential integers are spread over the space
+	low := 0
+	for i := 0; i < 1000; i++ {
+		if hashkey(i)>>63 == 0 {
+			low++
+		}
+	}
+	if low < 400 || low > 600 {
+		t.Error("Integer key hash is not uniform")
+	}
+}
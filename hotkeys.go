@@ -0,0 +1,144 @@
+package prehit
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// KeyCount is a key with the estimated number of its occurrences.
+// The real number is between Count-Error and Count.
+type KeyCount[K comparable] struct {
+	Key   K
+	Count uint64
+	Error uint64
+}
+
+// HotKeys is a report of the keys dominating the cache traffic.
+type HotKeys[K comparable] struct {
+	Hits   []KeyCount[K] // keys found by lookups (including negative entries)
+	Misses []KeyCount[K] // keys not found by lookups
+	Writes []KeyCount[K] // keys stored by Set and friends
+}
+
+// spacesaving is a heavy hitters tracker with bounded memory (Space-Saving algorithm).
+// The counters are kept in a min-heap, so the least frequent key is replaced by a new one.
+type spacesaving[K comparable] struct {
+	mutex    sync.Mutex
+	capacity int
+	index    map[K]int
+	counters []KeyCount[K]
+}
+
+func newspacesaving[K comparable](capacity int) *spacesaving[K] {
+	return &spacesaving[K]{
+		capacity: capacity,
+		index:    make(map[K]int, capacity),
+		counters: make([]KeyCount[K], 0, capacity),
+	}
+}
+
+// heap.Interface - not thread safe, used under the mutex only
+func (s *spacesaving[K]) Len() int           { return len(s.counters) }
+func (s *spacesaving[K]) Less(i, j int) bool { return s.counters[i].Count < s.counters[j].Count }
+func (s *spacesaving[K]) Swap(i, j int) {
+	s.counters[i], s.counters[j] = s.counters[j], s.counters[i]
+	s.index[s.counters[i].Key] = i
+	s.index[s.counters[j].Key] = j
+}
+func (s *spacesaving[K]) Push(x any) {
+	kc := x.(KeyCount[K])
+	s.index[kc.Key] = len(s.counters)
+	s.counters = append(s.counters, kc)
+}
+func (s *spacesaving[K]) Pop() any {
+	kc := s.counters[len(s.counters)-1]
+	s.counters = s.counters[:len(s.counters)-1]
+	delete(s.index, kc.Key)
+	return kc
+}
+
+// add counts an occurrence of the key.
+func (s *spacesaving[K]) add(key K) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if i, found := s.index[key]; found {
+		s.counters[i].Count++
+		heap.Fix(s, i)
+		return
+	}
+
+	if len(s.counters) < s.capacity {
+		heap.Push(s, KeyCount[K]{Key: key, Count: 1})
+		return
+	}
+
+	// replace the least frequent key, the new key inherits its count as the error
+	min := s.counters[0]
+	delete(s.index, min.Key)
+	s.counters[0] = KeyCount[K]{Key: key, Count: min.Count + 1, Error: min.Count}
+	s.index[key] = 0
+	heap.Fix(s, 0)
+}
+
+// top returns up to k most frequent keys sorted by count.
+func (s *spacesaving[K]) top(k int) []KeyCount[K] {
+	s.mutex.Lock()
+	list := make([]KeyCount[K], len(s.counters))
+	copy(list, s.counters)
+	s.mutex.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+	if k >= 0 && k < len(list) {
+		list = list[:k]
+	}
+	return list
+}
+
+// reset forgets all counters.
+func (s *spacesaving[K]) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.index = make(map[K]int, s.capacity)
+	s.counters = s.counters[:0]
+}
+
+// hotkeys tracks heavy hitters of the cache traffic.
+type hotkeys[K comparable] struct {
+	hits   *spacesaving[K]
+	misses *spacesaving[K]
+	writes *spacesaving[K]
+}
+
+func newhotkeys[K comparable](capacity int) *hotkeys[K] {
+	return &hotkeys[K]{
+		hits:   newspacesaving[K](capacity),
+		misses: newspacesaving[K](capacity),
+		writes: newspacesaving[K](capacity),
+	}
+}
+
+// HotKeys returns up to k keys with the most hits, misses and writes.
+// It returns empty lists unless the cache was created with WithHotKeys.
+func (c *Cache[K, V]) HotKeys(k int) HotKeys[K] {
+	if c.hotkeys == nil {
+		return HotKeys[K]{}
+	}
+
+	return HotKeys[K]{
+		Hits:   c.hotkeys.hits.top(k),
+		Misses: c.hotkeys.misses.top(k),
+		Writes: c.hotkeys.writes.top(k),
+	}
+}
+
+// ResetHotKeys forgets the collected hot keys, for example to start a new observation window.
+func (c *Cache[K, V]) ResetHotKeys() {
+	if c.hotkeys != nil {
+		c.hotkeys.hits.reset()
+		c.hotkeys.misses.reset()
+		c.hotkeys.writes.reset()
+	}
+}
@@ -0,0 +1,91 @@
+package prehit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	// keys with more than N/capacity occurrences are guaranteed to be tracked
+	s := newspacesaving[string](10)
+
+	// skewed stream with noise
+	for i := 0; i < 100; i++ {
+		s.add("hot")
+		if i%2 == 0 {
+			s.add("warm")
+		}
+		s.add(fmt.Sprint("noise", i))
+	}
+
+	top := s.top(2)
+	if len(top) != 2 || top[0].Key != "hot" || top[1].Key != "warm" {
+		t.Fatalf("Unexpected top keys %v", top)
+	}
+
+	if top[0].Count-top[0].Error > 100 || top[0].Count < 100 {
+		t.Errorf("Unexpected count bounds %v", top[0])
+	}
+
+	if len(s.top(100)) != 10 || len(s.index) != 10 {
+		t.Error("Tracker must be bounded by capacity")
+	}
+
+	for key, i := range s.index {
+		if s.counters[i].Key != key {
+			t.Error("Tracker index is inconsistent")
+		}
+	}
+
+	s.reset()
+	if len(s.top(10)) != 0 {
+		t.Error("Tracker reset failed")
+	}
+}
+
+func TestCacheHotKeys(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20), WithHotKeys(10))
+
+	c.Set("a", 1, time.Second)
+	c.Set("a", 1, time.Second)
+	c.Set("b", 2, time.Second)
+	c.SetMissing("m", time.Second)
+	for i := 0; i < 5; i++ {
+		c.Get("a")
+		c.Get("unknown")
+	}
+	c.Get("b")
+	c.Lookup("m")
+	c.Get("unknown2")
+
+	hot := c.HotKeys(1)
+	if len(hot.Hits) != 1 || hot.Hits[0].Key != "a" || hot.Hits[0].Count != 5 {
+		t.Errorf("Unexpected hits %v", hot.Hits)
+	}
+
+	if len(hot.Misses) != 1 || hot.Misses[0].Key != "unknown" || hot.Misses[0].Count != 5 {
+		t.Errorf("Unexpected misses %v", hot.Misses)
+	}
+
+	if len(hot.Writes) != 1 || hot.Writes[0].Key != "a" || hot.Writes[0].Count != 2 {
+		t.Errorf("Unexpected writes %v", hot.Writes)
+	}
+
+	if hot := c.HotKeys(-1); len(hot.Hits) != 3 || len(hot.Misses) != 2 || len(hot.Writes) != 3 {
+		t.Errorf("Unexpected full report %v", hot)
+	}
+
+	c.ResetHotKeys()
+	if hot := c.HotKeys(10); len(hot.Hits) != 0 || len(hot.Misses) != 0 || len(hot.Writes) != 0 {
+		t.Error("Hot keys reset failed")
+	}
+
+	// disabled tracking
+	c = NewCache[string, int]()
+	c.Get("a")
+	c.ResetHotKeys()
+	if hot := c.HotKeys(10); hot.Hits != nil || hot.Misses != nil || hot.Writes != nil {
+		t.Error("Hot keys must be empty without tracking")
+	}
+}
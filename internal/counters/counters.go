@@ -0,0 +1,43 @@
+// Package counters provides atomic counters shared by the metrics exporters.
+package counters
+
+import "sync/atomic"
+
+// Counters implements prehit.Metrics, prehit.NegativeMetrics and prehit.WeightedMetrics
+// with atomic counters.
+type Counters struct {
+	Hits        atomic.Uint64
+	Misses      atomic.Uint64
+	Errors      atomic.Uint64
+	Adds        atomic.Uint64
+	Updates     atomic.Uint64
+	Evictions   atomic.Uint64
+	Deletes     atomic.Uint64
+	MissingHits atomic.Uint64
+	ErrorHits   atomic.Uint64
+}
+
+func (c *Counters) Hit()        { c.Hits.Add(1) }
+func (c *Counters) Miss()       { c.Misses.Add(1) }
+func (c *Counters) Error()      { c.Errors.Add(1) }
+func (c *Counters) Add()        { c.Adds.Add(1) }
+func (c *Counters) Update()     { c.Updates.Add(1) }
+func (c *Counters) Evict()      { c.Evictions.Add(1) }
+func (c *Counters) Delete()     { c.Deletes.Add(1) }
+func (c *Counters) MissingHit() { c.MissingHits.Add(1) }
+func (c *Counters) ErrorHit()   { c.ErrorHits.Add(1) }
+
+func (c *Counters) HitN(n uint64)        { c.Hits.Add(n) }
+func (c *Counters) MissN(n uint64)       { c.Misses.Add(n) }
+func (c *Counters) MissingHitN(n uint64) { c.MissingHits.Add(n) }
+func (c *Counters) ErrorHitN(n uint64)   { c.ErrorHits.Add(n) }
+
+// Items returns the number of items in the cache (adds minus deletes).
+func (c *Counters) Items() uint64 {
+	deletes := c.Deletes.Load() // load deletes first to never report negative number
+	adds := c.Adds.Load()
+	if adds < deletes {
+		return 0
+	}
+	return adds - deletes
+}
@@ -0,0 +1,28 @@
+// Package hashing provides the hashes shared by the cache, the trace readers and the group ring.
+package hashing
+
+const (
+	fnvoffset64 = 14695981039346656037
+	fnvprime64  = 1099511628211
+)
+
+// FNV64a returns the FNV-1a hash of the string.
+// It is inlined here to avoid allocations of hash/fnv on the hot path.
+func FNV64a(s string) uint64 {
+	h := uint64(fnvoffset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvprime64
+	}
+	return h
+}
+
+// Mix64 is the finalizer of SplitMix64, it spreads integer keys and clustered hashes uniformly.
+func Mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
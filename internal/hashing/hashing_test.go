@@ -0,0 +1,17 @@
+package hashing
+
+import "testing"
+
+func TestFNV64a(t *testing.T) {
+	// reference values of FNV-1a 64
+	if FNV64a("") != 0xcbf29ce484222325 || FNV64a("a") != 0xaf63dc4c8601ec8c {
+		t.Error("FNV-1a hash failed")
+	}
+}
+
+func TestMix64(t *testing.T) {
+	// reference values of the SplitMix64 finalizer
+	if Mix64(0) != 0 || Mix64(1) != 0x5692161d100b05e5 {
+		t.Error("Mix64 failed")
+	}
+}
@@ -0,0 +1,165 @@
+package prehit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"go.melnyk.org/prehit/invalidation"
+)
+
+// invalidationqueue is the number of events waiting for publishing, newer events are dropped.
+const invalidationqueue = 1024
+
+// KeyCodec converts cache keys to bytes for invalidation events and back.
+type KeyCodec[K comparable] interface {
+	EncodeKey(key K) []byte
+	DecodeKey(data []byte) (K, error)
+}
+
+// StringKeyCodec is the KeyCodec of string keys, it is used by default for them.
+type StringKeyCodec struct{}
+
+// EncodeKey returns the bytes of the key.
+func (StringKeyCodec) EncodeKey(key string) []byte {
+	return []byte(key)
+}
+
+// DecodeKey returns the key of the bytes.
+func (StringKeyCodec) DecodeKey(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// startinvalidation subscribes the cache to the bus and starts publishing of local changes.
+func (c *Cache[K, V]) startinvalidation(bus invalidation.Bus, keycodec any) {
+	if keycodec == nil {
+		keycodec = any(StringKeyCodec{})
+	}
+	codec, ok := keycodec.(KeyCodec[K])
+	if !ok {
+		c.logger.Warning("Key codec does not match the cache key type - invalidation is disabled")
+		return
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		c.logger.Warning(fmt.Sprintf("Origin ID cannot be generated - invalidation is disabled: %v", err))
+		return
+	}
+
+	c.bus = bus
+	c.keycodec = codec
+	c.origin = hex.EncodeToString(id)
+	c.events = make(chan invalidation.Event, invalidationqueue)
+	c.stopbus = bus.Subscribe(c.invalidate)
+
+	c.published.Add(1)
+	go c.publisher()
+}
+
+// Origin returns the ID of the cache in invalidation events, it is empty without WithInvalidation.
+func (c *Cache[K, V]) Origin() string {
+	return c.origin
+}
+
+func (c *Cache[K, V]) encodekeys(key []K) [][]byte {
+	keys := make([][]byte, len(key))
+	for i, k := range key {
+		keys[i] = c.keycodec.EncodeKey(k)
+	}
+	return keys
+}
+
+// publish queues the event of a local change without blocking.
+// Changes after Close are not published.
+func (c *Cache[K, V]) publish(e invalidation.Event) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	e.Origin = c.origin
+	select {
+	case c.events <- e:
+	default:
+		c.logger.Warning("Invalidation queue is full - the event is dropped")
+		c.trackerror()
+	}
+}
+
+// publisher sends queued events to the bus until Close, the rest of the queue is sent on Close.
+func (c *Cache[K, V]) publisher() {
+	defer c.published.Done()
+
+	send := func(e invalidation.Event) {
+		if err := c.bus.Publish(e); err != nil {
+			c.logger.Warning(fmt.Sprintf("Invalidation publish failed: %v", err))
+			c.trackerror()
+		}
+	}
+
+	for {
+		select {
+		case e := <-c.events:
+			send(e)
+		case <-c.done:
+			for {
+				select {
+				case e := <-c.events:
+					send(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// invalidate applies an event of another cache, own events are skipped.
+// Dirty items waiting for write-behind are kept, as clear keeps them on reset.
+func (c *Cache[K, V]) invalidate(e invalidation.Event) {
+	if e.Origin == c.origin {
+		return
+	}
+
+	if e.Reset {
+		c.logger.Verbose("Reset cache by invalidation")
+		c.mutex.Lock()
+		c.clear()
+		c.mutex.Unlock()
+		return
+	}
+
+	keys := make([]K, 0, len(e.Keys))
+	for _, data := range e.Keys {
+		key, err := c.keycodec.DecodeKey(data)
+		if err != nil {
+			c.logger.Warning(fmt.Sprintf("Invalidated key cannot be decoded: %v", err))
+			c.trackerror()
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	c.mutex.Lock()
+	clean := keys[:0]
+	for _, key := range keys {
+		if item, found := c.index[key]; found && item != nil && item.dirty() != 0 {
+			continue // the local change is not written yet, it is written after the remote one
+		}
+		clean = append(clean, key)
+	}
+	c.remove(clean)
+	c.check()
+	c.mutex.Unlock()
+}
+
+// closeinvalidation unsubscribes the cache and publishes queued events.
+func (c *Cache[K, V]) closeinvalidation() {
+	if c.bus == nil {
+		return
+	}
+	c.stopbus()
+	c.published.Wait()
+}
@@ -0,0 +1,150 @@
+package prehit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit/invalidation"
+)
+
+// eventually waits for the condition.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition is not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type intkeys struct{}
+
+func (intkeys) EncodeKey(key int) []byte {
+	return []byte(strconv.Itoa(key))
+}
+
+func (intkeys) DecodeKey(data []byte) (int, error) {
+	if string(data) == "bad" {
+		return 0, errors.New("bad key")
+	}
+	return strconv.Atoi(string(data))
+}
+
+func TestInvalidation(t *testing.T) {
+	bus := invalidation.NewLocal()
+	a := NewCache[string, int](WithInvalidation[string](bus, nil))
+	b := NewCache[string, int](WithInvalidation[string](bus, nil))
+	defer a.Close()
+	defer b.Close()
+
+	if a.Origin() == "" || a.Origin() == b.Origin() {
+		t.Fatal("Caches must have distinct origins")
+	}
+
+	b.Set("x", 1, time.Hour)
+	b.Set("y", 2, time.Hour)
+	b.Set("z", 3, time.Hour)
+
+	// own events are not applied
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := b.Get("x"); !ok {
+		t.Fatal("Own Set must not invalidate the key")
+	}
+
+	// Set on a peer invalidates the stale copy
+	a.Set("x", 10, time.Hour)
+	eventually(t, func() bool { _, ok := b.Get("x"); return !ok })
+
+	a.Delete("y")
+	eventually(t, func() bool { _, ok := b.Get("y"); return !ok })
+	if _, ok := b.Get("z"); !ok {
+		t.Error("Other keys must stay")
+	}
+
+	a.Reset()
+	eventually(t, func() bool { return b.Stats().Size == 0 })
+	if _, ok := a.Get("x"); ok {
+		t.Error("Reset must clear the local cache")
+	}
+}
+
+func TestInvalidationDirty(t *testing.T) {
+	store := &memorystore[string, int]{}
+	c := NewCache[string, int](WithWriteBehind[string, int](store, time.Hour, 100), WithInvalidation[string](invalidation.NewLocal(), nil))
+	defer c.Close()
+
+	c.Set("clean", 2, time.Hour)
+	c.Flush(context.Background())
+	store.setfail(true)
+	c.Set("dirty", 1, time.Hour)
+
+	// remote changes do not drop local changes waiting for write-behind
+	c.invalidate(invalidation.Event{Origin: "peer", Keys: [][]byte{[]byte("dirty"), []byte("clean")}})
+	if _, ok := c.Get("dirty"); !ok {
+		t.Error("Dirty key must be kept on key invalidation")
+	}
+	if _, ok := c.Get("clean"); ok {
+		t.Error("Clean key must be invalidated")
+	}
+
+	c.invalidate(invalidation.Event{Origin: "peer", Reset: true})
+	if _, ok := c.Get("dirty"); !ok || c.Pending() != 1 {
+		t.Error("Dirty key must be kept on reset")
+	}
+	store.setfail(false)
+}
+
+func TestInvalidationKeyCodec(t *testing.T) {
+	bus := invalidation.NewLocal()
+	a := NewCache[int, int](WithInvalidation[int](bus, intkeys{}))
+	b := NewCache[int, int](WithInvalidation[int](bus, intkeys{}), WithValidation(true))
+	defer a.Close()
+	defer b.Close()
+
+	b.Set(1, 1, time.Hour)
+	a.Delete(1)
+	eventually(t, func() bool { _, ok := b.Get(1); return !ok })
+
+	// undecodable keys are reported
+	bus.Publish(invalidation.Event{Origin: "other", Keys: [][]byte{[]byte("bad")}})
+	if b.Stats().Errors == 0 {
+		t.Error("Undecodable key must be reported")
+	}
+
+	// missing codec for non-string keys disables invalidation
+	c := NewCache[int, int](WithInvalidation[int](bus, nil))
+	if c.Origin() != "" {
+		t.Error("Invalidation must be disabled")
+	}
+	c.Set(1, 1, time.Hour)
+}
+
+// failingbus fails all publishes.
+type failingbus struct {
+	invalidation.Local
+}
+
+func (f *failingbus) Publish(invalidation.Event) error {
+	return errors.New("bus is down")
+}
+
+func TestInvalidationClose(t *testing.T) {
+	bus := &failingbus{}
+	c := NewCache[string, int](WithInvalidation[string](bus, nil))
+	c.Set("a", 1, time.Hour)
+	c.Close()
+	if c.Stats().Errors != 1 {
+		t.Error("Queued event must be published on Close")
+	}
+
+	// changes after Close are not published
+	c.Set("b", 1, time.Hour)
+	if c.Stats().Errors != 1 {
+		t.Error("Changes after Close must not be published")
+	}
+}
@@ -0,0 +1,367 @@
+package invalidation
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	maxframe     = 16 << 20 // max encoded event
+	hubqueue     = 256      // frames waiting for a slow connection before it is dropped
+	writetimeout = 5 * time.Second
+	minbackoff   = 100 * time.Millisecond
+	maxbackoff   = 5 * time.Second
+	hellosize    = 16 // hub id and sequence sent to a connected client
+	seqsize      = 8  // sequence prefix of forwarded frames
+)
+
+// ErrNotConnected is returned by HubClient.Publish while the client reconnects.
+var ErrNotConnected = errors.New("not connected to the hub")
+
+// writeframe writes the length-prefixed event.
+func writeframe(w io.Writer, data []byte) error {
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readframe reads a length-prefixed event.
+func readframe(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n > maxframe {
+		return nil, ErrFormat
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Hub is a TCP server forwarding events of every client to all other clients.
+// Clients too slow to receive are disconnected and reconnect.
+//
+// Forwarded frames are numbered, the sender gets an empty frame with the number of its event.
+// A connected client first receives the hub id and the last number, so after reconnection
+// it knows whether events were missed.
+type Hub struct {
+	id        uint64
+	mutex     sync.Mutex
+	seq       uint64
+	clients   map[net.Conn]chan []byte
+	listeners map[net.Listener]bool
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewHub creates a hub, it is started by Serve.
+func NewHub() *Hub {
+	var id [8]byte
+	rand.Read(id[:])
+	return &Hub{
+		id:        binary.BigEndian.Uint64(id[:]),
+		clients:   make(map[net.Conn]chan []byte),
+		listeners: make(map[net.Listener]bool),
+	}
+}
+
+// Serve accepts clients on the listener until Close.
+func (h *Hub) Serve(l net.Listener) error {
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		l.Close()
+		return ErrClosed
+	}
+	h.listeners[l] = true
+	h.mutex.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			h.mutex.Lock()
+			closed := h.closed
+			delete(h.listeners, l)
+			h.mutex.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+
+		queue := make(chan []byte, hubqueue)
+		h.mutex.Lock()
+		if h.closed {
+			h.mutex.Unlock()
+			conn.Close()
+			return ErrClosed
+		}
+		hello := make([]byte, hellosize)
+		binary.BigEndian.PutUint64(hello, h.id)
+		binary.BigEndian.PutUint64(hello[8:], h.seq)
+		queue <- hello
+		h.clients[conn] = queue
+		h.wg.Add(2) // under the lock, so Close waits for the client
+		h.mutex.Unlock()
+
+		go h.read(conn)
+		go h.write(conn, queue)
+	}
+}
+
+// read forwards frames of the client to other clients.
+func (h *Hub) read(conn net.Conn) {
+	defer h.wg.Done()
+	defer h.drop(conn)
+
+	r := bufio.NewReader(conn)
+	for {
+		data, err := readframe(r)
+		if err != nil {
+			return
+		}
+
+		h.mutex.Lock()
+		h.seq++
+		frame := make([]byte, seqsize+len(data))
+		binary.BigEndian.PutUint64(frame, h.seq)
+		copy(frame[seqsize:], data)
+		for client, queue := range h.clients {
+			f := frame
+			if client == conn {
+				f = frame[:seqsize] // the sender knows its event
+			}
+			select {
+			case queue <- f:
+			default: // slow client, it reconnects and resets its cache
+				go h.drop(client)
+			}
+		}
+		h.mutex.Unlock()
+	}
+}
+
+func (h *Hub) write(conn net.Conn, queue chan []byte) {
+	defer h.wg.Done()
+
+	for data := range queue {
+		conn.SetWriteDeadline(time.Now().Add(writetimeout))
+		if writeframe(conn, data) != nil {
+			go h.drop(conn)
+			for range queue { // wait for the drop
+			}
+			return
+		}
+	}
+}
+
+// drop disconnects the client.
+func (h *Hub) drop(conn net.Conn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if queue, found := h.clients[conn]; found {
+		delete(h.clients, conn)
+		close(queue)
+		conn.Close()
+	}
+}
+
+// Clients returns the number of connected clients.
+func (h *Hub) Clients() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return len(h.clients)
+}
+
+// Close stops all listeners and disconnects clients.
+func (h *Hub) Close() error {
+	h.mutex.Lock()
+	h.closed = true
+	for l := range h.listeners {
+		l.Close()
+	}
+	for conn, queue := range h.clients {
+		delete(h.clients, conn)
+		close(queue)
+		conn.Close()
+	}
+	h.mutex.Unlock()
+
+	h.wg.Wait()
+	return nil
+}
+
+// HubClient is a bus connected to a Hub. Events published by the client are delivered
+// to its own subscribers directly. The client reconnects after failures, and a reset event
+// is delivered to subscribers after reconnection if events were forwarded by the hub while
+// the client was disconnected or the hub was restarted.
+type HubClient struct {
+	address     string
+	subscribers subscribers
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// DialHub connects to the hub at the address.
+func DialHub(address string) (*HubClient, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &HubClient{address: address, conn: conn, done: make(chan struct{})}
+	c.wg.Add(1)
+	go c.receive(conn)
+	return c, nil
+}
+
+func (c *HubClient) receive(conn net.Conn) {
+	defer c.wg.Done()
+
+	var hub, seq uint64 // the hub and the number of the last received frame
+	known := false      // the position in the hub stream is known
+	first := true
+	for {
+		r := bufio.NewReader(conn)
+		hello := true
+		for {
+			data, err := readframe(r)
+			if err != nil {
+				break
+			}
+			if hello {
+				if len(data) != hellosize {
+					break
+				}
+				id, last := binary.BigEndian.Uint64(data), binary.BigEndian.Uint64(data[8:])
+				if !first && (!known || id != hub || last != seq) { // events were missed
+					c.subscribers.deliver(Event{Reset: true})
+				}
+				hub, seq, known, hello = id, last, true, false
+				continue
+			}
+			if len(data) < seqsize {
+				break
+			}
+			seq = binary.BigEndian.Uint64(data)
+			if len(data) == seqsize { // own event
+				continue
+			}
+			var e Event
+			if e.UnmarshalBinary(data[seqsize:]) != nil {
+				continue
+			}
+			c.subscribers.deliver(e)
+		}
+
+		first = false
+		conn = c.reconnect(conn)
+		if conn == nil {
+			return
+		}
+	}
+}
+
+// reconnect replaces the broken connection, it returns nil after Close.
+func (c *HubClient) reconnect(broken net.Conn) net.Conn {
+	c.mutex.Lock()
+	broken.Close()
+	if c.conn == broken {
+		c.conn = nil
+	}
+	c.mutex.Unlock()
+
+	backoff := minbackoff
+	for {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(backoff):
+		}
+
+		conn, err := net.Dial("tcp", c.address)
+		if err != nil {
+			if backoff *= 2; backoff > maxbackoff {
+				backoff = maxbackoff
+			}
+			continue
+		}
+
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		c.conn = conn
+		c.mutex.Unlock()
+		return conn
+	}
+}
+
+// Publish delivers the event to own subscribers and sends it to the hub.
+func (c *HubClient) Publish(e Event) error {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	c.subscribers.deliver(e)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writetimeout))
+	if err := writeframe(c.conn, data); err != nil {
+		c.conn.Close() // the receiver reconnects
+		return err
+	}
+	return nil
+}
+
+// Subscribe registers the handler of received events.
+func (c *HubClient) Subscribe(handler func(Event)) func() {
+	return c.subscribers.subscribe(handler)
+}
+
+// Close disconnects from the hub.
+func (c *HubClient) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mutex.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
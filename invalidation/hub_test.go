@@ -0,0 +1,191 @@
+package invalidation
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// collector collects received events.
+type collector chan Event
+
+func (c collector) handle(e Event) {
+	c <- e
+}
+
+func (c collector) next(t *testing.T) Event {
+	t.Helper()
+	select {
+	case e := <-c:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Event is not received")
+		return Event{}
+	}
+}
+
+func TestHub(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := NewHub()
+	go hub.Serve(l)
+	defer hub.Close()
+
+	a, err := DialHub(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := DialHub(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for hub.Clients() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ca, cb := make(collector, 10), make(collector, 10)
+	a.Subscribe(ca.handle)
+	b.Subscribe(cb.handle)
+
+	if err := a.Publish(Event{Origin: "a", Keys: [][]byte{[]byte("key")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// own subscribers receive the event directly, others through the hub
+	if e := ca.next(t); e.Origin != "a" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if e := cb.next(t); e.Origin != "a" || string(e.Keys[0]) != "key" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	b.Publish(Event{Origin: "b", Reset: true})
+	cb.next(t)
+	if e := ca.next(t); e.Origin != "b" || !e.Reset {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestHubReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	hub := NewHub()
+	go hub.Serve(l)
+
+	c, err := DialHub(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	received := make(collector, 10)
+	c.Subscribe(received.handle)
+
+	// the hub restarts on the same address
+	hub.Close()
+	if hub.Serve(l) != ErrClosed {
+		t.Error("Expected ErrClosed from closed hub")
+	}
+	l, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skip("address cannot be reused:", err)
+	}
+	hub = NewHub()
+	go hub.Serve(l)
+	defer hub.Close()
+
+	// subscribers reset caches after reconnection
+	if e := received.next(t); !e.Reset {
+		t.Errorf("Expected reset event, got %+v", e)
+	}
+	if err := c.Publish(Event{Origin: "c"}); err != nil {
+		t.Errorf("Unexpected error after reconnection: %v", err)
+	}
+
+	c.Close()
+	if c.Publish(Event{}) != ErrClosed {
+		t.Error("Expected ErrClosed")
+	}
+}
+
+func TestHubReconnectWithoutLoss(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := NewHub()
+	go hub.Serve(l)
+	defer hub.Close()
+
+	a, err := DialHub(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := DialHub(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	for hub.Clients() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	received := make(collector, 10)
+	a.Subscribe(received.handle)
+	b.Publish(Event{Origin: "b"})
+	received.next(t)
+
+	// disconnect drops the connection of a
+	disconnect := func() {
+		hub.mutex.Lock()
+		var conns []net.Conn
+		for conn := range hub.clients {
+			conns = append(conns, conn)
+		}
+		hub.mutex.Unlock()
+		for _, conn := range conns {
+			if addr := conn.RemoteAddr().String(); addr == localaddr(a) {
+				hub.drop(conn)
+			}
+		}
+	}
+
+	// nothing is missed during a network blip
+	disconnect()
+	for localaddr(a) == "" || hub.Clients() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Publish(Event{Origin: "b", Keys: [][]byte{[]byte("key")}})
+	if e := received.next(t); e.Reset || string(e.Keys[0]) != "key" {
+		t.Errorf("Expected the event without reset, got %+v", e)
+	}
+
+	// events forwarded while disconnected lead to a reset
+	disconnect()
+	for hub.Clients() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Publish(Event{Origin: "b"})
+	if e := received.next(t); !e.Reset {
+		t.Errorf("Expected reset event, got %+v", e)
+	}
+}
+
+// localaddr returns the local address of the client connection, empty while reconnecting.
+func localaddr(c *HubClient) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.LocalAddr().String()
+}
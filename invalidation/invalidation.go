@@ -0,0 +1,172 @@
+// Package invalidation broadcasts cache invalidation events between instances.
+//
+// A cache publishes an event for every local change (see prehit.WithInvalidation), and peers
+// apply events of other origins by removing the keys or clearing the cache. Events are
+// encoded as a header with the magic "PHIV", the version, the origin and the reset flag,
+// followed by the number of keys and uvarint-prefixed keys.
+package invalidation
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+const (
+	magic   = "PHIV"
+	version = 1
+
+	flagreset = 1
+)
+
+// ErrFormat is returned for malformed events.
+var ErrFormat = errors.New("invalid invalidation event")
+
+// ErrClosed is returned by Publish after Close.
+var ErrClosed = errors.New("bus is closed")
+
+// Event is an invalidation of keys or of the whole cache.
+type Event struct {
+	Origin string   // ID of the publishing cache, used to skip own events
+	Reset  bool     // the whole cache is cleared, keys are ignored
+	Keys   [][]byte // encoded keys
+}
+
+// Bus delivers events to all subscribers, including the subscribers of the publisher.
+type Bus interface {
+	// Publish sends the event to all subscribers.
+	Publish(e Event) error
+	// Subscribe registers the handler of received events and returns the function removing it.
+	// Handlers are called sequentially and must not block.
+	Subscribe(handler func(Event)) (cancel func())
+}
+
+// MarshalBinary encodes the event.
+func (e Event) MarshalBinary() ([]byte, error) {
+	if len(e.Origin) > 255 {
+		return nil, ErrFormat
+	}
+
+	size := len(magic) + 3 + len(e.Origin) + binary.MaxVarintLen64
+	for _, key := range e.Keys {
+		size += binary.MaxVarintLen64 + len(key)
+	}
+
+	data := make([]byte, 0, size)
+	data = append(data, magic...)
+	data = append(data, version, byte(len(e.Origin)))
+	data = append(data, e.Origin...)
+	var flags byte
+	if e.Reset {
+		flags |= flagreset
+	}
+	data = append(data, flags)
+	data = binary.AppendUvarint(data, uint64(len(e.Keys)))
+	for _, key := range e.Keys {
+		data = binary.AppendUvarint(data, uint64(len(key)))
+		data = append(data, key...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes the event.
+func (e *Event) UnmarshalBinary(data []byte) error {
+	if len(data) < len(magic)+2 || string(data[:len(magic)]) != magic || data[len(magic)] != version {
+		return ErrFormat
+	}
+	data = data[len(magic)+1:]
+
+	n := int(data[0])
+	if len(data) < 1+n+1 {
+		return ErrFormat
+	}
+	origin := string(data[1 : 1+n])
+	flags := data[1+n]
+	data = data[2+n:]
+
+	count, read := binary.Uvarint(data)
+	if read <= 0 || count > uint64(len(data)) { // every key takes at least one byte
+		return ErrFormat
+	}
+	data = data[read:]
+
+	keys := make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		length, read := binary.Uvarint(data)
+		if read <= 0 || length > uint64(len(data)-read) {
+			return ErrFormat
+		}
+		keys = append(keys, append([]byte(nil), data[read:read+int(length)]...))
+		data = data[read+int(length):]
+	}
+	if len(data) != 0 {
+		return ErrFormat
+	}
+
+	*e = Event{Origin: origin, Reset: flags&flagreset != 0, Keys: keys}
+	return nil
+}
+
+// subscribers is a set of handlers shared by bus implementations.
+type subscribers struct {
+	mutex    sync.Mutex
+	next     int
+	handlers map[int]func(Event)
+	dispatch sync.Mutex // handlers are called sequentially
+}
+
+func (s *subscribers) subscribe(handler func(Event)) func() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.handlers == nil {
+		s.handlers = make(map[int]func(Event))
+	}
+	id := s.next
+	s.next++
+	s.handlers[id] = handler
+
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		delete(s.handlers, id)
+	}
+}
+
+func (s *subscribers) deliver(e Event) {
+	s.mutex.Lock()
+	handlers := make([]func(Event), 0, len(s.handlers))
+	for _, handler := range s.handlers {
+		handlers = append(handlers, handler)
+	}
+	s.mutex.Unlock()
+
+	s.dispatch.Lock()
+	defer s.dispatch.Unlock()
+
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
+
+// Local is an in-process bus, mostly for tests.
+type Local struct {
+	subscribers subscribers
+}
+
+// NewLocal creates an in-process bus.
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Publish delivers the event to all subscribers synchronously.
+func (l *Local) Publish(e Event) error {
+	l.subscribers.deliver(e)
+	return nil
+}
+
+// Subscribe registers the handler of events.
+func (l *Local) Subscribe(handler func(Event)) func() {
+	return l.subscribers.subscribe(handler)
+}
@@ -0,0 +1,98 @@
+package invalidation
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEventEncoding(t *testing.T) {
+	events := []Event{
+		{Origin: "a1", Keys: [][]byte{[]byte("key"), {}, []byte("other")}},
+		{Origin: "b2", Reset: true, Keys: [][]byte{}},
+		{Keys: [][]byte{}},
+	}
+
+	for _, e := range events {
+		data, err := e.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Event
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Origin != e.Origin || decoded.Reset != e.Reset || len(decoded.Keys) != len(e.Keys) {
+			t.Fatalf("Unexpected event %+v", decoded)
+		}
+		for i := range e.Keys {
+			if !bytes.Equal(decoded.Keys[i], e.Keys[i]) {
+				t.Errorf("Unexpected key %q", decoded.Keys[i])
+			}
+		}
+	}
+
+	if _, err := (Event{Origin: strings.Repeat("x", 256)}).MarshalBinary(); err != ErrFormat {
+		t.Error("Expected error for long origin")
+	}
+
+	data, _ := Event{Origin: "a", Keys: [][]byte{[]byte("key")}}.MarshalBinary()
+	for _, bad := range [][]byte{
+		nil,
+		[]byte("XXXX\x01"),
+		data[:len(data)-1],
+		append(append([]byte(nil), data...), 0),
+		data[:7],
+	} {
+		var e Event
+		if e.UnmarshalBinary(bad) != ErrFormat {
+			t.Errorf("Expected format error for %q", bad)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	e := Event{Origin: "origin"}
+	for i := 0; i < 100; i++ {
+		e.Keys = append(e.Keys, bytes.Repeat([]byte{'k'}, 50))
+	}
+
+	parts := split(e, maxdatagram)
+	total := 0
+	for _, part := range parts {
+		data, _ := part.MarshalBinary()
+		if len(data) > maxdatagram || part.Origin != "origin" {
+			t.Errorf("Part of %d bytes is too large", len(data))
+		}
+		total += len(part.Keys)
+	}
+	if len(parts) < 2 || total != 100 {
+		t.Errorf("Unexpected split into %d parts with %d keys", len(parts), total)
+	}
+
+	if parts := split(Event{Reset: true}, maxdatagram); len(parts) != 1 || !parts[0].Reset {
+		t.Error("Reset must not be split")
+	}
+}
+
+func TestLocal(t *testing.T) {
+	bus := NewLocal()
+
+	var mutex sync.Mutex
+	var received []string
+	cancel := bus.Subscribe(func(e Event) {
+		mutex.Lock()
+		received = append(received, e.Origin)
+		mutex.Unlock()
+	})
+	bus.Subscribe(func(e Event) {})
+
+	bus.Publish(Event{Origin: "a"})
+	cancel()
+	bus.Publish(Event{Origin: "b"})
+
+	if len(received) != 1 || received[0] != "a" {
+		t.Errorf("Unexpected events %v", received)
+	}
+}
@@ -0,0 +1,129 @@
+package invalidation
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// maxdatagram keeps datagrams below the usual MTU to avoid fragmentation.
+const maxdatagram = 1400
+
+// ErrTooLarge is returned by Multicast.Publish for keys that do not fit a datagram.
+var ErrTooLarge = errors.New("key does not fit a datagram")
+
+// Multicast is a bus over UDP multicast. Delivery is best effort: lost datagrams
+// leave stale keys until they expire, so TTLs bound the staleness.
+type Multicast struct {
+	send        *net.UDPConn
+	recv        *net.UDPConn
+	subscribers subscribers
+	wg          sync.WaitGroup
+	once        sync.Once
+}
+
+// NewMulticast joins the multicast group address (for example "239.1.2.3:7946")
+// on the interface, nil means the system default one.
+func NewMulticast(address string, iface *net.Interface) (*Multicast, error) {
+	group, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	recv, err := net.ListenMulticastUDP("udp", iface, group)
+	if err != nil {
+		return nil, err
+	}
+
+	send, err := net.DialUDP("udp", nil, group)
+	if err != nil {
+		recv.Close()
+		return nil, err
+	}
+
+	m := &Multicast{send: send, recv: recv}
+	m.wg.Add(1)
+	go m.receive()
+	return m, nil
+}
+
+func (m *Multicast) receive() {
+	defer m.wg.Done()
+
+	buffer := make([]byte, 65536)
+	for {
+		n, _, err := m.recv.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		var e Event
+		if e.UnmarshalBinary(buffer[:n]) != nil {
+			continue // foreign or damaged datagram
+		}
+		m.subscribers.deliver(e)
+	}
+}
+
+// Publish sends the event, keys are split into several datagrams when needed.
+func (m *Multicast) Publish(e Event) error {
+	for _, part := range split(e, maxdatagram) {
+		data, err := part.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if len(data) > maxdatagram {
+			return ErrTooLarge
+		}
+		if _, err := m.send.Write(data); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return ErrClosed
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe registers the handler of received events.
+func (m *Multicast) Subscribe(handler func(Event)) func() {
+	return m.subscribers.subscribe(handler)
+}
+
+// Close leaves the group.
+func (m *Multicast) Close() error {
+	var err error
+	m.once.Do(func() {
+		m.send.Close()
+		err = m.recv.Close()
+		m.wg.Wait()
+	})
+	return err
+}
+
+// split divides keys of the event into events encoded within the size.
+// A key larger than the size gets its own event.
+func split(e Event, size int) []Event {
+	if e.Reset || len(e.Keys) == 0 {
+		return []Event{e}
+	}
+
+	var parts []Event
+	header := len(magic) + 3 + len(e.Origin) + 5 // 5 bytes are enough for the number of keys
+	part := Event{Origin: e.Origin}
+	length := header
+	for _, key := range e.Keys {
+		n := len(key) + 5
+		if len(part.Keys) > 0 && length+n > size {
+			parts = append(parts, part)
+			part = Event{Origin: e.Origin}
+			length = header
+		}
+		part.Keys = append(part.Keys, key)
+		length += n
+	}
+	return append(parts, part)
+}
@@ -0,0 +1,34 @@
+package invalidation
+
+import (
+	"testing"
+)
+
+func TestMulticast(t *testing.T) {
+	a, err := NewMulticast("239.255.77.77:17946", nil)
+	if err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	defer a.Close()
+	b, err := NewMulticast("239.255.77.77:17946", nil)
+	if err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	defer b.Close()
+
+	received := make(collector, 100)
+	b.Subscribe(received.handle)
+
+	if err := a.Publish(Event{Origin: "a", Keys: [][]byte{[]byte("key")}}); err != nil {
+		t.Skip("multicast is not routable:", err)
+	}
+	e := received.next(t)
+	if e.Origin != "a" || string(e.Keys[0]) != "key" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	a.Close()
+	if a.Publish(Event{}) != ErrClosed {
+		t.Error("Expected ErrClosed")
+	}
+}
@@ -1,5 +1,11 @@
 package prehit
 
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
 // Metrics defines telemetry for Cache
 type Metrics interface {
 	Hit()
@@ -11,6 +17,73 @@ type Metrics interface {
 	Delete()
 }
 
+// Op is a cache operation measured by ExtendedMetrics.
+type Op int
+
+const (
+	OpGet    Op = iota // Get, Lookup and GetEarly
+	OpSet              // Set, SetMissing, SetError and SetComputed
+	OpDelete           // Delete
+	OpReset            // Reset
+)
+
+// String returns the name of the operation.
+func (o Op) String() string {
+	switch o {
+	case OpGet:
+		return "get"
+	case OpSet:
+		return "set"
+	case OpDelete:
+		return "delete"
+	case OpReset:
+		return "reset"
+	default:
+		return "unknown"
+	}
+}
+
+// EvictReason is a reason of an eviction reported to ExtendedMetrics.
+type EvictReason int
+
+const (
+	EvictCapacity EvictReason = iota // the item was removed from the tail to free space
+	EvictExpired                     // the item was removed on access after its expiration
+)
+
+// String returns the name of the reason.
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// ExtendedMetrics is an optional extension of Metrics.
+// It is used when the value passed to WithMetrics implements it; existing Metrics
+// implementations keep working without it.
+type ExtendedMetrics interface {
+	// Latency reports the duration of a cache operation.
+	Latency(op Op, d time.Duration)
+	// Evicted reports an eviction with the reason, the age of the item (time since it was
+	// stored) and its cost calculated by the function set by WithCost (zero without it).
+	// It is called in addition to Metrics.Evict.
+	Evicted(reason EvictReason, age time.Duration, cost uint64)
+}
+
+// WeightedMetrics is an optional extension of Metrics (and NegativeMetrics) counting several
+// events in one call. SampledMetrics uses it to forward a sampled event with its weight.
+type WeightedMetrics interface {
+	HitN(n uint64)
+	MissN(n uint64)
+	MissingHitN(n uint64)
+	ErrorHitN(n uint64)
+}
+
 // nometrics is a Metrics implementation that does nothing.
 type nometrics struct{}
 
@@ -21,3 +94,262 @@ func (n *nometrics) Add()    {}
 func (n *nometrics) Update() {}
 func (n *nometrics) Evict()  {}
 func (n *nometrics) Delete() {}
+
+func (n *nometrics) MissingHit() {}
+func (n *nometrics) ErrorHit()   {}
+
+// repeatedmetrics implements WeightedMetrics for a sink without it by repeating calls.
+type repeatedmetrics struct {
+	sink     Metrics
+	negative NegativeMetrics
+}
+
+func (m repeatedmetrics) HitN(n uint64) {
+	for i := uint64(0); i < n; i++ {
+		m.sink.Hit()
+	}
+}
+
+func (m repeatedmetrics) MissN(n uint64) {
+	for i := uint64(0); i < n; i++ {
+		m.sink.Miss()
+	}
+}
+
+func (m repeatedmetrics) MissingHitN(n uint64) {
+	for i := uint64(0); i < n; i++ {
+		m.negative.MissingHit()
+	}
+}
+
+func (m repeatedmetrics) ErrorHitN(n uint64) {
+	for i := uint64(0); i < n; i++ {
+		m.negative.ErrorHit()
+	}
+}
+
+// weightedof returns the sink as WeightedMetrics, repeating calls if it does not implement it.
+func weightedof(sink Metrics) WeightedMetrics {
+	if w, ok := sink.(WeightedMetrics); ok {
+		return w
+	}
+	m := repeatedmetrics{sink: sink, negative: &nometrics{}}
+	if n, ok := sink.(NegativeMetrics); ok {
+		m.negative = n
+	}
+	return m
+}
+
+// multimetrics forwards metrics to several sinks.
+type multimetrics struct {
+	sinks    []Metrics
+	negative []NegativeMetrics
+	weighted []WeightedMetrics // sinks as WeightedMetrics
+}
+
+func (m *multimetrics) Hit() {
+	for _, s := range m.sinks {
+		s.Hit()
+	}
+}
+
+func (m *multimetrics) Miss() {
+	for _, s := range m.sinks {
+		s.Miss()
+	}
+}
+
+func (m *multimetrics) Error() {
+	for _, s := range m.sinks {
+		s.Error()
+	}
+}
+
+func (m *multimetrics) Add() {
+	for _, s := range m.sinks {
+		s.Add()
+	}
+}
+
+func (m *multimetrics) Update() {
+	for _, s := range m.sinks {
+		s.Update()
+	}
+}
+
+func (m *multimetrics) Evict() {
+	for _, s := range m.sinks {
+		s.Evict()
+	}
+}
+
+func (m *multimetrics) Delete() {
+	for _, s := range m.sinks {
+		s.Delete()
+	}
+}
+
+func (m *multimetrics) MissingHit() {
+	for _, s := range m.negative {
+		s.MissingHit()
+	}
+}
+
+func (m *multimetrics) ErrorHit() {
+	for _, s := range m.negative {
+		s.ErrorHit()
+	}
+}
+
+func (m *multimetrics) HitN(n uint64) {
+	for _, s := range m.weighted {
+		s.HitN(n)
+	}
+}
+
+func (m *multimetrics) MissN(n uint64) {
+	for _, s := range m.weighted {
+		s.MissN(n)
+	}
+}
+
+func (m *multimetrics) MissingHitN(n uint64) {
+	for _, s := range m.weighted {
+		s.MissingHitN(n)
+	}
+}
+
+func (m *multimetrics) ErrorHitN(n uint64) {
+	for _, s := range m.weighted {
+		s.ErrorHitN(n)
+	}
+}
+
+// multiextended forwards metrics to several sinks, some of them are ExtendedMetrics.
+type multiextended struct {
+	*multimetrics
+	extended []ExtendedMetrics
+}
+
+func (m *multiextended) Latency(op Op, d time.Duration) {
+	for _, s := range m.extended {
+		s.Latency(op, d)
+	}
+}
+
+func (m *multiextended) Evicted(reason EvictReason, age time.Duration, cost uint64) {
+	for _, s := range m.extended {
+		s.Evicted(reason, age, cost)
+	}
+}
+
+// MultiMetrics returns Metrics forwarding all calls to every sink.
+// NegativeMetrics and ExtendedMetrics calls are forwarded to the sinks implementing them.
+// WeightedMetrics calls are forwarded with the weight to the sinks implementing them,
+// and repeated for other sinks.
+func MultiMetrics(sinks ...Metrics) Metrics {
+	m := &multimetrics{}
+	var extended []ExtendedMetrics
+	for _, s := range sinks {
+		if s == nil {
+			continue
+		}
+		m.sinks = append(m.sinks, s)
+		m.weighted = append(m.weighted, weightedof(s))
+		if n, ok := s.(NegativeMetrics); ok {
+			m.negative = append(m.negative, n)
+		}
+		if e, ok := s.(ExtendedMetrics); ok {
+			extended = append(extended, e)
+		}
+	}
+
+	if len(extended) > 0 { // latencies are measured only if someone needs them
+		return &multiextended{multimetrics: m, extended: extended}
+	}
+
+	return m
+}
+
+// sampledmetrics forwards every n-th call of Hit, Miss, MissingHit and ErrorHit with
+// the weight n. Other calls are forwarded as is.
+type sampledmetrics struct {
+	Metrics
+	weighted    WeightedMetrics
+	n           uint64
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	missinghits atomic.Uint64
+	errorhits   atomic.Uint64
+}
+
+func (m *sampledmetrics) Hit() {
+	if m.hits.Add(1)%m.n == 0 {
+		m.weighted.HitN(m.n)
+	}
+}
+
+func (m *sampledmetrics) Miss() {
+	if m.misses.Add(1)%m.n == 0 {
+		m.weighted.MissN(m.n)
+	}
+}
+
+func (m *sampledmetrics) MissingHit() {
+	if m.missinghits.Add(1)%m.n == 0 {
+		m.weighted.MissingHitN(m.n)
+	}
+}
+
+func (m *sampledmetrics) ErrorHit() {
+	if m.errorhits.Add(1)%m.n == 0 {
+		m.weighted.ErrorHitN(m.n)
+	}
+}
+
+// sampledextended is sampledmetrics for ExtendedMetrics, latencies are sampled without scaling.
+type sampledextended struct {
+	*sampledmetrics
+	extended  ExtendedMetrics
+	latencies atomic.Uint64
+}
+
+func (m *sampledextended) Latency(op Op, d time.Duration) {
+	if m.latencies.Add(1)%m.n == 0 {
+		m.extended.Latency(op, d)
+	}
+}
+
+func (m *sampledextended) Evicted(reason EvictReason, age time.Duration, cost uint64) {
+	m.extended.Evicted(reason, age, cost)
+}
+
+// minsamplerate is the lowest rate of SampledMetrics.
+const minsamplerate = 1e-6
+
+// SampledMetrics returns Metrics passing only the given rate of Hit and Miss calls
+// (and of NegativeMetrics calls) to the sink, each with the weight 1/rate, so the counts
+// stay correct on average. Sinks implementing WeightedMetrics get a single weighted call,
+// other sinks get the call repeated 1/rate times. Other calls are not sampled, as they are rare and usually define gauges like the number
+// of items. The rate of 1 or more returns the sink itself, rates below 1e-6 (including
+// zero, negative and NaN) are clamped to 1e-6.
+func SampledMetrics(sink Metrics, rate float64) Metrics {
+	if rate >= 1 {
+		return sink
+	}
+	if !(rate >= minsamplerate) {
+		rate = minsamplerate
+	}
+
+	m := &sampledmetrics{
+		Metrics:  sink,
+		weighted: weightedof(sink),
+		n:        uint64(math.Round(1 / rate)),
+	}
+
+	if e, ok := sink.(ExtendedMetrics); ok {
+		return &sampledextended{sampledmetrics: m, extended: e}
+	}
+
+	return m
+}
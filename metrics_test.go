@@ -0,0 +1,196 @@
+package prehit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit/internal/counters"
+)
+
+type eviction struct {
+	reason EvictReason
+	age    time.Duration
+	cost   uint64
+}
+
+type extendedmetrics struct {
+	basicmetrics
+	latencies map[Op]int
+	evictions []eviction
+}
+
+func (m *extendedmetrics) Latency(op Op, d time.Duration) {
+	if m.latencies == nil {
+		m.latencies = map[Op]int{}
+	}
+	if d >= 0 {
+		m.latencies[op]++
+	}
+}
+
+func (m *extendedmetrics) Evicted(reason EvictReason, age time.Duration, cost uint64) {
+	m.evictions = append(m.evictions, eviction{reason: reason, age: age, cost: cost})
+}
+
+func TestExtendedMetrics(t *testing.T) {
+	metrics := &extendedmetrics{}
+	c := NewCache[string, string](WithMaxSize(2), WithMetrics(metrics), WithCost(func(v string) uint64 { return uint64(len(v)) }))
+
+	c.Set("test1", "a", time.Second)
+	c.Set("test2", "bb", 0)
+	time.Sleep(time.Millisecond)
+	c.Get("test2")
+	c.Set("test3", "ccc", time.Second)
+	c.Set("test4", "dddd", time.Second)
+	c.Lookup("test3")
+	c.Delete("test3")
+	c.Reset()
+
+	if metrics.latencies[OpSet] != 4 || metrics.latencies[OpGet] != 2 || metrics.latencies[OpDelete] != 1 || metrics.latencies[OpReset] != 1 {
+		t.Errorf("Unexpected latencies %v", metrics.latencies)
+	}
+
+	if len(metrics.evictions) != 2 || metrics.evicted != 2 {
+		t.Fatalf("Unexpected evictions %v", metrics.evictions)
+	}
+
+	if e := metrics.evictions[0]; e.reason != EvictExpired || e.cost != 2 || e.age < time.Millisecond {
+		t.Errorf("Unexpected expired eviction %v", e)
+	}
+
+	if e := metrics.evictions[1]; e.reason != EvictCapacity || e.cost != 1 || e.age < time.Millisecond {
+		t.Errorf("Unexpected capacity eviction %v", e)
+	}
+}
+
+func TestCostMismatch(t *testing.T) {
+	c := NewCache[string, int](WithCost(func(v string) uint64 { return uint64(len(v)) }))
+	if c.cost != nil {
+		t.Error("Expected mismatched cost function to be ignored")
+	}
+}
+
+func TestMetricsStrings(t *testing.T) {
+	for op, name := range map[Op]string{OpGet: "get", OpSet: "set", OpDelete: "delete", OpReset: "reset", Op(-1): "unknown"} {
+		if op.String() != name {
+			t.Error("Op string failed")
+		}
+	}
+
+	for reason, name := range map[EvictReason]string{EvictCapacity: "capacity", EvictExpired: "expired", EvictReason(-1): "unknown"} {
+		if reason.String() != name {
+			t.Error("Evict reason string failed")
+		}
+	}
+}
+
+func TestMultiMetrics(t *testing.T) {
+	basic := &basicmetrics{}
+	negative := &negativemetrics{}
+	extended := &extendedmetrics{}
+
+	m := MultiMetrics(basic, nil, negative)
+	if _, ok := m.(ExtendedMetrics); ok {
+		t.Error("Expected no extended metrics without extended sinks")
+	}
+
+	c := NewCache[string, int](WithMaxSize(1), WithMetrics(MultiMetrics(basic, negative, extended)))
+	c.Set("test1", 1, time.Second)
+	c.Set("test1", 1, time.Second)
+	c.Set("test2", 2, time.Second)
+	c.Get("test2")
+	c.Get("test1")
+	c.SetMissing("test3", time.Second)
+	c.Lookup("test3")
+	c.Delete("test3")
+
+	for _, m := range []*basicmetrics{basic, &negative.basicmetrics, &extended.basicmetrics} {
+		if m.hits != 1 || m.miss != 1 || m.count != 0 || m.updates != 1 || m.evicted != 2 {
+			t.Errorf("Unexpected metrics %+v", *m)
+		}
+	}
+
+	if negative.missinghits != 1 {
+		t.Error("Expected negative metrics to be forwarded")
+	}
+
+	if len(extended.evictions) != 2 || extended.latencies[OpSet] != 4 {
+		t.Error("Expected extended metrics to be forwarded")
+	}
+}
+
+func TestSampledMetrics(t *testing.T) {
+	basic := &basicmetrics{}
+	if SampledMetrics(basic, 1) != basic || SampledMetrics(basic, 2) != basic {
+		t.Error("Expected the sink itself for full rate")
+	}
+	for _, rate := range []float64{0, -1, math.NaN(), 1e-9} {
+		if m, ok := SampledMetrics(basic, rate).(*sampledmetrics); !ok || m.n != 1e6 {
+			t.Errorf("Expected rate %v to be clamped", rate)
+		}
+	}
+
+	m := SampledMetrics(basic, 0.01)
+	if _, ok := m.(NegativeMetrics); !ok {
+		t.Error("Expected sampled metrics to implement negative metrics")
+	}
+	if _, ok := m.(ExtendedMetrics); ok {
+		t.Error("Expected no extended metrics for basic sink")
+	}
+
+	for i := 0; i < 1050; i++ {
+		m.Hit()
+		m.Miss()
+	}
+	m.Add()
+	m.Evict()
+
+	// sampled calls are repeated, the counts are preserved
+	if basic.hits != 1000 || basic.miss != 1000 || basic.count != 1 || basic.evicted != 1 {
+		t.Errorf("Unexpected metrics %+v", *basic)
+	}
+
+	// sampled calls are forwarded with the weight
+	weighted := &counters.Counters{}
+	w := SampledMetrics(weighted, 0.01).(NegativeMetrics)
+	for i := 0; i < 1050; i++ {
+		w.(Metrics).Hit()
+		w.(Metrics).Miss()
+		w.MissingHit()
+		w.ErrorHit()
+	}
+	if weighted.Hits.Load() != 1000 || weighted.Misses.Load() != 1000 || weighted.MissingHits.Load() != 1000 || weighted.ErrorHits.Load() != 1000 {
+		t.Error("Unexpected weighted metrics")
+	}
+
+	// weighted and plain sinks combined
+	weighted, basic = &counters.Counters{}, &basicmetrics{}
+	multi := SampledMetrics(MultiMetrics(weighted, basic), 0.01)
+	for i := 0; i < 1050; i++ {
+		multi.Hit()
+	}
+	if weighted.Hits.Load() != 1000 || basic.hits != 1000 {
+		t.Errorf("Unexpected combined metrics %d and %d", weighted.Hits.Load(), basic.hits)
+	}
+
+	negative := &negativemetrics{}
+	n := SampledMetrics(negative, 0.5).(NegativeMetrics)
+	for i := 0; i < 3; i++ {
+		n.MissingHit()
+		n.ErrorHit()
+	}
+	if negative.missinghits != 2 || negative.errorhits != 2 {
+		t.Error("Unexpected negative metrics")
+	}
+
+	extended := &extendedmetrics{}
+	e := SampledMetrics(extended, 0.5).(ExtendedMetrics)
+	for i := 0; i < 4; i++ {
+		e.Latency(OpGet, time.Millisecond)
+		e.Evicted(EvictCapacity, time.Second, 0)
+	}
+	if extended.latencies[OpGet] != 2 || len(extended.evictions) != 4 {
+		t.Error("Unexpected extended metrics")
+	}
+}
@@ -0,0 +1,220 @@
+package prehit
+
+import "sync"
+
+const (
+	mrcmodulus = 1 << 24 // hash space of spatial sampling
+	mrcfactor  = 4       // the largest estimated size relative to max size
+)
+
+// mrcfactors are estimated sizes relative to the max size of the cache.
+var mrcfactors = []float64{0.5, 1, 2, 4}
+
+// CurvePoint is an estimated hit ratio of the cache with the given max size.
+type CurvePoint struct {
+	Size     uint
+	HitRatio float64
+}
+
+// mrc estimates the miss ratio curve with spatially hashed sampling (SHARDS).
+// Only keys with hash mod P below T = rate*P are tracked, so the sampled stream behaves
+// like a cache of rate*size items. Sampled ghost keys, which may be far beyond the resident
+// set, are kept with the time of their last access: the reuse distance of an access is
+// the number of keys accessed after the previous access of its key, counted in O(log n)
+// by a Fenwick tree over access times. Arrays of times grow with the number of tracked keys.
+type mrc struct {
+	mutex     sync.Mutex
+	rate      float64
+	threshold uint64
+	last      map[uint64]int // time of the last access of the key
+	keys      []uint64       // keys by access time
+	live      []bool         // the time is the last access of its key
+	tree      fenwick        // number of live times
+	clock     int            // the next access time
+	oldest    int            // times before it are not live
+	bound     int            // max number of keys, it follows the max size of the cache
+	histogram []uint64       // number of accesses with the reuse distance (in sampled keys)
+	accesses  uint64         // number of sampled accesses, including cold ones
+}
+
+func newmrc(rate float64, maxsize uint) *mrc {
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+	bound := mrcbound(rate, maxsize)
+	return &mrc{
+		rate:      rate,
+		threshold: uint64(rate * mrcmodulus),
+		last:      make(map[uint64]int),
+		bound:     bound,
+		histogram: make([]uint64, bound),
+	}
+}
+
+// mrcbound returns the number of sampled keys tracked for the max size of the cache.
+func mrcbound(rate float64, maxsize uint) int {
+	return int(float64(maxsize)*mrcfactor*rate) + 1
+}
+
+// resize changes the number of tracked keys for the new max size of the cache.
+// Keys beyond the smaller bound are forgotten, collected distances are kept.
+func (m *mrc) resize(maxsize uint) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.bound = mrcbound(m.rate, maxsize)
+	if m.bound > len(m.histogram) {
+		m.histogram = append(m.histogram, make([]uint64, m.bound-len(m.histogram))...)
+	}
+	for len(m.last) > m.bound {
+		m.forget()
+	}
+}
+
+// access records an access to the key with the hash.
+func (m *mrc) access(hash uint64) {
+	if hash%mrcmodulus >= m.threshold { // not sampled
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.accesses++
+	if at, found := m.last[hash]; found {
+		m.histogram[m.tree.sum(m.clock)-m.tree.sum(at+1)]++
+		m.live[at] = false
+		m.tree.add(at, -1)
+	} // else cold access or reuse beyond the bound
+
+	if m.clock == len(m.keys) {
+		m.renumber()
+	}
+	m.keys[m.clock], m.live[m.clock] = hash, true
+	m.tree.add(m.clock, 1)
+	m.last[hash] = m.clock
+	m.clock++
+
+	if len(m.last) > m.bound {
+		m.forget()
+	}
+}
+
+// forget forgets the least recently accessed key.
+func (m *mrc) forget() {
+	for !m.live[m.oldest] {
+		m.oldest++
+	}
+	m.live[m.oldest] = false
+	m.tree.add(m.oldest, -1)
+	delete(m.last, m.keys[m.oldest])
+}
+
+// renumber moves live times to the beginning keeping their order. Arrays of times are
+// reallocated to leave room for as many accesses as there are live times, so they grow
+// with the number of tracked keys and shrink after it drops.
+func (m *mrc) renumber() {
+	n := 0
+	for at := m.oldest; at < m.clock; at++ {
+		if m.live[at] {
+			m.live[at] = false
+			m.keys[n], m.live[n] = m.keys[at], true
+			m.last[m.keys[n]] = n
+			n++
+		}
+	}
+
+	if times := 2 * (n + 1); times > len(m.keys) || 4*times < len(m.keys) {
+		keys, live := make([]uint64, times), make([]bool, times)
+		copy(keys, m.keys[:n])
+		copy(live, m.live[:n])
+		m.keys, m.live, m.tree = keys, live, make(fenwick, times)
+	} else {
+		for i := range m.tree {
+			m.tree[i] = 0
+		}
+	}
+	for at := 0; at < n; at++ {
+		m.tree.add(at, 1)
+	}
+	m.clock, m.oldest = n, 0
+}
+
+// fenwick is a binary indexed tree of counts.
+type fenwick []int
+
+// add adds the delta to the count at the index.
+func (f fenwick) add(index int, delta int) {
+	for i := index + 1; i <= len(f); i += i & -i {
+		f[i-1] += delta
+	}
+}
+
+// sum returns the total of counts before the index.
+func (f fenwick) sum(index int) int {
+	total := 0
+	for i := index; i > 0; i -= i & -i {
+		total += f[i-1]
+	}
+	return total
+}
+
+// curve returns estimated hit ratios for the sizes relative to the max size.
+func (m *mrc) curve(maxsize uint) []CurvePoint {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	points := make([]CurvePoint, 0, len(mrcfactors))
+	for _, factor := range mrcfactors {
+		size := uint(float64(maxsize) * factor)
+		point := CurvePoint{Size: size}
+		if m.accesses > 0 {
+			// an access hits in an LRU cache of the size if its scaled reuse distance is smaller
+			var hits uint64
+			for distance, count := range m.histogram {
+				if float64(distance)/m.rate < float64(size) {
+					hits += count
+				}
+			}
+			point.HitRatio = float64(hits) / float64(m.accesses)
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// reset forgets the collected accesses.
+func (m *mrc) reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.last = make(map[uint64]int)
+	m.keys, m.live, m.tree = nil, nil, nil
+	m.clock, m.oldest = 0, 0
+	for i := range m.histogram {
+		m.histogram[i] = 0
+	}
+	m.accesses = 0
+}
+
+// MissRatioCurve returns the estimated hit ratios the cache would achieve with 0.5x, 1x, 2x
+// and 4x of its current max size, based on lookups since the creation or the last reset.
+// It returns nil unless the cache was created with WithMissRatioCurve.
+func (c *Cache[K, V]) MissRatioCurve() []CurvePoint {
+	if c.mrc == nil {
+		return nil
+	}
+
+	c.mutex.RLock()
+	maxsize := c.maxsize
+	c.mutex.RUnlock()
+
+	return c.mrc.curve(maxsize)
+}
+
+// ResetMissRatioCurve forgets the accesses collected for the miss ratio curve.
+func (c *Cache[K, V]) ResetMissRatioCurve() {
+	if c.mrc != nil {
+		c.mrc.reset()
+	}
+}
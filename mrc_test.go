@@ -0,0 +1,147 @@
+package prehit
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestMRC(t *testing.T) {
+	m := newmrc(1, 4)
+
+	// cyclic access of 3 keys: reuse distance is 2
+	for i := 0; i < 30; i++ {
+		m.access(uint64(i % 3))
+	}
+
+	expected := []CurvePoint{{2, 0}, {4, 0.9}, {8, 0.9}, {16, 0.9}}
+	for i, point := range m.curve(4) {
+		if point.Size != expected[i].Size || math.Abs(point.HitRatio-expected[i].HitRatio) > 1e-9 {
+			t.Errorf("Unexpected curve point %v", point)
+		}
+	}
+
+	// the stack is bounded
+	for i := 0; i < 100; i++ {
+		m.access(uint64(i))
+	}
+	if len(m.last) != m.bound {
+		t.Error("Ghost stack must be bounded")
+	}
+
+	m.reset()
+	if m.accesses != 0 || len(m.last) != 0 || m.curve(4)[1].HitRatio != 0 {
+		t.Error("Reset failed")
+	}
+
+	// invalid rate means no sampling
+	if newmrc(0, 10).rate != 1 {
+		t.Error("Invalid rate must be replaced")
+	}
+}
+
+func TestMRCResize(t *testing.T) {
+	m := newmrc(1, 1000)
+	if len(m.keys) != 0 {
+		t.Error("Times must be allocated on demand")
+	}
+	for i := 0; i < 10; i++ {
+		m.access(uint64(i))
+	}
+	if len(m.keys) > 64 {
+		t.Errorf("Unexpected %d times for 10 keys", len(m.keys))
+	}
+
+	// the bound follows the max size
+	m.resize(1)
+	if m.bound != 5 || len(m.last) != 5 {
+		t.Errorf("Unexpected bound %d with %d keys", m.bound, len(m.last))
+	}
+	m.resize(10)
+	for i := 0; i < 100; i++ {
+		m.access(uint64(i))
+	}
+	if m.bound != 41 || len(m.last) != 41 || len(m.histogram) != 4001 {
+		t.Errorf("Unexpected bound %d with %d keys", m.bound, len(m.last))
+	}
+
+	// the cache resizes its curve
+	c := NewCache[int, int](WithMaxSize(10), WithMissRatioCurve(1))
+	c.Resize(100)
+	if c.mrc.bound != 401 {
+		t.Errorf("Unexpected bound %d", c.mrc.bound)
+	}
+}
+
+func TestMRCDistances(t *testing.T) {
+	m := newmrc(1, 16)
+
+	// reuse distances match an LRU stack, also after times are renumbered
+	var stack []uint64
+	histogram := make([]uint64, m.bound)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		key := uint64(random.Intn(2 * m.bound))
+		m.access(key)
+
+		for distance, k := range stack {
+			if k == key {
+				histogram[distance]++
+				stack = append(stack[:distance], stack[distance+1:]...)
+				break
+			}
+		}
+		stack = append([]uint64{key}, stack...)
+		if len(stack) > m.bound {
+			stack = stack[:m.bound]
+		}
+	}
+
+	for distance, count := range histogram {
+		if m.histogram[distance] != count {
+			t.Fatalf("Distance %d: expected %d accesses, got %d", distance, count, m.histogram[distance])
+		}
+	}
+}
+
+func TestCacheMissRatioCurve(t *testing.T) {
+	const size = 1000
+	c := NewCache[int, int](WithMaxSize(size), WithMissRatioCurve(0.1))
+
+	// uniform access to 2*size keys in cache-aside manner
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200000; i++ {
+		key := random.Intn(2 * size)
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, key, time.Hour)
+		}
+	}
+
+	st := c.Stats()
+	curve := c.MissRatioCurve()
+	if len(curve) != 4 || curve[1].Size != size {
+		t.Fatalf("Unexpected curve %v", curve)
+	}
+
+	// the estimation at the current size follows the real hit ratio
+	if math.Abs(curve[1].HitRatio-st.HitRatio) > 0.05 {
+		t.Errorf("Estimated hit ratio %f is far from real %f", curve[1].HitRatio, st.HitRatio)
+	}
+
+	// the working set fits into 2x and 4x
+	if curve[0].HitRatio > curve[1].HitRatio || curve[2].HitRatio < 0.95 || curve[3].HitRatio < 0.95 {
+		t.Errorf("Unexpected curve %v", curve)
+	}
+
+	c.ResetMissRatioCurve()
+	if c.MissRatioCurve()[1].HitRatio != 0 {
+		t.Error("Reset failed")
+	}
+
+	c = NewCache[int, int]()
+	c.ResetMissRatioCurve()
+	if c.MissRatioCurve() != nil {
+		t.Error("Curve must be nil without estimation")
+	}
+}
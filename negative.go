@@ -0,0 +1,36 @@
+package prehit
+
+// Status is a state of a key returned by Cache.Lookup.
+type Status int
+
+const (
+	// Unknown means the key is not in the cache.
+	Unknown Status = iota
+	// Found means the value of the key is in the cache.
+	Found
+	// Missing means the key is known to be missing (stored by SetMissing).
+	Missing
+	// Failed means loading of the key failed recently (stored by SetError).
+	Failed
+)
+
+// String returns the name of the status.
+func (s Status) String() string {
+	switch s {
+	case Found:
+		return "found"
+	case Missing:
+		return "missing"
+	case Failed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// NegativeMetrics is an optional extension of Metrics for negative entries.
+// It is used when the value passed to WithMetrics implements it.
+type NegativeMetrics interface {
+	MissingHit()
+	ErrorHit()
+}
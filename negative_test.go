@@ -0,0 +1,101 @@
+package prehit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type negativemetrics struct {
+	basicmetrics
+	missinghits int
+	errorhits   int
+}
+
+func (m *negativemetrics) MissingHit() {
+	m.missinghits++
+}
+func (m *negativemetrics) ErrorHit() {
+	m.errorhits++
+}
+
+func TestCacheLookup(t *testing.T) {
+	metrics := &negativemetrics{}
+	c := NewCache[string, int](WithMaxSize(20), WithMetrics(metrics), WithErrorTTL(time.Second))
+	failure := errors.New("backend failure")
+
+	c.Set("value", 1, time.Second)
+	c.SetMissing("missing", time.Second)
+	c.SetError("error", failure)
+
+	if v, status, err := c.Lookup("value"); v != 1 || status != Found || err != nil {
+		t.Error("Cache lookup of value failed")
+	}
+
+	if v, status, err := c.Lookup("missing"); v != 0 || status != Missing || err != nil {
+		t.Error("Cache lookup of missing key failed")
+	}
+
+	if v, status, err := c.Lookup("error"); v != 0 || status != Failed || err != failure {
+		t.Error("Cache lookup of error failed")
+	}
+
+	if v, status, err := c.Lookup("unknown"); v != 0 || status != Unknown || err != nil {
+		t.Error("Cache lookup of unknown key failed")
+	}
+
+	// Get does not report negative entries
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Cache get of missing key failed")
+	}
+
+	if metrics.hits != 1 || metrics.miss != 1 || metrics.missinghits != 2 || metrics.errorhits != 1 {
+		t.Error("Cache metrics failed")
+	}
+
+	if metrics.count != 3 {
+		t.Error("Cache metrics count failed")
+	}
+
+	// Value replaces negative entry
+	c.Set("missing", 2, time.Second)
+	if v, status, _ := c.Lookup("missing"); v != 2 || status != Found {
+		t.Error("Cache set over missing key failed")
+	}
+
+	// Negative entry replaces value
+	c.SetMissing("value", time.Second)
+	if _, status, _ := c.Lookup("value"); status != Missing {
+		t.Error("Cache set missing over value failed")
+	}
+
+	if metrics.updates != 2 {
+		t.Error("Cache metrics updates failed")
+	}
+}
+
+func TestCacheSetError(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20))
+
+	// errors are not cached without error TTL
+	c.SetError("error", errors.New("backend failure"))
+	if _, status, _ := c.Lookup("error"); status != Unknown {
+		t.Error("Cache must not store errors without error TTL")
+	}
+
+	c = NewCache[string, int](WithMaxSize(20), WithErrorTTL(time.Millisecond))
+	c.SetError("error", errors.New("backend failure"))
+	time.Sleep(2 * time.Millisecond)
+
+	if _, status, err := c.Lookup("error"); status != Unknown || err != nil {
+		t.Error("Cached error must expire")
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	for status, name := range map[Status]string{Unknown: "unknown", Found: "found", Missing: "missing", Failed: "failed"} {
+		if status.String() != name {
+			t.Error("Status string failed")
+		}
+	}
+}
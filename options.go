@@ -1,12 +1,77 @@
 package prehit
 
-import "go.melnyk.org/mlog"
+import (
+	"math"
+	"time"
+
+	"go.melnyk.org/mlog"
+	"go.melnyk.org/prehit/invalidation"
+	"go.melnyk.org/prehit/trace"
+)
 
 // Options
 type options struct {
 	logger  mlog.Logger
 	maxsize uint
 	metrics Metrics
+
+	segments    uint
+	segmentsize uint
+
+	autosize *autosize
+	errorttl time.Duration
+	beta     float64
+	cost     any
+	hotkeys  int
+	mrcrate  float64
+	tracer   *trace.Writer
+	name     string
+	registry *Registry
+
+	validation bool
+	evicted    any
+
+	spillmax     uint64
+	spillsegment uint64
+
+	store       *storeconfig
+	storeerrors any
+	maxpending  uint
+
+	bus      invalidation.Bus
+	keycodec any
+}
+
+// cacheonly returns the names of set options honoured only by Cache,
+// other caches warn about them.
+func (opts *options) cacheonly() []string {
+	var names []string
+	for _, o := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.autosize != nil, "WithAutoSize"},
+		{opts.errorttl != 0, "WithErrorTTL"},
+		{opts.beta != 0, "WithEarlyExpiration"},
+		{opts.cost != nil, "WithCost"},
+		{opts.hotkeys != 0, "WithHotKeys"},
+		{opts.mrcrate != 0, "WithMissRatioCurve"},
+		{opts.tracer != nil, "WithTrace"},
+		{opts.name != "", "WithName"},
+		{opts.registry != nil, "WithRegistry"},
+		{opts.validation, "WithValidation"},
+		{opts.evicted != nil, "WithEvictCallback"},
+		{opts.spillmax != 0 || opts.spillsegment != 0, "WithSpillLimits"},
+		{opts.store != nil, "WithWriteThrough/WithWriteBehind"},
+		{opts.storeerrors != nil, "WithStoreErrorHandler"},
+		{opts.maxpending != 0, "WithMaxPending"},
+		{opts.bus != nil, "WithInvalidation"},
+	} {
+		if o.set {
+			names = append(names, o.name)
+		}
+	}
+	return names
 }
 
 // Options is a set of options for the prehit package.
@@ -50,3 +115,290 @@ func (o metricsOption) apply(opts *options) {
 func WithMetrics(metrics Metrics) Option {
 	return metricsOption{metrics: metrics}
 }
+
+type arenaOption struct {
+	segments    uint
+	segmentsize uint
+}
+
+func (o arenaOption) apply(opts *options) {
+	opts.segments = o.segments
+	opts.segmentsize = o.segmentsize
+}
+
+// WithArena sets the number and the size (in bytes) of arena segments for BytesCache.
+// Zero values are replaced by defaults (16 segments of 1 MiB). Entries are located by 32-bit
+// offsets, so the segment size is clamped to 4 GiB - 1.
+func WithArena(segments uint, segmentsize uint) Option {
+	if segments == 0 {
+		segments = defaultsegments
+	}
+	if segmentsize == 0 {
+		segmentsize = defaultsegmentsize
+	}
+	if segmentsize > math.MaxUint32 {
+		segmentsize = math.MaxUint32
+	}
+	return arenaOption{segments: segments, segmentsize: segmentsize}
+}
+
+type autosizeOption struct {
+	min      uint
+	max      uint
+	interval time.Duration
+}
+
+func (o autosizeOption) apply(opts *options) {
+	opts.autosize = &autosize{
+		min:      o.min,
+		max:      o.max,
+		interval: o.interval,
+		usage:    memoryusage,
+	}
+}
+
+// WithAutoSize enables memory-pressure-aware sizing of the cache.
+// Every interval the heap usage is compared with the process memory limit (GOMEMLIMIT)
+// and the effective max size is adjusted between min and max, evicting items from the tail.
+// The max bound replaces the value set by WithMaxSize. Sizing is stopped by Cache.Close.
+func WithAutoSize(min uint, max uint, interval time.Duration) Option {
+	if min > max {
+		min, max = max, min
+	}
+	return autosizeOption{min: min, max: max, interval: interval}
+}
+
+type errorttlOption time.Duration
+
+func (o errorttlOption) apply(opts *options) {
+	opts.errorttl = time.Duration(o)
+}
+
+// WithErrorTTL enables caching of loader errors by Cache.SetError for the given TTL.
+// It is expected to be shorter than TTLs of regular values.
+func WithErrorTTL(ttl time.Duration) Option {
+	return errorttlOption(ttl)
+}
+
+type earlyexpirationOption float64
+
+func (o earlyexpirationOption) apply(opts *options) {
+	opts.beta = float64(o)
+}
+
+// WithEarlyExpiration enables probabilistic early expiration (XFetch) for Cache.GetEarly.
+// Beta above 1.0 favors earlier recomputation, below 1.0 favors later one; 1.0 is a good default.
+func WithEarlyExpiration(beta float64) Option {
+	return earlyexpirationOption(beta)
+}
+
+type costOption struct {
+	cost any
+}
+
+func (o costOption) apply(opts *options) {
+	opts.cost = o.cost
+}
+
+// WithCost sets the function calculating the cost of a value (for example, its size in bytes).
+// The cost is reported to ExtendedMetrics on eviction. The value type must match the cache.
+func WithCost[V any](cost func(V) uint64) Option {
+	return costOption{cost: cost}
+}
+
+type hotkeysOption int
+
+func (o hotkeysOption) apply(opts *options) {
+	opts.hotkeys = int(o)
+}
+
+// WithHotKeys enables tracking of the keys with the most hits, misses and writes.
+// Every kind of traffic is tracked by capacity counters (Space-Saving algorithm),
+// so the memory is bounded and top keys are reliable for keys beyond noise.
+// The report is returned by Cache.HotKeys.
+func WithHotKeys(capacity int) Option {
+	return hotkeysOption(capacity)
+}
+
+type mrcOption float64
+
+func (o mrcOption) apply(opts *options) {
+	opts.mrcrate = float64(o)
+}
+
+// WithMissRatioCurve enables estimation of hit ratios for other cache sizes.
+// Lookups of the sampled part (rate) of keys are tracked beyond the resident set
+// and reported by Cache.MissRatioCurve. The rate of 0.01 is enough for large caches,
+// small caches need higher rates for precise estimations. Up to rate*4*max size keys
+// are tracked, the limit follows Resize and autosizing.
+func WithMissRatioCurve(rate float64) Option {
+	return mrcOption(rate)
+}
+
+type traceOption struct {
+	tracer *trace.Writer
+}
+
+func (o traceOption) apply(opts *options) {
+	opts.tracer = o.tracer
+}
+
+// WithTrace enables recording of Get, Set and Delete calls with hashed keys into the trace.
+// Values rejected by Add and Replace are not recorded. The trace can be replayed by
+// cmd/prehit-sim. The caller flushes the writer.
+func WithTrace(w *trace.Writer) Option {
+	return traceOption{tracer: w}
+}
+
+type nameOption string
+
+func (o nameOption) apply(opts *options) {
+	opts.name = string(o)
+}
+
+// WithName registers the cache under the name in DefaultRegistry or in the registry
+// set by WithRegistry. The cache is deregistered by Cache.Close.
+// A name already used in the registry is logged and the cache is not registered.
+func WithName(name string) Option {
+	return nameOption(name)
+}
+
+type registryOption struct {
+	registry *Registry
+}
+
+func (o registryOption) apply(opts *options) {
+	opts.registry = o.registry
+}
+
+// WithRegistry sets the registry for the cache named by WithName.
+func WithRegistry(r *Registry) Option {
+	return registryOption{registry: r}
+}
+
+type validationOption bool
+
+func (o validationOption) apply(opts *options) {
+	opts.validation = bool(o)
+}
+
+// WithValidation enables validation of the cache structure after every mutation.
+// The cache panics on the first inconsistency. It is slow and intended for tests.
+func WithValidation(enabled bool) Option {
+	return validationOption(enabled)
+}
+
+type evictcallbackOption struct {
+	evicted any
+}
+
+func (o evictcallbackOption) apply(opts *options) {
+	opts.evicted = o.evicted
+}
+
+// WithEvictCallback sets the function called for every value evicted by capacity or expiration
+// with the expiration time of the value. Negative entries are not reported.
+// The callback runs under the cache lock, so it must be fast and must not call the cache.
+// The key and value types must match the cache.
+func WithEvictCallback[K comparable, V any](evicted func(key K, value V, reason EvictReason, expiration time.Time)) Option {
+	return evictcallbackOption{evicted: evicted}
+}
+
+type spillOption struct {
+	max     uint64
+	segment uint64
+}
+
+func (o spillOption) apply(opts *options) {
+	opts.spillmax = o.max
+	opts.spillsegment = o.segment
+}
+
+// WithSpillLimits sets the max size of the disk tier of SpillCache and the size of its
+// segment files in bytes. Zero values are replaced by defaults (1 GiB in 64 MiB segments).
+func WithSpillLimits(max uint64, segment uint64) Option {
+	if max == 0 {
+		max = defaultspillmax
+	}
+	if segment == 0 {
+		segment = defaultspillsegment
+	}
+	return spillOption{max: max, segment: segment}
+}
+
+type storeOption struct {
+	config storeconfig
+}
+
+func (o storeOption) apply(opts *options) {
+	config := o.config
+	opts.store = &config
+}
+
+// WithWriteThrough sets the store written synchronously by Set and Delete.
+// Changes of the same key are serialized, so the store and the cache get them in the same order.
+// The cache is not changed by Set when the write fails, failures are reported to the handler
+// set by WithStoreErrorHandler. The key and value types must match the cache.
+func WithWriteThrough[K comparable, V any](store Store[K, V]) Option {
+	return storeOption{config: storeconfig{store: store}}
+}
+
+// WithWriteBehind sets the store written asynchronously: changes land in the cache immediately,
+// are coalesced per key and written in batches every interval or when the batch is collected.
+// Failed writes are retried, dirty entries are not evicted before they are written, and pending
+// changes are flushed by Cache.Close. The key and value types must match the cache.
+func WithWriteBehind[K comparable, V any](store Store[K, V], interval time.Duration, batch int) Option {
+	if batch <= 0 {
+		batch = 1
+	}
+	return storeOption{config: storeconfig{store: store, behind: true, interval: interval, batch: batch}}
+}
+
+type storeErrorsOption struct {
+	handler any
+}
+
+func (o storeErrorsOption) apply(opts *options) {
+	opts.storeerrors = o.handler
+}
+
+// WithStoreErrorHandler sets the handler of failed store writes: write-through and write-behind
+// errors and changes rejected by WithMaxPending (ErrPendingLimit). The handler is called without
+// the cache lock held. The key type must match the cache.
+func WithStoreErrorHandler[K comparable](handler func(keys []K, err error)) Option {
+	return storeErrorsOption{handler: handler}
+}
+
+type maxPendingOption uint
+
+func (o maxPendingOption) apply(opts *options) {
+	opts.maxpending = uint(o)
+}
+
+// WithMaxPending sets the max number of changes waiting for write-behind. Dirty items are not
+// evicted, so when the limit is reached, Set and Delete of other keys are rejected with
+// ErrPendingLimit until write-behind catches up. Zero (default) means the max size of the cache.
+func WithMaxPending(n uint) Option {
+	return maxPendingOption(n)
+}
+
+type invalidationOption struct {
+	bus      invalidation.Bus
+	keycodec any
+}
+
+func (o invalidationOption) apply(opts *options) {
+	opts.bus = o.bus
+	opts.keycodec = o.keycodec
+}
+
+// WithInvalidation connects the cache to the invalidation bus: local Set, Delete and Reset
+// publish events asynchronously, and events of other caches remove the keys or clear the cache
+// locally without writing to the store. The codec may be nil for string keys.
+func WithInvalidation[K comparable](bus invalidation.Bus, codec KeyCodec[K]) Option {
+	o := invalidationOption{bus: bus}
+	if codec != nil {
+		o.keycodec = codec
+	}
+	return o
+}
@@ -1,9 +1,13 @@
 package prehit
 
 import (
+	"io"
+	"math"
 	"testing"
+	"time"
 
 	"go.melnyk.org/mlog/nolog"
+	"go.melnyk.org/prehit/trace"
 )
 
 func TestWithLogger(t *testing.T) {
@@ -41,3 +45,218 @@ func TestWithMetrics(t *testing.T) {
 		t.Error("Expected metrics to be set")
 	}
 }
+
+func TestWithArena(t *testing.T) {
+	o := WithArena(4, 1024)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.segments != 4 || local.segmentsize != 1024 {
+		t.Error("Expected arena to be set")
+	}
+
+	WithArena(0, 0).apply(local)
+
+	if local.segments != defaultsegments || local.segmentsize != defaultsegmentsize {
+		t.Error("Expected default arena to be set")
+	}
+
+	// offsets are 32-bit
+	WithArena(1, ^uint(0)).apply(local)
+
+	if local.segmentsize != math.MaxUint32 {
+		t.Error("Expected segment size to be clamped")
+	}
+}
+
+func TestWithAutoSize(t *testing.T) {
+	o := WithAutoSize(10, 100, time.Second)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.autosize == nil || local.autosize.min != 10 || local.autosize.max != 100 || local.autosize.interval != time.Second {
+		t.Error("Expected auto size to be set")
+	}
+
+	if local.autosize.usage == nil {
+		t.Error("Expected memory usage reader to be set")
+	}
+}
+
+func TestWithErrorTTL(t *testing.T) {
+	o := WithErrorTTL(time.Second)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.errorttl != time.Second {
+		t.Error("Expected error TTL to be set")
+	}
+}
+
+func TestWithEarlyExpiration(t *testing.T) {
+	o := WithEarlyExpiration(1.5)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.beta != 1.5 {
+		t.Error("Expected beta to be set")
+	}
+}
+
+func TestWithCost(t *testing.T) {
+	o := WithCost(func(v []byte) uint64 { return uint64(len(v)) })
+
+	local := &options{}
+	o.apply(local)
+
+	if cost, ok := local.cost.(func([]byte) uint64); !ok || cost([]byte("test")) != 4 {
+		t.Error("Expected cost to be set")
+	}
+}
+
+func TestWithHotKeys(t *testing.T) {
+	o := WithHotKeys(100)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.hotkeys != 100 {
+		t.Error("Expected hot keys capacity to be set")
+	}
+}
+
+func TestWithMissRatioCurve(t *testing.T) {
+	o := WithMissRatioCurve(0.1)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.mrcrate != 0.1 {
+		t.Error("Expected miss ratio curve rate to be set")
+	}
+}
+
+func TestWithTrace(t *testing.T) {
+	w := trace.NewWriter(io.Discard)
+	o := WithTrace(w)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.tracer != w {
+		t.Error("Expected trace writer to be set")
+	}
+}
+
+func TestWithName(t *testing.T) {
+	o := WithName("users")
+
+	local := &options{}
+	o.apply(local)
+
+	if local.name != "users" {
+		t.Error("Expected name to be set")
+	}
+}
+
+func TestWithRegistry(t *testing.T) {
+	r := NewRegistry()
+	o := WithRegistry(r)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.registry != r {
+		t.Error("Expected registry to be set")
+	}
+}
+
+func TestWithValidation(t *testing.T) {
+	o := WithValidation(true)
+
+	local := &options{}
+	o.apply(local)
+
+	if !local.validation {
+		t.Error("Expected validation to be enabled")
+	}
+}
+
+func TestWithEvictCallback(t *testing.T) {
+	o := WithEvictCallback(func(string, int, EvictReason, time.Time) {})
+
+	local := &options{}
+	o.apply(local)
+
+	if _, ok := local.evicted.(func(string, int, EvictReason, time.Time)); !ok {
+		t.Error("Expected evict callback to be set")
+	}
+}
+
+func TestWithSpillLimits(t *testing.T) {
+	o := WithSpillLimits(1000, 100)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.spillmax != 1000 || local.spillsegment != 100 {
+		t.Error("Expected spill limits to be set")
+	}
+
+	o = WithSpillLimits(0, 0)
+	o.apply(local)
+
+	if local.spillmax != defaultspillmax || local.spillsegment != defaultspillsegment {
+		t.Error("Expected default spill limits")
+	}
+}
+
+func TestWithWriteThrough(t *testing.T) {
+	o := WithWriteThrough[string, int](&memorystore[string, int]{})
+
+	local := &options{}
+	o.apply(local)
+
+	if local.store == nil || local.store.behind {
+		t.Error("Expected write-through store to be set")
+	}
+}
+
+func TestWithWriteBehind(t *testing.T) {
+	o := WithWriteBehind[string, int](&memorystore[string, int]{}, time.Second, 0)
+
+	local := &options{}
+	o.apply(local)
+
+	if local.store == nil || !local.store.behind || local.store.interval != time.Second || local.store.batch != 1 {
+		t.Error("Expected write-behind store to be set")
+	}
+}
+
+func TestCacheOnly(t *testing.T) {
+	local := &options{}
+	for _, o := range []Option{WithMaxSize(10), WithErrorTTL(time.Second), WithHotKeys(10), WithArena(1, 1024)} {
+		o.apply(local)
+	}
+
+	names := local.cacheonly()
+	if len(names) != 2 || names[0] != "WithErrorTTL" || names[1] != "WithHotKeys" {
+		t.Errorf("Unexpected options %v", names)
+	}
+
+	// unsupported options are ignored
+	c := NewSlabCache[int, int](WithMaxSize(10), WithHotKeys(10), WithArena(1, 1024))
+	c.Set(1, 1, time.Hour)
+	if v, ok := c.Get(1); !ok || v != 1 {
+		t.Error("Slab cache must work with unsupported options")
+	}
+	b := NewBytesCache(WithHotKeys(10), WithArena(1, 1024))
+	b.Set("a", []byte("a"), time.Hour)
+	if v, ok := b.Get("a"); !ok || string(v) != "a" {
+		t.Error("Bytes cache must work with unsupported options")
+	}
+}
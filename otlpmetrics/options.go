@@ -0,0 +1,57 @@
+package otlpmetrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Options
+type options struct {
+	client   *http.Client
+	interval time.Duration
+	service  string
+}
+
+// Option is a set of options for the exporter.
+type Option interface {
+	apply(*options)
+}
+
+type clientOption struct {
+	client *http.Client
+}
+
+func (o clientOption) apply(opts *options) {
+	opts.client = o.client
+}
+
+// WithHTTPClient sets the HTTP client used for pushes.
+func WithHTTPClient(client *http.Client) Option {
+	return clientOption{client: client}
+}
+
+type intervalOption time.Duration
+
+func (o intervalOption) apply(opts *options) {
+	opts.interval = time.Duration(o)
+}
+
+// WithInterval sets the period of pushes started by Exporter.Start.
+// A non-positive interval is replaced by the default (1 minute).
+func WithInterval(interval time.Duration) Option {
+	if interval <= 0 {
+		interval = defaultinterval
+	}
+	return intervalOption(interval)
+}
+
+type serviceOption string
+
+func (o serviceOption) apply(opts *options) {
+	opts.service = string(o)
+}
+
+// WithServiceName sets the service.name resource attribute.
+func WithServiceName(name string) Option {
+	return serviceOption(name)
+}
@@ -0,0 +1,290 @@
+// Package otlpmetrics implements prehit.Metrics with atomic counters
+// and pushes them as OTLP/HTTP JSON metric payloads to a collector.
+package otlpmetrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.melnyk.org/prehit/internal/counters"
+)
+
+const (
+	// pushtimeout limits a single push started by Start or Close.
+	pushtimeout = 10 * time.Second
+	// defaultinterval is the push interval used without WithInterval.
+	defaultinterval = time.Minute
+)
+
+// Counters is a prehit.Metrics (and prehit.NegativeMetrics) implementation for a named cache.
+type Counters struct {
+	counters.Counters
+	name string
+}
+
+// Name returns the cache name used as the metric attribute.
+func (c *Counters) Name() string {
+	return c.name
+}
+
+// metric is a single metric pushed for every cache.
+type metric struct {
+	name        string
+	description string
+	monotonic   bool
+	value       func(*Counters) uint64
+}
+
+var metrics = []metric{
+	{"prehit.hits", "Number of cache hits.", true, func(c *Counters) uint64 { return c.Hits.Load() }},
+	{"prehit.misses", "Number of cache misses.", true, func(c *Counters) uint64 { return c.Misses.Load() }},
+	{"prehit.missing_hits", "Number of hits of keys known to be missing.", true, func(c *Counters) uint64 { return c.MissingHits.Load() }},
+	{"prehit.error_hits", "Number of hits of cached errors.", true, func(c *Counters) uint64 { return c.ErrorHits.Load() }},
+	{"prehit.errors", "Number of cache structure errors.", true, func(c *Counters) uint64 { return c.Errors.Load() }},
+	{"prehit.adds", "Number of added items.", true, func(c *Counters) uint64 { return c.Adds.Load() }},
+	{"prehit.updates", "Number of updated items.", true, func(c *Counters) uint64 { return c.Updates.Load() }},
+	{"prehit.evictions", "Number of evicted items.", true, func(c *Counters) uint64 { return c.Evictions.Load() }},
+	{"prehit.deletes", "Number of deleted items.", true, func(c *Counters) uint64 { return c.Deletes.Load() }},
+	{"prehit.items", "Number of items in the cache.", false, func(c *Counters) uint64 { return c.Items() }},
+}
+
+// Exporter pushes counters of named caches to an OTLP/HTTP endpoint.
+type Exporter struct {
+	endpoint string
+	client   *http.Client
+	interval time.Duration
+	service  string
+	start    time.Time
+	mutex    sync.RWMutex
+	caches   map[string]*Counters
+	started  bool // guarded by mutex
+	closed   bool // guarded by mutex
+	done     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+// NewExporter creates a new exporter for the endpoint,
+// for example "http://localhost:4318/v1/metrics".
+func NewExporter(endpoint string, o ...Option) *Exporter {
+	local := &options{
+		client:   http.DefaultClient, // default client
+		interval: defaultinterval,    // default push interval
+		service:  "prehit",           // default service name
+	}
+
+	for _, option := range o {
+		option.apply(local)
+	}
+
+	return &Exporter{
+		endpoint: endpoint,
+		client:   local.client,
+		interval: local.interval,
+		service:  local.service,
+		start:    time.Now(),
+		caches:   make(map[string]*Counters),
+		done:     make(chan struct{}),
+	}
+}
+
+// Metrics returns counters for the cache name, creating them on the first call.
+// The result is intended for prehit.WithMetrics.
+func (e *Exporter) Metrics(name string) *Counters {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if c, found := e.caches[name]; found {
+		return c
+	}
+
+	c := &Counters{name: name}
+	e.caches[name] = c
+	return c
+}
+
+// Start pushes counters periodically until Close.
+// Repeated calls and calls after Close do nothing.
+func (e *Exporter) Start() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.started || e.closed {
+		return
+	}
+	e.started = true
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), pushtimeout)
+				e.Push(ctx) // the next push retries with fresh values
+				cancel()
+			}
+		}
+	}()
+}
+
+// Close stops periodic pushes and pushes the final values.
+func (e *Exporter) Close() error {
+	e.once.Do(func() {
+		e.mutex.Lock()
+		e.closed = true
+		e.mutex.Unlock()
+		close(e.done)
+	})
+	e.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushtimeout)
+	defer cancel()
+	return e.Push(ctx)
+}
+
+// Push sends the current values of all counters to the endpoint.
+func (e *Exporter) Push(ctx context.Context) error {
+	body, err := json.Marshal(e.payload(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp push failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// payload builds the export request with cumulative sums and gauges.
+func (e *Exporter) payload(now time.Time) *request {
+	e.mutex.RLock()
+	caches := make([]*Counters, 0, len(e.caches))
+	for _, c := range e.caches {
+		caches = append(caches, c)
+	}
+	e.mutex.RUnlock()
+
+	sort.Slice(caches, func(i, j int) bool { return caches[i].name < caches[j].name })
+
+	start := strconv.FormatInt(e.start.UnixNano(), 10)
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	list := make([]otlpmetric, 0, len(metrics))
+	for _, m := range metrics {
+		points := make([]datapoint, 0, len(caches))
+		for _, c := range caches {
+			points = append(points, datapoint{
+				Attributes:        []attribute{{Key: "cache", Value: value{StringValue: c.name}}},
+				StartTimeUnixNano: start,
+				TimeUnixNano:      timestamp,
+				AsInt:             strconv.FormatUint(m.value(c), 10),
+			})
+		}
+
+		om := otlpmetric{Name: m.name, Description: m.description, Unit: "1"}
+		if m.monotonic {
+			om.Sum = &sum{DataPoints: points, AggregationTemporality: temporalityCumulative, IsMonotonic: true}
+		} else {
+			om.Gauge = &gauge{DataPoints: points}
+		}
+		list = append(list, om)
+	}
+
+	return &request{
+		ResourceMetrics: []resourcemetrics{{
+			Resource: resource{Attributes: []attribute{{Key: "service.name", Value: value{StringValue: e.service}}}},
+			ScopeMetrics: []scopemetrics{{
+				Scope:   scope{Name: "go.melnyk.org/prehit"},
+				Metrics: list,
+			}},
+		}},
+	}
+}
+
+// OTLP JSON encoding of ExportMetricsServiceRequest (only the used subset).
+const temporalityCumulative = 2
+
+type request struct {
+	ResourceMetrics []resourcemetrics `json:"resourceMetrics"`
+}
+
+type resourcemetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopemetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []attribute `json:"attributes"`
+}
+
+type scopemetrics struct {
+	Scope   scope        `json:"scope"`
+	Metrics []otlpmetric `json:"metrics"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type otlpmetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Sum         *sum   `json:"sum,omitempty"`
+	Gauge       *gauge `json:"gauge,omitempty"`
+}
+
+type sum struct {
+	DataPoints             []datapoint `json:"dataPoints"`
+	AggregationTemporality int         `json:"aggregationTemporality"`
+	IsMonotonic            bool        `json:"isMonotonic"`
+}
+
+type gauge struct {
+	DataPoints []datapoint `json:"dataPoints"`
+}
+
+type datapoint struct {
+	Attributes        []attribute `json:"attributes"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	TimeUnixNano      string      `json:"timeUnixNano"`
+	AsInt             string      `json:"asInt"`
+}
+
+type attribute struct {
+	Key   string `json:"key"`
+	Value value  `json:"value"`
+}
+
+type value struct {
+	StringValue string `json:"stringValue"`
+}
@@ -0,0 +1,176 @@
+package otlpmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+// collector is a local OTLP/HTTP collector recording received requests.
+type collector struct {
+	mutex    sync.Mutex
+	requests []request
+	status   int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.requests = append(c.requests, req)
+
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+	}
+}
+
+func (c *collector) last() request {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.requests[len(c.requests)-1]
+}
+
+func (c *collector) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.requests)
+}
+
+// find returns the value of the metric for the cache.
+func find(req request, name string, cache string) (string, bool) {
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if m.Name != name {
+			continue
+		}
+		points := []datapoint{}
+		if m.Sum != nil {
+			points = m.Sum.DataPoints
+		}
+		if m.Gauge != nil {
+			points = m.Gauge.DataPoints
+		}
+		for _, p := range points {
+			if p.Attributes[0].Key == "cache" && p.Attributes[0].Value.StringValue == cache {
+				return p.AsInt, true
+			}
+		}
+	}
+	return "", false
+}
+
+func TestExporterPush(t *testing.T) {
+	col := &collector{}
+	server := httptest.NewServer(col)
+	defer server.Close()
+
+	e := NewExporter(server.URL+"/v1/metrics", WithServiceName("orders-service"), WithHTTPClient(server.Client()))
+	c := prehit.NewCache[string, int](prehit.WithMaxSize(1), prehit.WithMetrics(e.Metrics("users")))
+	e.Metrics("orders").Miss()
+
+	if e.Metrics("users").Name() != "users" {
+		t.Error("Unexpected counters name")
+	}
+
+	c.Set("a", 1, time.Second)
+	c.Set("b", 2, time.Second)
+	c.Get("b")
+	c.Get("a")
+
+	if err := e.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := col.last()
+	if req.ResourceMetrics[0].Resource.Attributes[0].Value.StringValue != "orders-service" {
+		t.Error("Unexpected service name")
+	}
+
+	for name, expected := range map[string]string{
+		"prehit.hits":      "1",
+		"prehit.misses":    "1",
+		"prehit.adds":      "2",
+		"prehit.evictions": "1",
+		"prehit.items":     "1",
+	} {
+		if v, ok := find(req, name, "users"); !ok || v != expected {
+			t.Errorf("Unexpected %s value %s", name, v)
+		}
+	}
+
+	if v, ok := find(req, "prehit.misses", "orders"); !ok || v != "1" {
+		t.Error("Expected the second cache to be pushed")
+	}
+
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if m.Name == "prehit.items" && m.Gauge == nil {
+			t.Error("Expected items to be a gauge")
+		}
+		if m.Name == "prehit.hits" && (m.Sum == nil || !m.Sum.IsMonotonic || m.Sum.AggregationTemporality != temporalityCumulative) {
+			t.Error("Expected hits to be a cumulative monotonic sum")
+		}
+	}
+
+	col.mutex.Lock()
+	col.status = http.StatusInternalServerError
+	col.mutex.Unlock()
+	if err := e.Push(context.Background()); err == nil {
+		t.Error("Expected push error")
+	}
+}
+
+func TestExporterStart(t *testing.T) {
+	col := &collector{}
+	server := httptest.NewServer(col)
+	defer server.Close()
+
+	e := NewExporter(server.URL+"/v1/metrics", WithInterval(time.Millisecond))
+	e.Metrics("users").Hit()
+	e.Start()
+	e.Start() // repeated start does nothing
+	time.Sleep(20 * time.Millisecond)
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// start after close does not push
+	pushes := col.count()
+	e.Start()
+	time.Sleep(10 * time.Millisecond)
+	if col.count() != pushes {
+		t.Error("Start after Close must not push")
+	}
+
+	if col.count() < 2 {
+		t.Error("Expected periodic pushes")
+	}
+
+	if v, ok := find(col.last(), "prehit.hits", "users"); !ok || v != "1" {
+		t.Error("Expected final push")
+	}
+}
+
+func TestExporterInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		e := NewExporter("http://localhost/v1/metrics", WithInterval(interval))
+		if e.interval != defaultinterval {
+			t.Errorf("Interval %v: expected the default, got %v", interval, e.interval)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package prommetrics implements prehit.Metrics with atomic counters
+// and exposes them in the Prometheus text exposition format.
+package prommetrics
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.melnyk.org/prehit/internal/counters"
+)
+
+// Counters is a prehit.Metrics (and prehit.NegativeMetrics) implementation for a named cache.
+type Counters struct {
+	counters.Counters
+	name string
+}
+
+// Name returns the cache name used as the label value.
+func (c *Counters) Name() string {
+	return c.name
+}
+
+// family is a single metric family of the exposition.
+type family struct {
+	name  string
+	kind  string
+	help  string
+	value func(*Counters) uint64
+}
+
+var families = []family{
+	{"prehit_hits_total", "counter", "Number of cache hits.", func(c *Counters) uint64 { return c.Hits.Load() }},
+	{"prehit_misses_total", "counter", "Number of cache misses.", func(c *Counters) uint64 { return c.Misses.Load() }},
+	{"prehit_missing_hits_total", "counter", "Number of hits of keys known to be missing.", func(c *Counters) uint64 { return c.MissingHits.Load() }},
+	{"prehit_error_hits_total", "counter", "Number of hits of cached errors.", func(c *Counters) uint64 { return c.ErrorHits.Load() }},
+	{"prehit_errors_total", "counter", "Number of cache structure errors.", func(c *Counters) uint64 { return c.Errors.Load() }},
+	{"prehit_adds_total", "counter", "Number of added items.", func(c *Counters) uint64 { return c.Adds.Load() }},
+	{"prehit_updates_total", "counter", "Number of updated items.", func(c *Counters) uint64 { return c.Updates.Load() }},
+	{"prehit_evictions_total", "counter", "Number of evicted items.", func(c *Counters) uint64 { return c.Evictions.Load() }},
+	{"prehit_deletes_total", "counter", "Number of deleted items.", func(c *Counters) uint64 { return c.Deletes.Load() }},
+	{"prehit_items", "gauge", "Number of items in the cache.", func(c *Counters) uint64 { return c.Items() }},
+}
+
+// Exporter is a set of named counters served as an http.Handler.
+type Exporter struct {
+	mutex  sync.RWMutex
+	caches map[string]*Counters
+}
+
+// NewExporter creates a new exporter.
+func NewExporter() *Exporter {
+	return &Exporter{
+		caches: make(map[string]*Counters),
+	}
+}
+
+// Metrics returns counters for the cache name, creating them on the first call.
+// The result is intended for prehit.WithMetrics.
+func (e *Exporter) Metrics(name string) *Counters {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if c, found := e.caches[name]; found {
+		return c
+	}
+
+	c := &Counters{name: name}
+	e.caches[name] = c
+	return c
+}
+
+// Remove stops exporting counters of the cache name.
+func (e *Exporter) Remove(name string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	delete(e.caches, name)
+}
+
+// ServeHTTP writes all counters in the Prometheus text format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mutex.RLock()
+	caches := make([]*Counters, 0, len(e.caches))
+	for _, c := range e.caches {
+		caches = append(caches, c)
+	}
+	e.mutex.RUnlock()
+
+	sort.Slice(caches, func(i, j int) bool { return caches[i].name < caches[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		out.WriteString("# HELP " + f.name + " " + f.help + "\n")
+		out.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+		for _, c := range caches {
+			out.WriteString(f.name + `{cache="` + escape(c.name) + `"} `)
+			out.WriteString(strconv.FormatUint(f.value(c), 10))
+			out.WriteString("\n")
+		}
+	}
+	out.Flush()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape escapes the label value according to the text format.
+func escape(value string) string {
+	return escaper.Replace(value)
+}
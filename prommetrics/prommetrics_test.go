@@ -0,0 +1,77 @@
+package prommetrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+func TestExporter(t *testing.T) {
+	e := NewExporter()
+	users := prehit.NewCache[string, int](prehit.WithMaxSize(2), prehit.WithMetrics(e.Metrics("users")))
+	orders := prehit.NewCache[string, int](prehit.WithMetrics(e.Metrics(`or"ders`)))
+
+	if e.Metrics("users") != e.Metrics("users") {
+		t.Error("Expected the same counters for the same name")
+	}
+
+	users.Set("a", 1, time.Second)
+	users.Set("a", 1, time.Second)
+	users.Set("b", 2, time.Second)
+	users.Set("c", 3, time.Second)
+	users.Get("c")
+	users.Get("a")
+	users.SetMissing("d", time.Second)
+	users.Lookup("d")
+	orders.Get("a")
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Error("Unexpected content type")
+	}
+
+	for _, line := range []string{
+		"# TYPE prehit_hits_total counter",
+		`prehit_hits_total{cache="users"} 1`,
+		`prehit_misses_total{cache="users"} 1`,
+		`prehit_misses_total{cache="or\"ders"} 1`,
+		`prehit_missing_hits_total{cache="users"} 1`,
+		`prehit_adds_total{cache="users"} 4`,
+		`prehit_updates_total{cache="users"} 1`,
+		`prehit_evictions_total{cache="users"} 2`,
+		`prehit_deletes_total{cache="users"} 2`,
+		"# TYPE prehit_items gauge",
+		`prehit_items{cache="users"} 2`,
+		`prehit_items{cache="or\"ders"} 0`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("Expected %q in the exposition", line)
+		}
+	}
+
+	// caches are sorted by name
+	if strings.Index(text, `prehit_hits_total{cache="or\"ders"}`) > strings.Index(text, `prehit_hits_total{cache="users"}`) {
+		t.Error("Expected caches to be sorted")
+	}
+
+	e.Remove("users")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rec.Body.String(), `cache="users"`) {
+		t.Error("Expected removed cache not to be exported")
+	}
+}
+
+func TestCountersName(t *testing.T) {
+	if NewExporter().Metrics("users").Name() != "users" {
+		t.Error("Unexpected counters name")
+	}
+}
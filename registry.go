@@ -0,0 +1,142 @@
+package prehit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotRegistered is returned by Registry for unknown cache names.
+var ErrNotRegistered = errors.New("cache is not registered")
+
+// Registered is a cache registered by WithName, independent of key and value types.
+type Registered interface {
+	Name() string
+	Stats() Stats
+	Reset() error
+	Resize(size uint)
+	DebugHandler(o ...DebugOption) http.Handler
+}
+
+// Registry is a set of named caches for process-wide observability.
+type Registry struct {
+	mutex  sync.RWMutex
+	caches map[string]Registered
+}
+
+// DefaultRegistry is the registry used by WithName without WithRegistry.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{caches: make(map[string]Registered)}
+}
+
+// register adds the cache, the name of a registered cache is not replaced.
+func (r *Registry) register(c Registered) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, found := r.caches[c.Name()]; found {
+		return fmt.Errorf("cache %q is already registered", c.Name())
+	}
+	r.caches[c.Name()] = c
+	return nil
+}
+
+// deregister removes the cache if it is registered under its name.
+func (r *Registry) deregister(c Registered) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.caches[c.Name()] == c {
+		delete(r.caches, c.Name())
+	}
+}
+
+// List returns sorted names of registered caches.
+func (r *Registry) List() []string {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.caches))
+	for name := range r.caches {
+		names = append(names, name)
+	}
+	r.mutex.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the cache registered under the name.
+func (r *Registry) Get(name string) (Registered, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	c, found := r.caches[name]
+	return c, found
+}
+
+// Stats returns statistics of all registered caches by names.
+func (r *Registry) Stats() map[string]Stats {
+	r.mutex.RLock()
+	caches := make([]Registered, 0, len(r.caches))
+	for _, c := range r.caches {
+		caches = append(caches, c)
+	}
+	r.mutex.RUnlock()
+
+	stats := make(map[string]Stats, len(caches))
+	for _, c := range caches {
+		stats[c.Name()] = c.Stats()
+	}
+	return stats
+}
+
+// Reset clears the cache registered under the name.
+func (r *Registry) Reset(name string) error {
+	c, found := r.Get(name)
+	if !found {
+		return ErrNotRegistered
+	}
+	return c.Reset()
+}
+
+// Resize changes the max size of the cache registered under the name.
+func (r *Registry) Resize(name string, size uint) error {
+	c, found := r.Get(name)
+	if !found {
+		return ErrNotRegistered
+	}
+	c.Resize(size)
+	return nil
+}
+
+// DebugHandler returns an http.Handler serving the list of registered caches at the root
+// and the debug handler of every cache (see Cache.DebugHandler) under its name:
+//
+//	GET /                - sorted names of caches
+//	GET /users/?n=10     - the state of the "users" cache
+func (r *Registry) DebugHandler(o ...DebugOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, "/")
+		if path == "" {
+			if req.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			writejson(w, r.List())
+			return
+		}
+
+		name, _, _ := strings.Cut(path, "/")
+		c, found := r.Get(name)
+		if !found {
+			http.NotFound(w, req)
+			return
+		}
+		http.StripPrefix("/"+name, c.DebugHandler(o...)).ServeHTTP(w, req)
+	})
+}
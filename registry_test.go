@@ -0,0 +1,117 @@
+package prehit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	users := NewCache[string, int](WithName("users"), WithRegistry(r), WithMaxSize(10))
+	orders := NewCache[int, string](WithName("orders"), WithRegistry(r))
+
+	if names := r.List(); len(names) != 2 || names[0] != "orders" || names[1] != "users" {
+		t.Errorf("Unexpected names %v", names)
+	}
+
+	// duplicate names are not registered
+	duplicate := NewCache[string, int](WithName("users"), WithRegistry(r))
+	if c, _ := r.Get("users"); c != Registered(users) {
+		t.Error("Registered cache must not be replaced")
+	}
+	duplicate.Close()
+	if _, found := r.Get("users"); !found {
+		t.Error("Close of the duplicate must not deregister the cache")
+	}
+
+	for i := 0; i < 5; i++ {
+		users.Set(string(rune('a'+i)), i, time.Hour)
+	}
+	users.Get("a")
+	orders.Get(1)
+
+	stats := r.Stats()
+	if stats["users"].Size != 5 || stats["users"].Hits != 1 || stats["orders"].Misses != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if err := r.Resize("users", 3); err != nil {
+		t.Fatal(err)
+	}
+	if st := users.Stats(); st.MaxSize != 3 || st.Size != 3 {
+		t.Errorf("Unexpected stats after resize %+v", st)
+	}
+
+	if err := r.Reset("users"); err != nil {
+		t.Fatal(err)
+	}
+	if users.Stats().Size != 0 {
+		t.Error("Cache must be empty after reset")
+	}
+
+	if r.Reset("unknown") != ErrNotRegistered || r.Resize("unknown", 1) != ErrNotRegistered {
+		t.Error("Expected ErrNotRegistered")
+	}
+
+	users.Close()
+	orders.Close()
+	if len(r.List()) != 0 {
+		t.Error("Closed caches must be deregistered")
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	c := NewCache[string, int](WithName("default-registry-test"))
+	if _, found := DefaultRegistry.Get("default-registry-test"); !found {
+		t.Error("Cache must be registered in the default registry")
+	}
+	c.Close()
+	if _, found := DefaultRegistry.Get("default-registry-test"); found {
+		t.Error("Cache must be deregistered")
+	}
+
+	// unnamed caches are not registered
+	n := len(DefaultRegistry.List())
+	NewCache[string, int]().Close()
+	if len(DefaultRegistry.List()) != n {
+		t.Error("Unnamed cache must not be registered")
+	}
+}
+
+func TestRegistryDebugHandler(t *testing.T) {
+	r := NewRegistry()
+	c := NewCache[string, int](WithName("users"), WithRegistry(r))
+	defer c.Close()
+	c.Set("a", 1, time.Hour)
+
+	h := r.DebugHandler(WithAdmin(true))
+
+	w := debugrequest(t, h, http.MethodGet, "/")
+	var names []string
+	json.NewDecoder(w.Body).Decode(&names)
+	if len(names) != 1 || names[0] != "users" {
+		t.Errorf("Unexpected names %v", names)
+	}
+
+	w = debugrequest(t, h, http.MethodGet, "/users/")
+	var state DebugState
+	json.NewDecoder(w.Body).Decode(&state)
+	if state.Size != 1 || len(state.MRU) != 1 || state.MRU[0].Key != "a" {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	if w := debugrequest(t, h, http.MethodGet, "/users/key?key=a"); w.Code != http.StatusOK {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodPost, "/users/reset"); w.Code != http.StatusNoContent || c.Stats().Size != 0 {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodGet, "/unknown/"); w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+	if w := debugrequest(t, h, http.MethodPost, "/"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status %d", w.Code)
+	}
+}
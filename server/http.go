@@ -0,0 +1,222 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+const (
+	keysprefix = "/keys/"
+
+	// TTLHeader is the request header with the TTL of a stored value and the response header
+	// with the remaining TTL: seconds or a duration like 1m30s. The ttl query parameter
+	// takes precedence over the header.
+	TTLHeader = "X-Prehit-TTL"
+)
+
+// HTTPStats is a snapshot of statistics returned by GET /stats.
+type HTTPStats struct {
+	Uptime           int64        `json:"uptime"` // seconds
+	Connections      int64        `json:"connections"`
+	TotalConnections int64        `json:"total_connections"`
+	Gets             uint64       `json:"gets"`
+	Sets             uint64       `json:"sets"`
+	Flushes          uint64       `json:"flushes"`
+	Cache            prehit.Stats `json:"cache"`
+}
+
+// Handler returns the HTTP API of the cache:
+//
+//	GET /keys/{key}       returns the value, 404 if the key is not found
+//	PUT /keys/{key}       stores the request body with the TTL from the X-Prehit-TTL header or the ttl parameter
+//	DELETE /keys/{key}    removes the key, 404 if the key is not found
+//	POST /flush           removes all keys
+//	GET /stats            returns HTTPStats as JSON
+//
+// Keys are path-unescaped, so keys with slashes must be escaped as %2F. Request bodies are
+// limited by the max value size and all requests require the bearer token if it is set.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(s.http)
+}
+
+// ServeREST serves the HTTP API on the listener.
+func (s *Server) ServeREST(l net.Listener) error {
+	hs := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				s.stats.connections.Add(1)
+				s.stats.total.Add(1)
+			case http.StateHijacked, http.StateClosed:
+				s.stats.connections.Add(-1)
+			}
+		},
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		l.Close()
+		return ErrClosed
+	}
+	s.https[hs] = true
+	s.mutex.Unlock()
+
+	err := hs.Serve(l)
+
+	s.mutex.Lock()
+	delete(s.https, hs)
+	s.mutex.Unlock()
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return ErrClosed
+	}
+	return err
+}
+
+func (s *Server) http(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="prehit"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch path := r.URL.EscapedPath(); {
+	case strings.HasPrefix(path, keysprefix):
+		key, err := url.PathUnescape(path[len(keysprefix):])
+		if err != nil || key == "" {
+			http.Error(w, "invalid key", http.StatusBadRequest)
+			return
+		}
+		s.httpkey(w, r, key)
+	case path == "/flush":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.flush(0); err != nil {
+			http.Error(w, "flush failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/stats":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.httpstats())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized checks the bearer token in constant time.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) httpkey(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.stats.gets.Add(1)
+		e, ok := s.get(key)
+		if !ok {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		if ttl, ok := s.cache.TTL(key); ok && ttl <= never/2 {
+			w.Header().Set(TTLHeader, strconv.FormatInt(int64((ttl+time.Second/2)/time.Second), 10))
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(e.data)))
+		w.Write(e.data)
+
+	case http.MethodPut:
+		ttl, err := httpttl(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength > int64(s.maxvalue) {
+			http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.maxvalue)))
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to read value", http.StatusBadRequest)
+			return
+		}
+		s.store("set", key, 0, data, ttl)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if !s.delete(key) {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// httpttl returns the TTL of the request: seconds or a duration, no expiration if not set.
+func httpttl(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("ttl")
+	if v == "" {
+		v = r.Header.Get(TTLHeader)
+	}
+	if v == "" {
+		return never, nil
+	}
+
+	ttl, ok := parsettl([]byte(v), time.Second)
+	if !ok {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil {
+			return 0, errors.New("invalid TTL")
+		}
+	}
+	if ttl <= 0 {
+		return 0, errors.New("TTL must be positive")
+	}
+	return ttl, nil
+}
+
+func (s *Server) httpstats() HTTPStats {
+	return HTTPStats{
+		Uptime:           int64(time.Since(s.start) / time.Second),
+		Connections:      s.stats.connections.Load(),
+		TotalConnections: s.stats.total.Load(),
+		Gets:             s.stats.gets.Load(),
+		Sets:             s.stats.sets.Load(),
+		Flushes:          s.stats.flushes.Load(),
+		Cache:            s.cache.Stats(),
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+// httprequest serves the request by the handler and returns the recorded response.
+func httprequest(t *testing.T, h http.Handler, method string, target string, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHTTPKeys(t *testing.T) {
+	c := prehit.NewCache[string, []byte](prehit.WithMaxSize(100))
+	defer c.Close()
+	h := New(c, WithMaxValue(8)).Handler()
+
+	tests := []struct {
+		method   string
+		target   string
+		body     string
+		header   []string
+		code     int
+		expected string
+	}{
+		{http.MethodGet, "/keys/a", "", nil, http.StatusNotFound, ""},
+		{http.MethodPut, "/keys/a", "value", nil, http.StatusNoContent, ""},
+		{http.MethodGet, "/keys/a", "", nil, http.StatusOK, "value"},
+		{http.MethodPut, "/keys/a%2Fb", "slash", []string{TTLHeader, "60"}, http.StatusNoContent, ""},
+		{http.MethodGet, "/keys/a%2Fb", "", nil, http.StatusOK, "slash"},
+		{http.MethodPut, "/keys/b?ttl=1m", "ttl", nil, http.StatusNoContent, ""},
+		{http.MethodPut, "/keys/b?ttl=x", "ttl", nil, http.StatusBadRequest, ""},
+		{http.MethodPut, "/keys/b", "ttl", []string{TTLHeader, "-1"}, http.StatusBadRequest, ""},
+		{http.MethodPut, "/keys/c", "too large value", nil, http.StatusRequestEntityTooLarge, ""},
+		{http.MethodGet, "/keys/c", "", nil, http.StatusNotFound, ""},
+		{http.MethodPost, "/keys/a", "", nil, http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/keys/", "", nil, http.StatusBadRequest, ""},
+		{http.MethodDelete, "/keys/a", "", nil, http.StatusNoContent, ""},
+		{http.MethodDelete, "/keys/a", "", nil, http.StatusNotFound, ""},
+		{http.MethodGet, "/flush", "", nil, http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/flush", "", nil, http.StatusNoContent, ""},
+		{http.MethodGet, "/keys/b", "", nil, http.StatusNotFound, ""},
+		{http.MethodGet, "/unknown", "", nil, http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		w := httprequest(t, h, test.method, test.target, test.body, test.header...)
+		if w.Code != test.code {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.target, test.code, w.Code)
+		}
+		if test.expected != "" && w.Body.String() != test.expected {
+			t.Errorf("%s %s: expected body %q, got %q", test.method, test.target, test.expected, w.Body.String())
+		}
+	}
+}
+
+func TestHTTPTTL(t *testing.T) {
+	c := prehit.NewCache[string, []byte](prehit.WithMaxSize(100))
+	defer c.Close()
+	h := New(c).Handler()
+
+	httprequest(t, h, http.MethodPut, "/keys/a?ttl=90s", "1", TTLHeader, "10")
+	if ttl := httprequest(t, h, http.MethodGet, "/keys/a", "").Header().Get(TTLHeader); ttl != "90" {
+		t.Errorf("Expected query TTL to take precedence, got %q", ttl)
+	}
+
+	httprequest(t, h, http.MethodPut, "/keys/b", "1")
+	if ttl := httprequest(t, h, http.MethodGet, "/keys/b", "").Header().Get(TTLHeader); ttl != "" {
+		t.Errorf("Expected no TTL header without expiration, got %q", ttl)
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	c := prehit.NewCache[string, []byte]()
+	defer c.Close()
+	h := New(c, WithToken("secret")).Handler()
+
+	if w := httprequest(t, h, http.MethodGet, "/stats", ""); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected unauthorized without token, got %d", w.Code)
+	}
+	if w := httprequest(t, h, http.MethodGet, "/stats", "", "Authorization", "Bearer wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized with wrong token, got %d", w.Code)
+	}
+	if w := httprequest(t, h, http.MethodGet, "/stats", "", "Authorization", "Bearer secret"); w.Code != http.StatusOK {
+		t.Errorf("Expected success with token, got %d", w.Code)
+	}
+}
+
+func TestHTTPStats(t *testing.T) {
+	c := prehit.NewCache[string, []byte](prehit.WithMaxSize(100))
+	defer c.Close()
+	h := New(c).Handler()
+
+	httprequest(t, h, http.MethodPut, "/keys/a", "1")
+	httprequest(t, h, http.MethodGet, "/keys/a", "")
+	httprequest(t, h, http.MethodGet, "/keys/b", "")
+
+	w := httprequest(t, h, http.MethodGet, "/stats", "")
+	var stats HTTPStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Gets != 2 || stats.Sets != 1 || stats.Cache.Hits != 1 || stats.Cache.Misses != 1 || stats.Cache.Size != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestServeREST(t *testing.T) {
+	c := prehit.NewCache[string, []byte]()
+	defer c.Close()
+	s := New(c)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.ServeREST(l) }()
+
+	r, _ := http.NewRequest(http.MethodPut, "http://"+l.Addr().String()+"/keys/a", strings.NewReader("value"))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get("http://" + l.Addr().String() + "/keys/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "value" {
+		t.Errorf("Unexpected value %q", body)
+	}
+
+	s.Close()
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve is not stopped")
+	}
+}
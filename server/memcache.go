@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+const (
+	maxkey     = 250               // max key length of the memcached protocol
+	maxline    = 2048              // max command line length
+	maxgetline = 256 << 10         // max line length of get and gets listing many keys
+	relative   = 30 * 24 * 60 * 60 // larger exptime values are unix times
+)
+
+// errclient is a client error sent as CLIENT_ERROR.
+type errclient string
+
+func (e errclient) Error() string {
+	return string(e)
+}
+
+// ServeMemcache serves the memcached text protocol subset on the listener:
+// get, gets, set, add, replace, delete, touch, flush_all, stats, version and quit.
+func (s *Server) ServeMemcache(l net.Listener) error {
+	return s.serve(l, s.memcache)
+}
+
+// exptime converts the memcached expiration time to a TTL: zero means no expiration,
+// values up to 30 days are relative seconds, larger values are unix times, negative values
+// expire the item immediately.
+func exptime(v int64, now time.Time) time.Duration {
+	switch {
+	case v == 0:
+		return never
+	case v < 0:
+		return 0
+	case v <= relative:
+		return time.Duration(v) * time.Second
+	default:
+		return time.Unix(v, 0).Sub(now)
+	}
+}
+
+func validkey(key string) bool {
+	if len(key) == 0 || len(key) > maxkey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// memcacheline reads a command line. Lines of get and gets may be longer than maxline.
+func memcacheline(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != bufio.ErrBufferFull || !(bytes.HasPrefix(line, []byte("get ")) || bytes.HasPrefix(line, []byte("gets "))) {
+		return line, err
+	}
+
+	long := append([]byte(nil), line...)
+	for err == bufio.ErrBufferFull && len(long) <= maxgetline {
+		line, err = r.ReadSlice('\n')
+		long = append(long, line...)
+	}
+	if len(long) > maxgetline {
+		return nil, bufio.ErrBufferFull
+	}
+	return long, err
+}
+
+func (s *Server) memcache(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, maxline)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := memcacheline(r)
+		if err == bufio.ErrBufferFull {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			s.stats.badcommands.Add(1)
+			w.WriteString("ERROR\r\n")
+		} else {
+			err = s.memcachecommand(fields, r, w)
+			var ce errclient
+			switch {
+			case err == io.EOF:
+				w.Flush()
+				return
+			case errors.As(err, &ce):
+				fmt.Fprintf(w, "CLIENT_ERROR %s\r\n", ce)
+			case err != nil:
+				return
+			}
+		}
+
+		if r.Buffered() == 0 { // the pipeline is processed
+			if w.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// memcachecommand executes a command, io.EOF closes the connection.
+func (s *Server) memcachecommand(fields []string, r *bufio.Reader, w *bufio.Writer) error {
+	command, args := fields[0], fields[1:]
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+	reply := func(message string) {
+		if !noreply {
+			w.WriteString(message)
+		}
+	}
+
+	switch command {
+	case "get", "gets":
+		if len(args) == 0 {
+			s.stats.badcommands.Add(1)
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		for _, key := range args {
+			if !validkey(key) {
+				return errclient("bad command line format")
+			}
+		}
+		for _, key := range args {
+			s.stats.gets.Add(1)
+			e, ok := s.get(key)
+			if !ok {
+				continue
+			}
+			if command == "gets" {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, e.flags, len(e.data), e.cas)
+			} else {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, e.flags, len(e.data))
+			}
+			w.Write(e.data)
+			w.WriteString("\r\n")
+		}
+		w.WriteString("END\r\n")
+
+	case "set", "add", "replace":
+		if len(args) != 4 {
+			return errclient("bad command line format")
+		}
+		key := args[0]
+		flags, err1 := strconv.ParseUint(args[1], 10, 32)
+		expiration, err2 := strconv.ParseInt(args[2], 10, 64)
+		size, err3 := strconv.Atoi(args[3])
+		if !validkey(key) || err1 != nil || err2 != nil || err3 != nil || size < 0 {
+			return errclient("bad command line format")
+		}
+		if size > s.maxvalue {
+			// the data block is skipped to keep the stream in sync
+			if _, err := r.Discard(size + 2); err != nil {
+				return err
+			}
+			reply("SERVER_ERROR object too large for cache\r\n")
+			return nil
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			if data[len(data)-1] != '\n' { // the rest of the line is skipped
+				if _, err := r.ReadSlice('\n'); err != nil && err != bufio.ErrBufferFull {
+					return err
+				}
+			}
+			return errclient("bad data chunk")
+		}
+
+		if s.store(command, key, uint32(flags), data[:size], exptime(expiration, time.Now())) {
+			reply("STORED\r\n")
+		} else {
+			reply("NOT_STORED\r\n")
+		}
+
+	case "delete":
+		if len(args) != 1 && !(len(args) == 2 && args[1] == "0") { // legacy zero time
+			return errclient("bad command line format. Usage: delete <key> [noreply]")
+		}
+		if !validkey(args[0]) {
+			return errclient("bad command line format")
+		}
+		if s.delete(args[0]) {
+			reply("DELETED\r\n")
+		} else {
+			reply("NOT_FOUND\r\n")
+		}
+
+	case "touch":
+		if len(args) != 2 || !validkey(args[0]) {
+			return errclient("bad command line format")
+		}
+		expiration, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errclient("invalid exptime argument")
+		}
+		if s.touch(args[0], exptime(expiration, time.Now())) {
+			reply("TOUCHED\r\n")
+		} else {
+			reply("NOT_FOUND\r\n")
+		}
+
+	case "flush_all":
+		var delay int64
+		if len(args) > 1 {
+			return errclient("bad command line format")
+		}
+		if len(args) == 1 {
+			var err error
+			if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil || delay < 0 {
+				return errclient("bad command line format")
+			}
+		}
+		if err := s.flush(time.Duration(delay) * time.Second); err != nil {
+			reply(fmt.Sprintf("SERVER_ERROR %v\r\n", err))
+			return nil
+		}
+		reply("OK\r\n")
+
+	case "stats":
+		if len(args) > 0 {
+			w.WriteString("ERROR\r\n") // only general statistics are supported
+			return nil
+		}
+		for _, stat := range s.memcachestats() {
+			fmt.Fprintf(w, "STAT %s %s\r\n", stat[0], stat[1])
+		}
+		w.WriteString("END\r\n")
+
+	case "version":
+		w.WriteString("VERSION " + Version + "\r\n")
+
+	case "quit":
+		return io.EOF
+
+	default:
+		s.stats.badcommands.Add(1)
+		w.WriteString("ERROR\r\n")
+	}
+
+	return nil
+}
+
+// memcachestats maps the server counters and the cache statistics onto memcached stats.
+func (s *Server) memcachestats() [][2]string {
+	now := time.Now()
+	cs := s.cache.Stats()
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	i := func(v int64) string { return strconv.FormatInt(v, 10) }
+
+	return [][2]string{
+		{"pid", strconv.Itoa(os.Getpid())},
+		{"uptime", i(int64(now.Sub(s.start) / time.Second))},
+		{"time", i(now.Unix())},
+		{"version", Version},
+		{"pointer_size", strconv.Itoa(int(unsafe.Sizeof(uintptr(0)) * 8))},
+		{"curr_connections", i(s.stats.connections.Load())},
+		{"total_connections", i(s.stats.total.Load())},
+		{"cmd_get", u(s.stats.gets.Load())},
+		{"cmd_set", u(s.stats.sets.Load())},
+		{"cmd_flush", u(s.stats.flushes.Load())},
+		{"cmd_touch", u(s.stats.touches.Load())},
+		{"get_hits", u(cs.Hits)},
+		{"get_misses", u(cs.Misses + cs.MissingHits + cs.ErrorHits)},
+		{"delete_hits", u(s.stats.deletehits.Load())},
+		{"delete_misses", u(s.stats.deletemisses.Load())},
+		{"touch_hits", u(s.stats.touchhits.Load())},
+		{"touch_misses", u(s.stats.touchmisses.Load())},
+		{"curr_items", u(uint64(cs.Size))},
+		{"total_items", u(cs.Adds + cs.Updates)},
+		{"evictions", u(cs.Capacity)},
+		{"reclaimed", u(cs.Expired)},
+		{"limit_maxitems", u(uint64(cs.MaxSize))},
+		{"errors", u(cs.Errors)},
+	}
+}
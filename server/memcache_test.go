@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+// memcacheclient starts a server of a new cache and connects to it.
+func memcacheclient(t *testing.T, o ...Option) (*Server, net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	c := prehit.NewCache[string, []byte](prehit.WithMaxSize(100))
+	s := New(c, o...)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeMemcache(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Close()
+		c.Close()
+	})
+	return s, conn, bufio.NewReader(conn)
+}
+
+// roundtrip sends the request and reads lines of the response until the last one.
+func roundtrip(t *testing.T, conn net.Conn, r *bufio.Reader, request string, last func(string) bool) []string {
+	t.Helper()
+
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Response to %q: %v (read %q)", request, err, lines)
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		lines = append(lines, line)
+		if last(line) {
+			return lines
+		}
+	}
+}
+
+func one(string) bool { return true }
+
+func end(line string) bool { return line == "END" }
+
+func TestMemcacheStorage(t *testing.T) {
+	_, conn, r := memcacheclient(t)
+
+	tests := []struct {
+		request  string
+		last     func(string) bool
+		expected string
+	}{
+		{"get a\r\n", end, "END"},
+		{"set a 5 0 3\r\nabc\r\n", one, "STORED"},
+		{"get a b\r\n", end, "VALUE a 5 3|abc|END"},
+		{"add a 0 0 1\r\nx\r\n", one, "NOT_STORED"},
+		{"add b 0 0 1\r\nx\r\n", one, "STORED"},
+		{"replace c 0 0 1\r\ny\r\n", one, "NOT_STORED"},
+		{"replace b 7 0 2\r\nyz\r\n", one, "STORED"},
+		{"get a b\r\n", end, "VALUE a 5 3|abc|VALUE b 7 2|yz|END"},
+		{"set e 0 0 0\r\n\r\n", one, "STORED"},
+		{"get e\r\n", end, "VALUE e 0 0||END"},
+		{"delete a\r\n", one, "DELETED"},
+		{"delete a\r\n", one, "NOT_FOUND"},
+		{"touch b 100\r\n", one, "TOUCHED"},
+		{"touch a 100\r\n", one, "NOT_FOUND"},
+		{"set n 0 0 1 noreply\r\nn\r\nget n\r\n", end, "VALUE n 0 1|n|END"},
+		{"set x 0 -1 1\r\nx\r\n", one, "STORED"},
+		{"get x\r\n", end, "END"},
+		{"set x 0 0 1\r\nx\r\n", one, "STORED"},
+		{"replace x 0 -1 1\r\ny\r\n", one, "STORED"},
+		{"get x\r\n", end, "END"},
+		{"replace x 0 -1 1\r\ny\r\n", one, "NOT_STORED"},
+		{"add b 0 -1 1\r\ny\r\n", one, "NOT_STORED"},
+		{"add x 0 -1 1\r\ny\r\n", one, "NOT_STORED"},
+		{"get b x\r\n", end, "VALUE b 7 2|yz|END"},
+		{"flush_all\r\n", one, "OK"},
+		{"get b n\r\n", end, "END"},
+		{"version\r\n", one, "VERSION " + Version},
+		{"unknown\r\n", one, "ERROR"},
+		{"\r\n", one, "ERROR"},
+		{"set k 0 0 z\r\n", one, "CLIENT_ERROR bad command line format"},
+		{"set k 0 0 1\r\nxyz\r\n", one, "CLIENT_ERROR bad data chunk"},
+		{"get " + strings.Repeat("k", maxkey+1) + "\r\n", one, "CLIENT_ERROR bad command line format"},
+	}
+
+	for _, test := range tests {
+		lines := roundtrip(t, conn, r, test.request, test.last)
+		if got := strings.Join(lines, "|"); got != test.expected {
+			t.Errorf("Request %q: expected %q, got %q", test.request, test.expected, got)
+		}
+	}
+}
+
+func TestMemcacheExpired(t *testing.T) {
+	s, conn, r := memcacheclient(t)
+	c := s.cache
+
+	// values expiring at once do not evict live items
+	for i := 0; i < 100; i++ {
+		roundtrip(t, conn, r, "set "+strconv.Itoa(i)+" 0 0 1\r\nx\r\n", one)
+	}
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	roundtrip(t, conn, r, "set a 0 "+past+" 1\r\nx\r\n", one)
+	roundtrip(t, conn, r, "set b 0 -1 1\r\nx\r\n", one)
+	if _, ok := c.Get("0"); !ok || c.Len() != 100 {
+		t.Errorf("Live items are evicted, %d left", c.Len())
+	}
+}
+
+func TestMemcacheLongGet(t *testing.T) {
+	_, conn, r := memcacheclient(t)
+
+	var keys []string
+	for i := 0; i < 9; i++ {
+		keys = append(keys, strconv.Itoa(i)+strings.Repeat("k", maxkey-1))
+	}
+	roundtrip(t, conn, r, "set "+keys[8]+" 0 0 1\r\nx\r\n", one)
+	for _, command := range []string{"get", "gets"} {
+		lines := roundtrip(t, conn, r, command+" "+strings.Join(keys, " ")+"\r\n", end)
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "VALUE "+keys[8]) {
+			t.Errorf("Unexpected response to %s: %q", command, lines)
+		}
+	}
+
+	// other commands are limited
+	lines := roundtrip(t, conn, r, "delete "+strings.Repeat("k", maxline)+"\r\n", one)
+	if lines[0] != "CLIENT_ERROR line too long" {
+		t.Errorf("Unexpected response %q", lines)
+	}
+}
+
+func TestMemcacheGets(t *testing.T) {
+	_, conn, r := memcacheclient(t)
+
+	roundtrip(t, conn, r, "set a 0 0 1\r\na\r\n", one)
+	first := roundtrip(t, conn, r, "gets a\r\n", end)
+	roundtrip(t, conn, r, "set a 0 0 1\r\nb\r\n", one)
+	second := roundtrip(t, conn, r, "gets a\r\n", end)
+
+	if len(first) != 3 || len(second) != 3 {
+		t.Fatalf("Unexpected responses %q and %q", first, second)
+	}
+	cas1, cas2 := strings.Fields(first[0])[4], strings.Fields(second[0])[4]
+	if cas1 == cas2 {
+		t.Error("CAS unique must change on update")
+	}
+}
+
+func TestMemcacheMaxValue(t *testing.T) {
+	_, conn, r := memcacheclient(t, WithMaxValue(4))
+
+	lines := roundtrip(t, conn, r, "set a 0 0 5\r\nabcde\r\nget a\r\n", end)
+	if got := strings.Join(lines, "|"); got != "SERVER_ERROR object too large for cache|END" {
+		t.Errorf("Unexpected response %q", got)
+	}
+}
+
+func TestMemcacheStats(t *testing.T) {
+	_, conn, r := memcacheclient(t)
+
+	roundtrip(t, conn, r, "set a 0 0 1\r\na\r\n", one)
+	roundtrip(t, conn, r, "get a b\r\n", end)
+
+	stats := make(map[string]string)
+	for _, line := range roundtrip(t, conn, r, "stats\r\n", end) {
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "STAT" {
+			stats[fields[1]] = fields[2]
+		}
+	}
+
+	expected := map[string]string{
+		"cmd_get":          "2",
+		"cmd_set":          "1",
+		"get_hits":         "1",
+		"get_misses":       "1",
+		"curr_items":       "1",
+		"curr_connections": "1",
+		"limit_maxitems":   "100",
+		"version":          Version,
+	}
+	for name, value := range expected {
+		if stats[name] != value {
+			t.Errorf("Expected stat %s to be %s, got %q", name, value, stats[name])
+		}
+	}
+}
+
+func TestMemcacheQuit(t *testing.T) {
+	_, conn, r := memcacheclient(t)
+
+	conn.Write([]byte("quit\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+}
+
+func TestExptime(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		exptime  int64
+		expected time.Duration
+	}{
+		{0, never},
+		{-1, 0},
+		{60, time.Minute},
+		{relative, relative * time.Second},
+		{now.Unix() + 120, 2 * time.Minute},
+		{now.Unix() - 120, -2 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if ttl := exptime(test.exptime, now); ttl != test.expected {
+			t.Errorf("Exptime %d: expected %v, got %v", test.exptime, test.expected, ttl)
+		}
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	for key, expected := range map[string]bool{
+		"key":                          true,
+		"":                             false,
+		"a b":                          false,
+		"a\x00":                        false,
+		strings.Repeat("k", maxkey):    true,
+		strings.Repeat("k", maxkey+1):  false,
+		"user:" + strconv.Itoa(123456): true,
+	} {
+		if validkey(key) != expected {
+			t.Errorf("Key %q: expected %v", key, expected)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"go.melnyk.org/mlog"
+)
+
+// Options
+type options struct {
+	logger   mlog.Logger
+	maxvalue int
+	token    string
+}
+
+// Option is a set of options for the server.
+type Option interface {
+	apply(*options)
+}
+
+type loggerOption struct {
+	logger mlog.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.logger = o.logger
+}
+
+// WithLogger sets the logger of the server.
+func WithLogger(logger mlog.Logger) Option {
+	return loggerOption{logger: logger}
+}
+
+type maxvalueOption int
+
+func (o maxvalueOption) apply(opts *options) {
+	opts.maxvalue = int(o)
+}
+
+// WithMaxValue sets the max size of a value in bytes.
+func WithMaxValue(size int) Option {
+	return maxvalueOption(size)
+}
+
+type tokenOption string
+
+func (o tokenOption) apply(opts *options) {
+	opts.token = string(o)
+}
+
+// WithToken sets the bearer token required by the HTTP API, empty token disables authentication.
+func WithToken(token string) Option {
+	return tokenOption(token)
+}
@@ -0,0 +1,467 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxinline    = 64 << 10 // max inline command length
+	maxargs      = 1 << 20  // max number of command arguments
+	redisversion = "7.0.0"  // reported for clients checking the server version
+)
+
+// errprotocol is a protocol error, the connection is closed after the reply.
+type errprotocol string
+
+func (e errprotocol) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// arity of commands: positive is the exact number of arguments including the command name,
+// negative is the minimal one.
+var arity = map[string]int{
+	"get":      2,
+	"set":      -3,
+	"del":      -2,
+	"exists":   -2,
+	"ttl":      2,
+	"pttl":     2,
+	"expire":   3,
+	"flushdb":  -1,
+	"flushall": -1,
+	"dbsize":   1,
+	"info":     -1,
+	"ping":     -1,
+	"echo":     2,
+	"hello":    -1,
+	"select":   2,
+	"command":  -1,
+	"client":   -2,
+	"quit":     1,
+}
+
+// ServeRESP serves the Redis protocol (RESP2 and RESP3 after HELLO 3) on the listener:
+// GET, SET with EX, PX, NX and XX, DEL, EXISTS, TTL, PTTL, EXPIRE, FLUSHDB, DBSIZE and INFO
+// along with the connection commands used by redis-cli and client libraries.
+func (s *Server) ServeRESP(l net.Listener) error {
+	return s.serve(l, s.resp)
+}
+
+// respwriter writes replies of the negotiated protocol version.
+type respwriter struct {
+	*bufio.Writer
+	proto int
+}
+
+func (w *respwriter) simple(v string) {
+	w.WriteString("+" + v + "\r\n")
+}
+
+func (w *respwriter) error(v string) {
+	w.WriteString("-" + v + "\r\n")
+}
+
+func (w *respwriter) integer(v int64) {
+	w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+}
+
+func (w *respwriter) bulk(v []byte) {
+	w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n")
+	w.Write(v)
+	w.WriteString("\r\n")
+}
+
+func (w *respwriter) null() {
+	if w.proto == 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+	w.WriteString("$-1\r\n")
+}
+
+func (w *respwriter) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// maps are flattened to arrays of keys and values in RESP2.
+func (w *respwriter) maplen(n int) {
+	if w.proto == 3 {
+		w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+		return
+	}
+	w.array(2 * n)
+}
+
+func (s *Server) resp(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, maxinline)
+	w := &respwriter{Writer: bufio.NewWriter(conn), proto: 2}
+
+	for {
+		args, err := readcommand(r, s.maxvalue)
+		var pe errprotocol
+		if errors.As(err, &pe) {
+			w.error("ERR " + pe.Error())
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		if len(args) > 0 {
+			if err := s.respcommand(args, w); err == io.EOF {
+				w.Flush()
+				return
+			}
+		}
+
+		if r.Buffered() == 0 { // the pipeline is processed
+			if w.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// readline reads a line without the trailing CRLF.
+func readline(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errprotocol("too big request")
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// readcommand reads a command as an array of bulk strings or an inline command.
+func readcommand(r *bufio.Reader, maxbulk int) ([][]byte, error) {
+	line, err := readline(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		fields := strings.Fields(string(line))
+		args := make([][]byte, len(fields))
+		for i, field := range fields {
+			args[i] = []byte(field)
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxargs {
+		return nil, errprotocol("invalid multibulk length")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	args := make([][]byte, n)
+	for i := range args {
+		line, err := readline(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errprotocol(fmt.Sprintf("expected '$', got '%.1s'", line))
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxbulk {
+			return nil, errprotocol("invalid bulk length")
+		}
+
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, errprotocol("invalid bulk terminator")
+		}
+		args[i] = arg[:size]
+	}
+	return args, nil
+}
+
+// respcommand executes a command, io.EOF closes the connection.
+func (s *Server) respcommand(args [][]byte, w *respwriter) error {
+	command := strings.ToLower(string(args[0]))
+	n, known := arity[command]
+	if !known {
+		w.error(fmt.Sprintf("ERR unknown command '%.128s'", args[0]))
+		return nil
+	}
+	if (n > 0 && len(args) != n) || (n < 0 && len(args) < -n) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", command))
+		return nil
+	}
+
+	switch command {
+	case "get":
+		s.stats.gets.Add(1)
+		if e, ok := s.get(string(args[1])); ok {
+			w.bulk(e.data)
+		} else {
+			w.null()
+		}
+
+	case "set":
+		s.respset(args, w)
+
+	case "del":
+		var deleted int64
+		for _, key := range args[1:] {
+			if s.delete(string(key)) {
+				deleted++
+			}
+		}
+		w.integer(deleted)
+
+	case "exists":
+		var found int64
+		for _, key := range args[1:] {
+			if _, ok := s.cache.TTL(string(key)); ok {
+				found++
+			}
+		}
+		w.integer(found)
+
+	case "ttl", "pttl":
+		ttl, ok := s.cache.TTL(string(args[1]))
+		switch {
+		case !ok:
+			w.integer(-2)
+		case ttl > never/2: // stored without expiration
+			w.integer(-1)
+		case command == "ttl":
+			w.integer(int64((ttl + time.Second/2) / time.Second))
+		default:
+			w.integer(int64((ttl + time.Millisecond/2) / time.Millisecond))
+		}
+
+	case "expire":
+		ttl, ok := parsettl(args[2], time.Second)
+		switch {
+		case !ok:
+			w.error("ERR value is not an integer or out of range")
+		case ttl <= 0:
+			if s.delete(string(args[1])) {
+				w.integer(1)
+			} else {
+				w.integer(0)
+			}
+		case s.touch(string(args[1]), ttl):
+			w.integer(1)
+		default:
+			w.integer(0)
+		}
+
+	case "flushdb", "flushall":
+		if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(string(args[1]), "sync") && !strings.EqualFold(string(args[1]), "async")) {
+			w.error("ERR syntax error")
+			return nil
+		}
+		if err := s.flush(0); err != nil {
+			w.error("ERR flush failed: " + err.Error())
+			return nil
+		}
+		w.simple("OK")
+
+	case "dbsize":
+		w.integer(int64(s.cache.Len()))
+
+	case "info":
+		w.bulk([]byte(s.info(args[1:])))
+
+	case "ping":
+		switch len(args) {
+		case 1:
+			w.simple("PONG")
+		case 2:
+			w.bulk(args[1])
+		default:
+			w.error("ERR wrong number of arguments for 'ping' command")
+		}
+
+	case "echo":
+		w.bulk(args[1])
+
+	case "hello":
+		s.resphello(args, w)
+
+	case "select":
+		if string(args[1]) != "0" {
+			w.error("ERR DB index is out of range")
+			return nil
+		}
+		w.simple("OK")
+
+	case "command":
+		w.array(0) // command documentation is not provided
+
+	case "client":
+		switch strings.ToLower(string(args[1])) {
+		case "setname", "setinfo":
+			w.simple("OK")
+		default:
+			w.error(fmt.Sprintf("ERR unknown subcommand '%.128s'", args[1]))
+		}
+
+	case "quit":
+		w.simple("OK")
+		return io.EOF
+	}
+
+	return nil
+}
+
+// respset executes SET key value [EX seconds|PX milliseconds] [NX|XX].
+func (s *Server) respset(args [][]byte, w *respwriter) {
+	ttl := never
+	command := "set"
+	expiration := false
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case (option == "ex" || option == "px") && !expiration && i+1 < len(args):
+			unit := time.Second
+			if option == "px" {
+				unit = time.Millisecond
+			}
+			i++
+			var ok bool
+			ttl, ok = parsettl(args[i], unit)
+			if !ok || ttl <= 0 {
+				w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			expiration = true
+		case option == "nx" && command == "set":
+			command = "add"
+		case option == "xx" && command == "set":
+			command = "replace"
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	if s.store(command, string(args[1]), 0, args[2], ttl) {
+		w.simple("OK")
+	} else {
+		w.null()
+	}
+}
+
+// resphello executes HELLO [protover [AUTH username password] [SETNAME name]].
+func (s *Server) resphello(args [][]byte, w *respwriter) {
+	proto := w.proto
+	if len(args) > 1 {
+		v, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if v != 2 && v != 3 {
+			w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "auth" && i+2 < len(args):
+			i += 2 // there are no users, any credentials are accepted
+		case option == "setname" && i+1 < len(args):
+			i++
+		default:
+			w.error(fmt.Sprintf("ERR Syntax error in HELLO option '%.128s'", args[i]))
+			return
+		}
+	}
+
+	w.proto = proto
+	w.maplen(7)
+	w.bulk([]byte("server"))
+	w.bulk([]byte("prehit"))
+	w.bulk([]byte("version"))
+	w.bulk([]byte(redisversion))
+	w.bulk([]byte("proto"))
+	w.integer(int64(proto))
+	w.bulk([]byte("id"))
+	w.integer(s.stats.total.Load())
+	w.bulk([]byte("mode"))
+	w.bulk([]byte("standalone"))
+	w.bulk([]byte("role"))
+	w.bulk([]byte("master"))
+	w.bulk([]byte("modules"))
+	w.array(0)
+}
+
+// info returns the INFO sections: server, clients, stats and keyspace.
+func (s *Server) info(sections [][]byte) string {
+	all := len(sections) == 0
+	selected := make(map[string]bool)
+	for _, section := range sections {
+		name := strings.ToLower(string(section))
+		if name == "all" || name == "everything" || name == "default" {
+			all = true
+		}
+		selected[name] = true
+	}
+
+	now := time.Now()
+	cs := s.cache.Stats()
+	var b strings.Builder
+	section := func(name string, fields ...string) {
+		if !all && !selected[strings.ToLower(name)] {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + name + "\r\n")
+		for i := 0; i+1 < len(fields); i += 2 {
+			b.WriteString(fields[i] + ":" + fields[i+1] + "\r\n")
+		}
+	}
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	i := func(v int64) string { return strconv.FormatInt(v, 10) }
+
+	section("Server",
+		"redis_version", redisversion,
+		"prehit_version", Version,
+		"redis_mode", "standalone",
+		"process_id", strconv.Itoa(os.Getpid()),
+		"uptime_in_seconds", i(int64(now.Sub(s.start)/time.Second)),
+	)
+	section("Clients",
+		"connected_clients", i(s.stats.connections.Load()),
+	)
+	section("Stats",
+		"total_connections_received", i(s.stats.total.Load()),
+		"keyspace_hits", u(cs.Hits),
+		"keyspace_misses", u(cs.Misses+cs.MissingHits+cs.ErrorHits),
+		"expired_keys", u(cs.Expired),
+		"evicted_keys", u(cs.Capacity),
+	)
+	section("Keyspace",
+		"db0", fmt.Sprintf("keys=%d,expires=0,avg_ttl=0", cs.Size),
+	)
+
+	return b.String()
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+// respclient starts a RESP server of a new cache and connects to it.
+func respclient(t *testing.T) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	c := prehit.NewCache[string, []byte](prehit.WithMaxSize(100))
+	s := New(c, WithMaxValue(16))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeRESP(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Close()
+		c.Close()
+	})
+	return conn, bufio.NewReader(conn)
+}
+
+// readreply reads a reply and formats it: simple strings, errors and integers as is,
+// bulk strings quoted, nulls as nil, arrays and maps in brackets.
+func readreply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply line")
+	}
+
+	switch line[0] {
+	case '+', '-', ':':
+		return line, nil
+	case '_':
+		return "nil", nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", err
+		}
+		if n < 0 {
+			return "nil", nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return strconv.Quote(string(data[:n])), nil
+	case '*', '%':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", err
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		items := make([]string, n)
+		for i := range items {
+			if items[i], err = readreply(r); err != nil {
+				return "", err
+			}
+		}
+		return line[:1] + "[" + strings.Join(items, " ") + "]", nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+// command sends the command as an array of bulk strings and reads the reply.
+func command(t *testing.T, conn net.Conn, r *bufio.Reader, args ...string) string {
+	t.Helper()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	reply, err := readreply(r)
+	if err != nil {
+		t.Fatalf("Command %q: %v", args, err)
+	}
+	return reply
+}
+
+func TestRESPCommands(t *testing.T) {
+	conn, r := respclient(t)
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"GET", "a"}, "nil"},
+		{[]string{"SET", "a", "1"}, "+OK"},
+		{[]string{"get", "a"}, `"1"`},
+		{[]string{"SET", "a", "2", "NX"}, "nil"},
+		{[]string{"SET", "b", "2", "XX"}, "nil"},
+		{[]string{"SET", "b", "2", "NX", "EX", "100"}, "+OK"},
+		{[]string{"SET", "b", "3", "XX", "PX", "100000"}, "+OK"},
+		{[]string{"GET", "b"}, `"3"`},
+		{[]string{"SET", "c", "1", "NX", "XX"}, "-ERR syntax error"},
+		{[]string{"SET", "c", "1", "EX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "c", "1", "EX", "1", "PX", "1"}, "-ERR syntax error"},
+		{[]string{"EXISTS", "a", "b", "c", "a"}, ":3"},
+		{[]string{"TTL", "a"}, ":-1"},
+		{[]string{"TTL", "b"}, ":100"},
+		{[]string{"TTL", "c"}, ":-2"},
+		{[]string{"PTTL", "c"}, ":-2"},
+		{[]string{"EXPIRE", "a", "50"}, ":1"},
+		{[]string{"TTL", "a"}, ":50"},
+		{[]string{"EXPIRE", "c", "50"}, ":0"},
+		{[]string{"EXPIRE", "a", "x"}, "-ERR value is not an integer or out of range"},
+		{[]string{"DBSIZE"}, ":2"},
+		{[]string{"DEL", "a", "c"}, ":1"},
+		{[]string{"EXPIRE", "b", "-1"}, ":1"},
+		{[]string{"EXISTS", "b"}, ":0"},
+		{[]string{"SET", "d", "1"}, "+OK"},
+		{[]string{"FLUSHDB"}, "+OK"},
+		{[]string{"DBSIZE"}, ":0"},
+		{[]string{"ECHO", "hi"}, `"hi"`},
+		{[]string{"SELECT", "0"}, "+OK"},
+		{[]string{"SELECT", "1"}, "-ERR DB index is out of range"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"UNKNOWN"}, "-ERR unknown command 'UNKNOWN'"},
+		{[]string{"HELLO", "4"}, "-NOPROTO unsupported protocol version"},
+	}
+
+	for _, test := range tests {
+		if reply := command(t, conn, r, test.args...); reply != test.expected {
+			t.Errorf("Command %q: expected %s, got %s", test.args, test.expected, reply)
+		}
+	}
+}
+
+func TestRESPHello(t *testing.T) {
+	conn, r := respclient(t)
+
+	reply := command(t, conn, r, "HELLO", "3", "SETNAME", "test")
+	if !strings.HasPrefix(reply, `%["server" "prehit"`) || !strings.Contains(reply, `"proto" :3`) {
+		t.Errorf("Unexpected HELLO reply %s", reply)
+	}
+	if reply := command(t, conn, r, "GET", "a"); reply != "nil" {
+		t.Errorf("Expected RESP3 null, got %s", reply)
+	}
+
+	reply = command(t, conn, r, "HELLO", "2")
+	if !strings.HasPrefix(reply, `*["server" "prehit"`) {
+		t.Errorf("Unexpected HELLO reply %s", reply)
+	}
+	conn.Write([]byte("*2\r\n$3\r\nGET\r\n$1\r\na\r\n"))
+	if line, _ := r.ReadString('\n'); line != "$-1\r\n" {
+		t.Errorf("Expected RESP2 null, got %q", line)
+	}
+}
+
+func TestRESPInline(t *testing.T) {
+	conn, r := respclient(t)
+
+	conn.Write([]byte("SET a 1\r\nGET a\r\nPING\n"))
+	for _, expected := range []string{"+OK", `"1"`, "+PONG"} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if reply, err := readreply(r); err != nil || reply != expected {
+			t.Errorf("Expected %s, got %s (%v)", expected, reply, err)
+		}
+	}
+}
+
+func TestRESPInfo(t *testing.T) {
+	conn, r := respclient(t)
+
+	command(t, conn, r, "SET", "a", "1")
+	command(t, conn, r, "GET", "a")
+	command(t, conn, r, "GET", "b")
+
+	info, err := strconv.Unquote(command(t, conn, r, "INFO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"# Server\r\n", "redis_version:", "connected_clients:1\r\n", "keyspace_hits:1\r\n", "keyspace_misses:1\r\n", "db0:keys=1,"} {
+		if !strings.Contains(info, expected) {
+			t.Errorf("Expected %q in INFO:\n%s", expected, info)
+		}
+	}
+
+	info, _ = strconv.Unquote(command(t, conn, r, "INFO", "keyspace"))
+	if strings.Contains(info, "# Server") || !strings.Contains(info, "# Keyspace") {
+		t.Errorf("Unexpected INFO keyspace:\n%s", info)
+	}
+}
+
+func TestRESPProtocolError(t *testing.T) {
+	conn, r := respclient(t)
+
+	conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$17\r\n")) // larger than max value
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if reply, _ := readreply(r); reply != "-ERR Protocol error: invalid bulk length" {
+		t.Errorf("Unexpected reply %s", reply)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+}
+
+func TestRESPQuit(t *testing.T) {
+	conn, r := respclient(t)
+
+	if reply := command(t, conn, r, "QUIT"); reply != "+OK" {
+		t.Errorf("Unexpected reply %s", reply)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+}
@@ -0,0 +1,297 @@
+// Package server exposes prehit.Cache[string, []byte] to services in other languages
+// over network protocols.
+//
+// Values are stored in the cache with a header of the client flags (4 bytes) and
+// the CAS unique (8 bytes), so all protocols served for the same cache share the data.
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.melnyk.org/mlog"
+	"go.melnyk.org/mlog/nolog"
+	"go.melnyk.org/prehit"
+)
+
+const (
+	// Version is reported by the version commands.
+	Version = "prehit-1.0"
+
+	entryheader     = 12
+	defaultmaxvalue = 1 << 20
+	never           = 100 * 365 * 24 * time.Hour // TTL of values without expiration
+)
+
+// ErrClosed is returned by Serve after Close.
+var ErrClosed = errors.New("server is closed")
+
+// entry is a value stored in the cache.
+type entry struct {
+	flags uint32
+	cas   uint64
+	data  []byte
+}
+
+func encode(flags uint32, cas uint64, data []byte) []byte {
+	value := make([]byte, entryheader+len(data))
+	binary.BigEndian.PutUint32(value, flags)
+	binary.BigEndian.PutUint64(value[4:], cas)
+	copy(value[entryheader:], data)
+	return value
+}
+
+func decode(value []byte) (entry, bool) {
+	if len(value) < entryheader {
+		return entry{}, false
+	}
+	return entry{
+		flags: binary.BigEndian.Uint32(value),
+		cas:   binary.BigEndian.Uint64(value[4:]),
+		data:  value[entryheader:],
+	}, true
+}
+
+// Server serves a cache over network protocols.
+type Server struct {
+	cache    *prehit.Cache[string, []byte]
+	logger   mlog.Logger
+	maxvalue int
+	token    string
+	start    time.Time
+	cas      atomic.Uint64
+
+	stats struct {
+		connections, total                  atomic.Int64
+		gets, sets, touches, flushes        atomic.Uint64
+		deletehits, deletemisses            atomic.Uint64
+		touchhits, touchmisses, badcommands atomic.Uint64
+	}
+
+	mutex     sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	https     map[*http.Server]bool
+	flushing  *time.Timer // pending delayed flush
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New creates a server of the cache.
+func New(cache *prehit.Cache[string, []byte], o ...Option) *Server {
+	local := &options{
+		logger:   nolog.NewLogbook().Joiner().Join(""), // default logger
+		maxvalue: defaultmaxvalue,                      // default max value size
+	}
+
+	for _, option := range o {
+		option.apply(local)
+	}
+
+	return &Server{
+		cache:     cache,
+		logger:    local.logger,
+		maxvalue:  local.maxvalue,
+		token:     local.token,
+		start:     time.Now(),
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[net.Conn]bool),
+		https:     make(map[*http.Server]bool),
+	}
+}
+
+// parsettl converts the TTL argument of the unit to a duration, ok is false for
+// not an integer or out of range values.
+func parsettl(arg []byte, unit time.Duration) (time.Duration, bool) {
+	v, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || v > math.MaxInt64/int64(unit) || v < math.MinInt64/int64(unit) {
+		return 0, false
+	}
+	return time.Duration(v) * unit, true
+}
+
+// get returns the entry of the key.
+func (s *Server) get(key string) (entry, bool) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return entry{}, false
+	}
+	e, ok := decode(value)
+	if !ok {
+		s.logger.Warning(fmt.Sprintf("Value of key %q is not a server entry", key))
+	}
+	return e, ok
+}
+
+// store stores the data of the key by the command: set, add or replace.
+// A non-positive TTL removes the key instead of storing a value expiring at once.
+func (s *Server) store(command string, key string, flags uint32, data []byte, ttl time.Duration) bool {
+	s.stats.sets.Add(1)
+	if ttl <= 0 { // the value expires at once, storing it would only evict live items
+		switch command {
+		case "add": // nothing is added
+			return false
+		case "replace":
+			if _, found := s.cache.TTL(key); !found {
+				return false
+			}
+		}
+		// set and replace of an existing key store the expired value, it is removed at once
+		s.cache.Delete(key)
+		return true
+	}
+
+	value := encode(flags, s.cas.Add(1), data)
+	switch command {
+	case "add":
+		return s.cache.Add(key, value, ttl)
+	case "replace":
+		return s.cache.Replace(key, value, ttl)
+	default:
+		s.cache.Set(key, value, ttl)
+		return true
+	}
+}
+
+// delete removes the key and reports whether it existed.
+func (s *Server) delete(key string) bool {
+	_, found := s.cache.TTL(key)
+	s.cache.Delete(key)
+	if found {
+		s.stats.deletehits.Add(1)
+	} else {
+		s.stats.deletemisses.Add(1)
+	}
+	return found
+}
+
+// touch changes the TTL of the key and reports whether it exists.
+func (s *Server) touch(key string, ttl time.Duration) bool {
+	s.stats.touches.Add(1)
+	found := s.cache.Touch(key, ttl)
+	if found {
+		s.stats.touchhits.Add(1)
+	} else {
+		s.stats.touchmisses.Add(1)
+	}
+	return found
+}
+
+// flush clears the cache now or after the delay, it returns the error of the immediate reset.
+// A new flush replaces the pending delayed one.
+func (s *Server) flush(delay time.Duration) error {
+	s.stats.flushes.Add(1)
+
+	s.mutex.Lock()
+	if s.flushing != nil {
+		s.flushing.Stop()
+		s.flushing = nil
+	}
+	if delay > 0 {
+		if !s.closed {
+			var timer *time.Timer
+			timer = time.AfterFunc(delay, func() {
+				s.mutex.Lock()
+				if s.flushing == timer {
+					s.flushing = nil
+				}
+				s.mutex.Unlock()
+
+				if err := s.cache.Reset(); err != nil {
+					s.logger.Warning(fmt.Sprintf("Delayed flush failed: %v", err))
+				}
+			})
+			s.flushing = timer
+		}
+		s.mutex.Unlock()
+		return nil
+	}
+	s.mutex.Unlock()
+
+	return s.cache.Reset()
+}
+
+// serve accepts connections on the listener and handles them until Close.
+func (s *Server) serve(l net.Listener, handle func(net.Conn)) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		l.Close()
+		return ErrClosed
+	}
+	s.listeners[l] = true
+	s.mutex.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			delete(s.listeners, l)
+			closed := s.closed
+			s.mutex.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return ErrClosed
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mutex.Unlock()
+
+		s.stats.connections.Add(1)
+		s.stats.total.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.stats.connections.Add(-1)
+			defer func() {
+				s.mutex.Lock()
+				delete(s.conns, conn)
+				s.mutex.Unlock()
+				conn.Close()
+			}()
+			handle(conn)
+		}()
+	}
+}
+
+// Close stops all listeners and closes connections.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	for hs := range s.https {
+		hs.Close()
+	}
+	if s.flushing != nil {
+		s.flushing.Stop()
+		s.flushing = nil
+	}
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit"
+)
+
+func TestEntry(t *testing.T) {
+	e, ok := decode(encode(42, 7, []byte("data")))
+	if !ok || e.flags != 42 || e.cas != 7 || string(e.data) != "data" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+
+	if _, ok := decode([]byte("short")); ok {
+		t.Error("Expected short value to be rejected")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	c := prehit.NewCache[string, []byte]()
+	defer c.Close()
+	s := New(c)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.ServeMemcache(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("version\r\n"))
+	conn.Read(make([]byte, 64)) // the connection is accepted
+
+	s.Close()
+
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve is not stopped")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+
+	l, _ = net.Listen("tcp", "127.0.0.1:0")
+	if err := s.ServeMemcache(l); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
+
+// failingstore fails all writes.
+type failingstore struct{}
+
+func (failingstore) Write(context.Context, []prehit.Entry[string, []byte]) error {
+	return errors.New("store is down")
+}
+
+func TestServerFlushError(t *testing.T) {
+	c := prehit.NewCache[string, []byte](prehit.WithWriteBehind[string, []byte](failingstore{}, time.Hour, 100))
+	s := New(c)
+	c.Set("a", encode(0, 1, []byte("a")), time.Hour) // pending write-behind fails the reset
+
+	// failed resets are reported by every protocol
+	if w := httprequest(t, s.Handler(), http.MethodPost, "/flush", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected HTTP 500, got %d", w.Code)
+	}
+
+	for _, test := range []struct {
+		handle   func(net.Conn)
+		request  string
+		expected string
+	}{
+		{s.memcache, "flush_all\r\n", "SERVER_ERROR"},
+		{s.resp, "FLUSHDB\r\n", "-ERR flush failed"},
+	} {
+		client, server := net.Pipe()
+		go test.handle(server)
+		client.SetDeadline(time.Now().Add(5 * time.Second))
+		client.Write([]byte(test.request))
+		line, err := bufio.NewReader(client).ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, test.expected) {
+			t.Errorf("Request %q: unexpected reply %q %v", test.request, line, err)
+		}
+		client.Close()
+	}
+}
+
+func TestServerDelayedFlush(t *testing.T) {
+	c := prehit.NewCache[string, []byte]()
+	s := New(c)
+	c.Set("a", encode(0, 1, []byte("a")), time.Hour)
+
+	// a new flush replaces the pending one
+	s.flush(time.Hour)
+	first := s.flushing
+	s.flush(20 * time.Millisecond)
+	if first.Stop() {
+		t.Error("Pending flush must be stopped")
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if c.Len() != 0 {
+		t.Error("Delayed flush must clear the cache")
+	}
+
+	// Close stops the pending flush
+	c.Set("a", encode(0, 1, []byte("a")), time.Hour)
+	s.flush(10 * time.Millisecond)
+	s.Close()
+	time.Sleep(30 * time.Millisecond)
+	if c.Len() != 1 {
+		t.Error("Close must stop the delayed flush")
+	}
+	if s.flush(time.Millisecond); s.flushing != nil {
+		t.Error("Closed server must not schedule flushes")
+	}
+}
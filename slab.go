@@ -0,0 +1,278 @@
+package prehit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.melnyk.org/mlog"
+	"go.melnyk.org/mlog/nolog"
+)
+
+// nilslot marks the absence of a slot in the slab (the equivalent of a nil pointer).
+const nilslot = math.MaxUint32
+
+// slabItem is a single item in the slab.
+// It holds no pointers except those inside key and value, so the garbage collector
+// has much less work to do when the slab is large. The expiration is kept as
+// Unix nanoseconds for the same reason (time.Time carries a *Location).
+type slabItem[K comparable, V any] struct {
+	key        K
+	value      V
+	expiration int64
+	prev       uint32
+	next       uint32
+}
+
+// SlabCache is an in-memory cache with the same semantics as Cache, but with a
+// GC-friendly storage layout: items live in a single slice addressed by uint32
+// indices, freed slots are kept in a free list and the index maps keys to slots.
+type SlabCache[K comparable, V any] struct {
+	logger  mlog.Logger
+	index   map[K]uint32
+	items   []slabItem[K, V]
+	free    uint32
+	head    uint32
+	tail    uint32
+	maxsize uint
+	size    uint
+	metrics Metrics
+	mutex   sync.RWMutex
+}
+
+// NewSlabCache creates a new cache with the slab storage layout.
+// It honours WithLogger, WithMaxSize and WithMetrics, other options are ignored with a warning.
+// The max size cannot exceed math.MaxUint32-1.
+func NewSlabCache[K comparable, V any](o ...Option) *SlabCache[K, V] {
+	local := &options{
+		logger:  nolog.NewLogbook().Joiner().Join(""), // default logger
+		maxsize: 1000,                                 // default max size
+		metrics: &nometrics{},                         // no metrics by default
+	}
+
+	for _, option := range o {
+		option.apply(local)
+	}
+
+	for _, name := range local.cacheonly() {
+		local.logger.Warning(fmt.Sprintf("%s is not supported by SlabCache - it is ignored", name))
+	}
+	if local.segments != 0 || local.segmentsize != 0 {
+		local.logger.Warning("WithArena is not supported by SlabCache - it is ignored")
+	}
+
+	if local.maxsize >= nilslot {
+		local.logger.Warning("Max size is too big for the slab storage - it is truncated")
+		local.maxsize = nilslot - 1
+	}
+
+	return &SlabCache[K, V]{
+		logger:  local.logger,
+		index:   make(map[K]uint32, local.maxsize),
+		items:   make([]slabItem[K, V], 0, local.maxsize),
+		free:    nilslot,
+		head:    nilslot,
+		tail:    nilslot,
+		maxsize: local.maxsize,
+		metrics: local.metrics,
+		size:    0,
+	}
+}
+
+// Get returns a value for a key.
+func (c *SlabCache[K, V]) Get(key K) (V, bool) {
+	now := time.Now().UnixNano()
+	c.mutex.RLock()
+
+	if slot, found := c.index[key]; found {
+		if slot < uint32(len(c.items)) {
+			item := &c.items[slot]
+			if item.expiration > now {
+				value := item.value
+				movetohead := (item.next == nilslot) && (c.size > 1)
+				c.mutex.RUnlock()
+
+				if movetohead { // last Item and more than one item
+					c.mutex.Lock()
+					c.movetohead(key)
+					c.mutex.Unlock()
+				}
+				c.metrics.Hit()
+				return value, true
+			} else {
+				// remove expired element - mutex relock is needed
+				c.mutex.RUnlock()
+				c.mutex.Lock()
+				c.deleteexpired(key, now)
+				c.mutex.Unlock()
+				c.metrics.Miss()
+				c.metrics.Evict()
+				c.metrics.Delete()
+				return *new(V), false
+			}
+		} else {
+			c.logger.Warning("Inconsistency in the cache structure - slot is out of the slab")
+			c.metrics.Error()
+		}
+	}
+
+	c.mutex.RUnlock()
+	c.metrics.Miss()
+
+	return *new(V), false
+}
+
+func (c *SlabCache[K, V]) movetohead(key K) {
+	if slot, found := c.index[key]; found { // it can be changes in cache, extra check is needed
+		if c.items[slot].next == nilslot && c.head != slot { // move item to the head
+			c.unlink(slot)
+			c.linkhead(slot)
+		}
+	}
+}
+
+func (c *SlabCache[K, V]) deleteexpired(key K, tm int64) {
+	if slot, found := c.index[key]; found { // it can be changes in cache, extra check is needed
+		if c.items[slot].expiration <= tm {
+			c.remove(key, slot)
+		}
+	}
+}
+
+// unlink detaches the slot from the list.
+func (c *SlabCache[K, V]) unlink(slot uint32) {
+	item := &c.items[slot]
+	if item.next != nilslot {
+		c.items[item.next].prev = item.prev
+	} else {
+		c.tail = item.prev
+	}
+	if item.prev != nilslot {
+		c.items[item.prev].next = item.next
+	} else {
+		c.head = item.next
+	}
+	item.prev = nilslot
+	item.next = nilslot
+}
+
+// linkhead attaches the slot to the head of the list.
+func (c *SlabCache[K, V]) linkhead(slot uint32) {
+	item := &c.items[slot]
+	item.prev = nilslot
+	item.next = c.head
+	if c.head != nilslot { // list is not empty
+		c.items[c.head].prev = slot
+	} else { // list is empty and we need to set the tail also
+		c.tail = slot
+	}
+	c.head = slot
+}
+
+// remove unlinks the slot, drops the key from the index and returns the slot to the free list.
+func (c *SlabCache[K, V]) remove(key K, slot uint32) {
+	c.unlink(slot)
+	delete(c.index, key)
+
+	// clear references to let GC collect the key and the value
+	c.items[slot] = slabItem[K, V]{next: c.free, prev: nilslot}
+	c.free = slot
+
+	if c.size > 0 {
+		c.size--
+	} else {
+		c.logger.Warning("Inconsistency in the cache structure - more items deleted than expected")
+		c.metrics.Error()
+	}
+}
+
+// alloc returns a slot for a new item, either from the free list or by growing the slab.
+func (c *SlabCache[K, V]) alloc() uint32 {
+	if c.free != nilslot {
+		slot := c.free
+		c.free = c.items[slot].next
+		return slot
+	}
+
+	c.items = append(c.items, slabItem[K, V]{})
+	return uint32(len(c.items) - 1)
+}
+
+// Set stores a value for a key.
+func (c *SlabCache[K, V]) Set(key K, v V, ttl time.Duration) {
+	c.logger.Verbose("Set cache")
+	expiration := time.Now().Add(ttl).UnixNano()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if slot, found := c.index[key]; found {
+		item := &c.items[slot]
+		item.value = v
+		item.expiration = expiration
+		if item.next == nilslot && c.size > 1 { // last item and more than one item
+			// move item from the tail to the head
+			c.unlink(slot)
+			c.linkhead(slot)
+		}
+		c.metrics.Update()
+		return
+	}
+
+	if c.size >= c.maxsize && c.tail != nilslot { // we reached max size,
+		// remove the last item
+		c.remove(c.items[c.tail].key, c.tail)
+		c.metrics.Delete()
+		c.metrics.Evict()
+	}
+
+	// add new item to the head
+	slot := c.alloc()
+	item := &c.items[slot]
+	item.key = key
+	item.value = v
+	item.expiration = expiration
+	c.linkhead(slot)
+
+	c.index[key] = slot
+	c.size++
+	c.metrics.Add()
+}
+
+// Delete removes a key from the cache.
+func (c *SlabCache[K, V]) Delete(key ...K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, k := range key {
+		if slot, found := c.index[k]; found {
+			c.remove(k, slot)
+			c.metrics.Delete()
+		}
+	}
+}
+
+// Reset clears the cache.
+func (c *SlabCache[K, V]) Reset() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i := uint(0); i < c.size; i++ {
+		c.metrics.Delete()
+	}
+
+	// clear references to let GC collect keys and values, the slab itself is reused
+	for i := range c.items {
+		c.items[i] = slabItem[K, V]{}
+	}
+	c.items = c.items[:0]
+
+	// recreate index
+	c.index = make(map[K]uint32, c.maxsize)
+	c.free = nilslot
+	c.head = nilslot
+	c.tail = nilslot
+	c.size = 0
+
+	return nil
+}
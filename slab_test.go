@@ -0,0 +1,231 @@
+package prehit
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func slabkeys[K comparable, V any](c *SlabCache[K, V]) []K {
+	list := make([]K, 0)
+	for next := c.head; next != nilslot; next = c.items[next].next {
+		list = append(list, c.items[next].key)
+	}
+	return list
+}
+
+func TestSlabCacheBasic(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewSlabCache[string, int](WithMaxSize(20), WithMetrics(metrics))
+
+	// Add case
+	c.Set("test", 1, time.Second)
+	if v, ok := c.Get("test"); !ok || v != 1 {
+		t.Error("Cache set failed")
+	}
+
+	// Update case
+	c.Set("test", 2, time.Second)
+	if v, ok := c.Get("test"); !ok || v != 2 {
+		t.Error("Cache update failed")
+	}
+
+	if metrics.count != 1 || metrics.updates != 1 {
+		t.Error("Cache metrics failed")
+	}
+
+	// Delete case
+	c.Delete("test", "unknown")
+	if _, ok := c.Get("test"); ok {
+		t.Error("Cache delete failed")
+	}
+
+	if metrics.count != 0 || metrics.hits != 2 || metrics.miss != 1 || metrics.errors != 0 {
+		t.Error("Cache metrics failed")
+	}
+
+	// Slot reuse
+	c.Set("test2", 2, time.Second)
+	if len(c.items) != 1 {
+		t.Error("Cache slot reuse failed")
+	}
+
+	// Corruption case
+	c.index["test2"] = 100
+	if _, ok := c.Get("test2"); ok {
+		t.Error("Cache get failed")
+	}
+
+	if metrics.errors != 1 {
+		t.Error("Cache metrics errors failed")
+	}
+}
+
+func TestSlabCacheSetAtMax(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewSlabCache[string, int](WithMaxSize(3), WithMetrics(metrics))
+
+	c.Set("test1", 1, time.Second)
+	c.Set("test2", 2, time.Second)
+	c.Set("test3", 3, time.Second)
+	c.Set("test4", 4, time.Second)
+
+	if _, ok := c.Get("test1"); ok {
+		t.Error("Cache eviction failed")
+	}
+
+	if metrics.count != 3 || metrics.count != int(c.size) || metrics.evicted != 1 {
+		t.Error("Cache metrics failed")
+	}
+
+	if len(c.items) != 3 {
+		t.Error("Cache slab grows over max size")
+	}
+}
+
+func TestSlabCacheGetExpired(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewSlabCache[string, int](WithMaxSize(20), WithMetrics(metrics))
+	c.Set("test", 1, 0)
+	c.Set("test2", 2, time.Second)
+
+	if v, ok := c.Get("test"); ok || v != 0 {
+		t.Error("Cache get failed")
+	}
+
+	if metrics.count != 1 || metrics.evicted != 1 || metrics.miss != 1 {
+		t.Error("Cache metrics failed")
+	}
+
+	if !reflect.DeepEqual([]string{"test2"}, slabkeys(c)) {
+		t.Error("Cache internal failed")
+	}
+}
+
+func TestSlabCacheInternal(t *testing.T) {
+	c := NewSlabCache[string, int](WithMaxSize(10))
+	c.Set("test1", 1, time.Second)
+	c.Set("test2", 2, time.Second)
+	c.Set("test3", 3, time.Second)
+	c.Set("test4", 4, time.Second)
+
+	if !reflect.DeepEqual([]string{"test4", "test3", "test2", "test1"}, slabkeys(c)) {
+		t.Error("Cache internal failed")
+	}
+
+	c.Set("test1", 1, time.Second)
+	if !reflect.DeepEqual([]string{"test1", "test4", "test3", "test2"}, slabkeys(c)) {
+		t.Error("Cache internal failed")
+	}
+
+	c.Get("test2")
+	if !reflect.DeepEqual([]string{"test2", "test1", "test4", "test3"}, slabkeys(c)) {
+		t.Error("Cache internal failed")
+	}
+
+	c.Delete("test4")
+	if !reflect.DeepEqual([]string{"test2", "test1", "test3"}, slabkeys(c)) {
+		t.Error("Cache internal failed")
+	}
+
+	c.Delete("test2", "test3")
+	if !reflect.DeepEqual([]string{"test1"}, slabkeys(c)) || c.head != c.tail {
+		t.Error("Cache internal failed")
+	}
+}
+
+func TestSlabCacheReset(t *testing.T) {
+	metrics := &basicmetrics{}
+	c := NewSlabCache[string, int](WithMaxSize(20), WithMetrics(metrics))
+	c.Set("test1", 1, time.Second)
+	c.Set("test2", 2, time.Second)
+	c.Delete("test1")
+
+	c.Reset()
+
+	if c.head != nilslot || c.tail != nilslot || c.free != nilslot || len(c.items) != 0 {
+		t.Error("Cache reset failed")
+	}
+
+	if metrics.count != 0 {
+		t.Error("Cache metrics count failed")
+	}
+}
+
+// cache benchmark test
+func BenchmarkSlabCacheSetOnLimit(b *testing.B) {
+	c := NewSlabCache[int, int](WithMaxSize(3))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Set(i, i, time.Second)
+	}
+}
+
+func BenchmarkSlabCacheGet(b *testing.B) {
+	c := NewSlabCache[int, int](WithMaxSize((uint)(b.N)))
+	for i := 0; i < b.N; i++ {
+		c.Set(i, i, 100*time.Second)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(i)
+	}
+}
+
+// The GC benchmarks fill a cache with gcItems entries and measure a full GC cycle.
+// Compare BenchmarkGCPointerLayout with BenchmarkGCSlabLayout.
+const gcItems = 1 << 20
+
+func benchmarkGC(b *testing.B, set func(int)) {
+	for i := 0; i < gcItems; i++ {
+		set(i)
+	}
+	runtime.GC()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	pause := stats.PauseTotalNs
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+
+	runtime.ReadMemStats(&stats)
+	b.ReportMetric(float64(stats.PauseTotalNs-pause)/float64(b.N), "pause-ns/op")
+}
+
+func BenchmarkGCPointerLayout(b *testing.B) {
+	c := NewCache[int, int](WithMaxSize(gcItems))
+	benchmarkGC(b, func(i int) { c.Set(i, i, time.Hour) })
+	runtime.KeepAlive(c)
+}
+
+func BenchmarkGCSlabLayout(b *testing.B) {
+	c := NewSlabCache[int, int](WithMaxSize(gcItems))
+	benchmarkGC(b, func(i int) { c.Set(i, i, time.Hour) })
+	runtime.KeepAlive(c)
+}
+
+func BenchmarkFillPointerLayout(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := NewCache[int, int](WithMaxSize(1 << 16))
+		for j := 0; j < 1<<16; j++ {
+			c.Set(j, j, time.Hour)
+		}
+	}
+}
+
+func BenchmarkFillSlabLayout(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := NewSlabCache[int, int](WithMaxSize(1 << 16))
+		for j := 0; j < 1<<16; j++ {
+			c.Set(j, j, time.Hour)
+		}
+	}
+}
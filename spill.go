@@ -0,0 +1,578 @@
+package prehit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// record header: checksum (4 bytes), expiration (8 bytes), key length (4 bytes), value length (4 bytes)
+	spillheader = 20
+
+	defaultspillmax     = 1 << 30
+	defaultspillsegment = 64 << 20
+
+	spillgarbage = 0.5  // compact segments with a larger part of dead records
+	spillqueue   = 4096 // evicted values waiting to be written, more are not spilled
+	spillext     = ".spill"
+	spillwarning = time.Minute // min interval of warnings about skipped spills
+)
+
+// ErrSpillCorrupted is returned when a record read from the disk tier is damaged.
+var ErrSpillCorrupted = errors.New("spill record is corrupted")
+
+// SpillCache is a cache with string keys that spills values evicted by capacity
+// from the in-memory Cache to a disk tier, and promotes them back on memory misses.
+// The disk tier is a set of segmented log files in a directory with an in-memory index.
+// Dead records are compacted away, and the oldest segments are dropped when the disk tier
+// exceeds its max size (WithSpillLimits). The disk tier does not survive restarts:
+// every instance keeps its segments in its own subdirectory removed by Close, so instances
+// may share the directory. Subdirectories left by crashed processes are not removed.
+//
+// Evicted values are queued by the eviction callback and written to the disk tier
+// in the background, so the cache lock is never held for disk I/O.
+type SpillCache[V any] struct {
+	cache *Cache[string, V]
+	disk  *spill
+	codec Codec[V]
+
+	// mutex orders writes of the queue and promotions from the disk tier with Set, Delete and Reset
+	mutex sync.Mutex
+
+	queuemutex sync.Mutex
+	queue      map[string]spilled[V] // evicted values waiting to be written
+	queued     uint64                // number of queued values, orders the writes
+	dropped    atomic.Uint64         // evicted values not spilled because the queue is full
+	warned     atomic.Int64          // time of the last warning about dropped values
+	signal     chan struct{}
+	done       chan struct{}
+	stop       sync.Once
+	wg         sync.WaitGroup
+}
+
+// spilled is an evicted value waiting to be written to the disk tier.
+type spilled[V any] struct {
+	key        string
+	value      V
+	expiration time.Time
+	order      uint64
+}
+
+// NewSpillCache creates a cache spilling to the directory.
+// Options are applied to the in-memory Cache, WithEvictCallback is replaced by spilling.
+func NewSpillCache[V any](dir string, codec Codec[V], o ...Option) (*SpillCache[V], error) {
+	local := &options{
+		spillmax:     defaultspillmax,     // default disk size
+		spillsegment: defaultspillsegment, // default segment size
+	}
+	for _, option := range o {
+		option.apply(local)
+	}
+
+	disk, err := openspill(dir, local.spillmax, local.spillsegment)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SpillCache[V]{
+		disk:   disk,
+		codec:  codec,
+		queue:  make(map[string]spilled[V]),
+		signal: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.cache = NewCache[string, V](append(o, WithEvictCallback(s.spill))...)
+
+	s.wg.Add(1)
+	go s.writer()
+	return s, nil
+}
+
+// spill queues the value evicted by capacity for the disk tier, it runs under the cache lock.
+func (s *SpillCache[V]) spill(key string, v V, reason EvictReason, expiration time.Time) {
+	if reason != EvictCapacity {
+		return
+	}
+
+	s.queuemutex.Lock()
+	_, queued := s.queue[key]
+	if !queued && len(s.queue) >= spillqueue {
+		s.queuemutex.Unlock()
+		s.skipped()
+		return
+	}
+	s.queued++
+	s.queue[key] = spilled[V]{key: key, value: v, expiration: expiration, order: s.queued}
+	s.queuemutex.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// skipped counts the value not spilled because the queue is full,
+// the warning is logged once per spillwarning.
+func (s *SpillCache[V]) skipped() {
+	dropped := s.dropped.Add(1)
+	now := time.Now().UnixNano()
+	if last := s.warned.Load(); now-last >= int64(spillwarning) && s.warned.CompareAndSwap(last, now) {
+		s.cache.logger.Warning(fmt.Sprintf("Spills of %d evicted values skipped: the disk tier is behind", dropped))
+	}
+}
+
+// writer writes queued values to the disk tier until Close.
+func (s *SpillCache[V]) writer() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.signal:
+			s.flush()
+		}
+	}
+}
+
+// flush writes queued values to the disk tier.
+func (s *SpillCache[V]) flush() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queuemutex.Lock()
+	queue := make([]spilled[V], 0, len(s.queue))
+	for _, q := range s.queue {
+		queue = append(queue, q)
+	}
+	s.queue = make(map[string]spilled[V])
+	s.queuemutex.Unlock()
+
+	// the oldest are written first, so they are dropped first when the disk tier is full
+	sort.Slice(queue, func(i, j int) bool { return queue[i].order < queue[j].order })
+	for _, q := range queue {
+		data, err := s.codec.Encode(q.value)
+		if err != nil {
+			s.cache.logger.Warning(fmt.Sprintf("Spill of key %q failed: %v", q.key, err))
+			continue
+		}
+		if err := s.disk.write(q.key, data, q.expiration); err != nil {
+			s.cache.logger.Warning(fmt.Sprintf("Spill of key %q failed: %v", q.key, err))
+		}
+	}
+}
+
+// unqueue drops queued values of the keys, it runs under s.mutex.
+func (s *SpillCache[V]) unqueue(keys ...string) {
+	s.queuemutex.Lock()
+	defer s.queuemutex.Unlock()
+
+	for _, key := range keys {
+		delete(s.queue, key)
+	}
+}
+
+// take removes the value of the key from the queue or from the disk tier, it runs under s.mutex.
+func (s *SpillCache[V]) take(key string) (V, time.Time, bool) {
+	s.queuemutex.Lock()
+	q, queued := s.queue[key]
+	delete(s.queue, key)
+	s.queuemutex.Unlock()
+	if queued {
+		return q.value, q.expiration, true
+	}
+
+	data, expiration, found, err := s.disk.take(key)
+	if err != nil {
+		s.cache.logger.Warning(fmt.Sprintf("Read of spilled key %q failed: %v", key, err))
+		return *new(V), time.Time{}, false
+	}
+	if !found {
+		return *new(V), time.Time{}, false
+	}
+
+	v, err := s.codec.Decode(data)
+	if err != nil {
+		s.cache.logger.Warning(fmt.Sprintf("Decode of spilled key %q failed: %v", key, err))
+		return *new(V), time.Time{}, false
+	}
+	return v, expiration, true
+}
+
+// Cache returns the in-memory tier.
+func (s *SpillCache[V]) Cache() *Cache[string, V] {
+	return s.cache
+}
+
+// Get returns a value for a key from memory or from the disk tier.
+// Values found on disk are moved back to memory.
+func (s *SpillCache[V]) Get(key string) (V, bool) {
+	if v, ok := s.cache.Get(key); ok {
+		return v, true
+	}
+
+	// Delete cannot run between the take and the restore
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, expiration, found := s.take(key)
+	ttl := time.Until(expiration)
+	if !found || ttl <= 0 {
+		return *new(V), false
+	}
+
+	// a value stored concurrently by Set is newer than the spilled one
+	if !s.cache.set(setrestore, key, v, ttl, 0, Found, nil) {
+		return s.cache.Get(key)
+	}
+	return v, true
+}
+
+// Set stores a value for a key in memory, the spilled value of the key is dropped.
+func (s *SpillCache[V]) Set(key string, v V, ttl time.Duration) {
+	s.cache.Set(key, v, ttl)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unqueue(key)
+	s.disk.remove(key)
+}
+
+// Delete removes keys from memory and from the disk tier.
+func (s *SpillCache[V]) Delete(key ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cache.Delete(key...)
+	s.unqueue(key...)
+	for _, k := range key {
+		s.disk.remove(k)
+	}
+}
+
+// Reset clears both tiers.
+func (s *SpillCache[V]) Reset() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.cache.Reset(); err != nil {
+		return err
+	}
+	s.queuemutex.Lock()
+	s.queue = make(map[string]spilled[V])
+	s.queuemutex.Unlock()
+	return s.disk.reset()
+}
+
+// Compact writes queued values, then rewrites segments with dead records and drops expired records.
+func (s *SpillCache[V]) Compact() error {
+	s.flush()
+	return s.disk.compact()
+}
+
+// Spilled writes queued values and returns the number of keys and the size in bytes of the disk tier.
+func (s *SpillCache[V]) Spilled() (int, uint64) {
+	s.flush()
+	return s.disk.stats()
+}
+
+// Close closes the in-memory cache and removes the segment files.
+func (s *SpillCache[V]) Close() error {
+	s.stop.Do(func() { close(s.done) })
+	s.wg.Wait()
+	s.cache.Close()
+	return s.disk.close()
+}
+
+// spillsegment is a single log file of the disk tier.
+type spillsegment struct {
+	id   uint32
+	file *os.File
+	size uint64 // bytes written
+	live uint64 // bytes of indexed records
+}
+
+// spilllocation is a position of a record.
+type spilllocation struct {
+	segment    *spillsegment
+	offset     uint64
+	length     uint64
+	expiration time.Time
+}
+
+// spill is the disk tier: append-only segments with an in-memory index.
+type spill struct {
+	dir         string
+	max         uint64
+	segmentsize uint64
+
+	mutex    sync.Mutex
+	index    map[string]spilllocation
+	segments []*spillsegment // from the oldest, the last one is active
+	size     uint64
+	next     uint32
+}
+
+// openspill creates the disk tier in a new subdirectory of the directory.
+func openspill(dir string, max uint64, segmentsize uint64) (*spill, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(dir, "prehit-*")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spill{dir: dir, max: max, segmentsize: segmentsize, index: make(map[string]spilllocation)}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// rotate starts a new active segment.
+func (s *spill) rotate() error {
+	s.next++
+	file, err := os.OpenFile(filepath.Join(s.dir, fmt.Sprintf("%08d%s", s.next, spillext)), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, &spillsegment{id: s.next, file: file})
+	return nil
+}
+
+func (s *spill) active() *spillsegment {
+	return s.segments[len(s.segments)-1]
+}
+
+// append writes the record to the active segment and indexes it.
+func (s *spill) append(key string, value []byte, expiration time.Time) error {
+	if len(s.segments) == 0 { // closed
+		return os.ErrClosed
+	}
+	if s.active().size >= s.segmentsize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, spillheader+len(key)+len(value))
+	binary.LittleEndian.PutUint64(record[4:], uint64(expiration.UnixNano()))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[16:], uint32(len(value)))
+	copy(record[spillheader:], key)
+	copy(record[spillheader+len(key):], value)
+	binary.LittleEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+
+	segment := s.active()
+	if _, err := segment.file.WriteAt(record, int64(segment.size)); err != nil {
+		return err
+	}
+
+	s.unindex(key)
+	s.index[key] = spilllocation{segment: segment, offset: segment.size, length: uint64(len(record)), expiration: expiration}
+	segment.size += uint64(len(record))
+	segment.live += uint64(len(record))
+	s.size += uint64(len(record))
+	return nil
+}
+
+// read returns the value of the record at the location.
+func (s *spill) read(location spilllocation, key string) ([]byte, error) {
+	record := make([]byte, location.length)
+	if _, err := location.segment.file.ReadAt(record, int64(location.offset)); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(record) != crc32.ChecksumIEEE(record[4:]) ||
+		binary.LittleEndian.Uint32(record[12:]) != uint32(len(key)) ||
+		string(record[spillheader:spillheader+len(key)]) != key {
+		return nil, ErrSpillCorrupted
+	}
+	return record[spillheader+len(key):], nil
+}
+
+// unindex removes the key from the index, its record becomes dead.
+func (s *spill) unindex(key string) {
+	if location, found := s.index[key]; found {
+		location.segment.live -= location.length
+		delete(s.index, key)
+	}
+}
+
+func (s *spill) write(key string, value []byte, expiration time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !expiration.After(time.Now()) {
+		return nil
+	}
+
+	if err := s.append(key, value, expiration); err != nil {
+		return err
+	}
+
+	if s.size > s.max {
+		if err := s.shrink(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take removes the key from the disk tier and returns its value.
+func (s *spill) take(key string) ([]byte, time.Time, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	location, found := s.index[key]
+	if !found {
+		return nil, time.Time{}, false, nil
+	}
+	s.unindex(key)
+
+	if !location.expiration.After(time.Now()) {
+		return nil, time.Time{}, false, nil
+	}
+
+	value, err := s.read(location, key)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return value, location.expiration, true, nil
+}
+
+func (s *spill) remove(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.unindex(key)
+}
+
+// shrink compacts segments and drops the oldest ones until the disk tier fits its max size.
+func (s *spill) shrink() error {
+	if err := s.compactlocked(); err != nil {
+		return err
+	}
+
+	for s.size > s.max && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		for key, location := range s.index {
+			if location.segment == oldest {
+				delete(s.index, key)
+			}
+		}
+		if err := s.drop(oldest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drop removes the segment, its records must not be indexed.
+func (s *spill) drop(segment *spillsegment) error {
+	for i := range s.segments {
+		if s.segments[i] == segment {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	s.size -= segment.size
+	segment.file.Close()
+	return os.Remove(segment.file.Name())
+}
+
+func (s *spill) compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.compactlocked()
+}
+
+// compactlocked moves live records of inactive segments with much garbage to the active segment.
+func (s *spill) compactlocked() error {
+	now := time.Now()
+
+	// expired records are dead
+	for key, location := range s.index {
+		if !location.expiration.After(now) {
+			s.unindex(key)
+		}
+	}
+
+	candidates := make(map[*spillsegment]bool)
+	for _, segment := range s.segments[:len(s.segments)-1] {
+		if float64(segment.size-segment.live) > float64(segment.size)*spillgarbage {
+			candidates[segment] = true
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	for key, location := range s.index {
+		if !candidates[location.segment] {
+			continue
+		}
+		value, err := s.read(location, key)
+		if err != nil {
+			s.unindex(key) // damaged records are dropped
+			continue
+		}
+		if err := s.append(key, value, location.expiration); err != nil {
+			return err
+		}
+	}
+
+	for segment := range candidates {
+		if err := s.drop(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *spill) stats() (int, uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.index), s.size
+}
+
+// reset removes all records and segments.
+func (s *spill) reset() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.index = make(map[string]spilllocation)
+	for len(s.segments) > 0 {
+		if err := s.drop(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	return s.rotate()
+}
+
+func (s *spill) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.index = make(map[string]spilllocation)
+	for len(s.segments) > 0 {
+		if err := s.drop(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(s.dir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
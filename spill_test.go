@@ -0,0 +1,366 @@
+package prehit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpillCache(t *testing.T) {
+	s, err := NewSpillCache[string](t.TempDir(), JSONCodec[string]{}, WithMaxSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 5; i++ {
+		s.Set(fmt.Sprint(i), strings.Repeat("v", i), time.Hour)
+	}
+
+	// three keys are spilled by capacity
+	if n, size := s.Spilled(); n != 3 || size == 0 {
+		t.Errorf("Unexpected spilled keys %d (%d bytes)", n, size)
+	}
+	if s.Cache().Stats().Size != 2 {
+		t.Error("Unexpected memory size")
+	}
+
+	// a disk hit is promoted back to memory
+	if v, ok := s.Get("1"); !ok || v != "v" {
+		t.Errorf("Unexpected value %q", v)
+	}
+	if _, ok := s.Cache().Get("1"); !ok {
+		t.Error("Spilled value must be promoted")
+	}
+	if n, _ := s.Spilled(); n != 3 { // 1 is taken, the evicted tail is spilled
+		t.Errorf("Unexpected spilled keys %d", n)
+	}
+
+	// Set drops the spilled value
+	s.Set("0", "new", time.Hour)
+	if v, ok := s.Get("0"); !ok || v != "new" {
+		t.Errorf("Unexpected value %q", v)
+	}
+
+	s.Delete("2", "3", "4")
+	for _, key := range []string{"2", "3", "4"} {
+		if _, ok := s.Get(key); ok {
+			t.Errorf("Key %s must be deleted", key)
+		}
+	}
+
+	if _, ok := s.Get("unknown"); ok {
+		t.Error("Unknown key must not be found")
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if n, size := s.Spilled(); n != 0 || size != 0 {
+		t.Error("Disk tier must be empty after reset")
+	}
+	if _, ok := s.Get("1"); ok {
+		t.Error("Cache must be empty after reset")
+	}
+}
+
+func TestSpillDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "00000001"+spillext), []byte("stale"), 0o644)
+
+	a, err := NewSpillCache[string](dir, JSONCodec[string]{}, WithMaxSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewSpillCache[string](dir, JSONCodec[string]{}, WithMaxSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// instances sharing the directory keep their own segments
+	a.Set("a", "a", time.Hour)
+	a.Set("b", "b", time.Hour)
+	a.Spilled()
+	if filepath.Dir(a.disk.dir) != dir || a.disk.dir == b.disk.dir {
+		t.Errorf("Unexpected directories %s and %s", a.disk.dir, b.disk.dir)
+	}
+
+	// Close removes only the segments of the instance
+	a.Close()
+	if _, err := os.Stat(a.disk.dir); !os.IsNotExist(err) {
+		t.Error("Directory of the closed instance must be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00000001"+spillext)); err != nil {
+		t.Error("Stale file must be kept")
+	}
+	if _, err := os.Stat(b.disk.active().file.Name()); err != nil {
+		t.Error("Segment of another instance must be kept")
+	}
+}
+
+func TestSpillSkipped(t *testing.T) {
+	s, err := NewSpillCache[int](t.TempDir(), JSONCodec[int]{}, WithMaxSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// values evicted while the queue is full are counted, the warning is rate limited
+	s.queuemutex.Lock()
+	for i := 0; i < spillqueue; i++ {
+		s.queue[fmt.Sprint("queued", i)] = spilled[int]{}
+	}
+	s.queuemutex.Unlock()
+	s.spill("a", 1, EvictCapacity, time.Now().Add(time.Hour))
+	warned := s.warned.Load()
+	s.spill("b", 2, EvictCapacity, time.Now().Add(time.Hour))
+	if s.dropped.Load() != 2 || warned == 0 || s.warned.Load() != warned {
+		t.Errorf("Unexpected %d dropped values", s.dropped.Load())
+	}
+}
+
+func TestSpillCacheExpiration(t *testing.T) {
+	s, err := NewSpillCache[int](t.TempDir(), JSONCodec[int]{}, WithMaxSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Set("a", 1, 20*time.Millisecond)
+	s.Set("b", 2, time.Hour)
+	if n, _ := s.Spilled(); n != 1 {
+		t.Fatal("Key must be spilled")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := s.Get("a"); ok {
+		t.Error("Expired spilled key must not be found")
+	}
+
+	// expired values are not spilled
+	s.Set("c", 3, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	s.Set("d", 4, time.Hour)
+	s.Set("e", 5, time.Hour)
+	if _, ok := s.Get("c"); ok {
+		t.Error("Expired key must not be found")
+	}
+}
+
+func TestSpillCompaction(t *testing.T) {
+	s, err := NewSpillCache[string](t.TempDir(), JSONCodec[string]{}, WithMaxSize(1), WithSpillLimits(1<<20, 256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	value := strings.Repeat("x", 50)
+	for i := 0; i < 20; i++ {
+		s.Set(fmt.Sprint(i), value, time.Hour)
+	}
+	_, before := s.Spilled()
+
+	// most spilled keys become dead
+	for i := 0; i < 15; i++ {
+		s.Delete(fmt.Sprint(i))
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	n, after := s.Spilled()
+	if n != 4 || after >= before {
+		t.Errorf("Unexpected disk tier after compaction: %d keys, %d -> %d bytes", n, before, after)
+	}
+	for i := 15; i < 19; i++ {
+		if v, ok := s.Get(fmt.Sprint(i)); !ok || v != value {
+			t.Errorf("Key %d must survive compaction", i)
+		}
+	}
+}
+
+func TestSpillLimit(t *testing.T) {
+	s, err := NewSpillCache[string](t.TempDir(), JSONCodec[string]{}, WithMaxSize(1), WithSpillLimits(1024, 256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	value := strings.Repeat("x", 50)
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprint(i), value, time.Hour)
+	}
+
+	// the oldest segments are dropped
+	n, size := s.Spilled()
+	if size > 1024 || n == 0 || n >= 99 {
+		t.Errorf("Unexpected disk tier: %d keys, %d bytes", n, size)
+	}
+	if _, ok := s.Get("0"); ok {
+		t.Error("The oldest key must be dropped")
+	}
+	if _, ok := s.Get("98"); !ok {
+		t.Error("The newest spilled key must be kept")
+	}
+}
+
+func TestSpillCorruption(t *testing.T) {
+	s, err := NewSpillCache[string](t.TempDir(), JSONCodec[string]{}, WithMaxSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Set("a", "value", time.Hour)
+	s.Set("b", "value", time.Hour)
+	s.Spilled() // a is written
+
+	segment := s.disk.active()
+	segment.file.WriteAt([]byte("garbage"), spillheader)
+	if _, ok := s.Get("a"); ok {
+		t.Error("Corrupted record must not be returned")
+	}
+}
+
+func TestSpillCacheConcurrency(t *testing.T) {
+	s, err := NewSpillCache[int](t.TempDir(), JSONCodec[int]{}, WithMaxSize(10), WithSpillLimits(1<<20, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprint((i * (w + 1)) % 50)
+				if i%3 == 0 {
+					s.Set(key, i, time.Hour)
+				} else {
+					s.Get(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if err := s.Cache().Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEvictCallback(t *testing.T) {
+	var evicted []string
+	c := NewCache[string, int](WithMaxSize(2), WithEvictCallback(func(key string, _ int, reason EvictReason, _ time.Time) {
+		evicted = append(evicted, key+":"+reason.String())
+	}))
+
+	c.Set("a", 1, time.Hour)
+	c.SetMissing("b", time.Hour)
+	c.Set("c", 3, time.Hour) // a
+	c.Set("d", 4, time.Hour) // b is negative
+	c.Set("e", 5, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	c.Get("e")
+
+	if len(evicted) != 3 || evicted[0] != "a:capacity" || evicted[1] != "c:capacity" || evicted[2] != "e:expired" {
+		t.Errorf("Unexpected evictions %v", evicted)
+	}
+
+	// mismatched callback is ignored
+	NewCache[int, int](WithEvictCallback(func(string, int, EvictReason, time.Time) {})).Set(1, 1, time.Hour)
+}
+
+// blockingcodec blocks encoding until released.
+type blockingcodec struct {
+	JSONCodec[int]
+	encoding chan struct{}
+	release  chan struct{}
+}
+
+func (c blockingcodec) Encode(v int) ([]byte, error) {
+	select {
+	case c.encoding <- struct{}{}:
+	default:
+	}
+	<-c.release
+	return c.JSONCodec.Encode(v)
+}
+
+func TestSpillCacheBackground(t *testing.T) {
+	codec := blockingcodec{encoding: make(chan struct{}, 1), release: make(chan struct{})}
+	s, err := NewSpillCache[int](t.TempDir(), codec, WithMaxSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Set("a", 1, time.Hour)
+	s.Set("b", 2, time.Hour)
+	s.Set("c", 3, time.Hour) // a is spilled
+	<-codec.encoding
+
+	// readers do not wait for the disk tier
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Cache().Get("b")
+		s.Cache().Set("d", 4, time.Hour) // b is queued
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Cache is blocked by the spill")
+	}
+
+	// queued values are found before they are written
+	if v, ok := s.Get("b"); !ok || v != 2 {
+		t.Errorf("Expected queued value, got %v %v", v, ok)
+	}
+
+	close(codec.release)
+	if v, ok := s.Get("a"); !ok || v != 1 {
+		t.Errorf("Expected spilled value, got %v %v", v, ok)
+	}
+}
+
+func TestSpillCacheDelete(t *testing.T) {
+	s, err := NewSpillCache[int](t.TempDir(), JSONCodec[int]{}, WithMaxSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprint(i)
+		s.Set(key, i, time.Hour)
+		for j := 0; j < 4; j++ { // key is spilled
+			s.Set(fmt.Sprint("fill", j), j, time.Hour)
+		}
+		s.Spilled()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.Get(key)
+		}()
+		go func() {
+			defer wg.Done()
+			s.Delete(key)
+		}()
+		wg.Wait()
+
+		// a deleted key does not come back
+		if _, ok := s.Get(key); ok {
+			t.Fatalf("Deleted key %q is restored", key)
+		}
+	}
+}
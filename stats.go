@@ -0,0 +1,202 @@
+package prehit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of cache statistics.
+type Stats struct {
+	Hits        uint64  // number of found values
+	Misses      uint64  // number of unknown keys
+	MissingHits uint64  // number of keys known to be missing
+	ErrorHits   uint64  // number of cached errors
+	Evictions   uint64  // number of evicted items
+	Expired     uint64  // number of items evicted on expiration
+	Capacity    uint64  // number of items evicted to free space
+	Adds        uint64  // number of added items
+	Updates     uint64  // number of updated items
+	Deletes     uint64  // number of removed items (including evicted)
+	Errors      uint64  // number of cache structure errors
+	Size        uint    // current number of items
+	MaxSize     uint    // current max number of items
+	HitRatio    float64 // part of lookups served from the cache, negative hits are counted as hits
+	HitRate     Rate    // lookups served from the cache per second
+	MissRate    Rate    // unknown keys per second
+}
+
+// Rate is a number of events per second averaged over 1, 5 and 15 minutes.
+type Rate struct {
+	M1  float64
+	M5  float64
+	M15 float64
+}
+
+const (
+	ratetick     = 5 * time.Second
+	ratemaxticks = 720 // one hour, older history does not affect the 15 minutes average
+)
+
+// rate alphas for exponentially weighted moving averages ticked every 5 seconds
+var ratealphas = [3]float64{
+	1 - math.Exp(-5.0/60),
+	1 - math.Exp(-5.0/300),
+	1 - math.Exp(-5.0/900),
+}
+
+// meter computes moving averages of a counter.
+type meter struct {
+	last  uint64
+	rates [3]float64
+}
+
+// tick updates averages with the counter value for the number of elapsed ticks.
+// Events are spread evenly over the ticks.
+func (m *meter) tick(count uint64, ticks int) {
+	instant := float64(count-m.last) / float64(ticks) / ratetick.Seconds()
+	m.last = count
+	if ticks > ratemaxticks {
+		ticks = ratemaxticks
+	}
+	for i := 0; i < ticks; i++ {
+		for j, alpha := range ratealphas {
+			m.rates[j] += alpha * (instant - m.rates[j])
+		}
+	}
+}
+
+func (m *meter) rate() Rate {
+	return Rate{M1: m.rates[0], M5: m.rates[1], M15: m.rates[2]}
+}
+
+// stats keeps cache statistics in atomic counters.
+// Moving averages are updated lazily by Cache.Stats, so they cost nothing when unused.
+type stats struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	missinghits atomic.Uint64
+	errorhits   atomic.Uint64
+	expired     atomic.Uint64
+	capacity    atomic.Uint64
+	adds        atomic.Uint64
+	updates     atomic.Uint64
+	deletes     atomic.Uint64
+	errors      atomic.Uint64
+
+	mutex    sync.Mutex
+	lasttick time.Time
+	hitrate  meter
+	missrate meter
+}
+
+func newstats(now time.Time) *stats {
+	return &stats{lasttick: now}
+}
+
+// rates returns moving averages catching up all ticks elapsed since the previous call.
+func (s *stats) rates(now time.Time, hits uint64, misses uint64) (Rate, Rate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if ticks := int(now.Sub(s.lasttick) / ratetick); ticks > 0 {
+		s.hitrate.tick(hits, ticks)
+		s.missrate.tick(misses, ticks)
+		s.lasttick = s.lasttick.Add(time.Duration(ticks) * ratetick)
+	}
+
+	return s.hitrate.rate(), s.missrate.rate()
+}
+
+// Stats returns the current statistics of the cache.
+// Moving averages are updated on every call, so at least one call per few minutes is
+// needed for them to follow changes of the load precisely.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mutex.RLock()
+	size, maxsize := c.size, c.maxsize
+	c.mutex.RUnlock()
+
+	st := Stats{
+		Hits:        c.stats.hits.Load(),
+		Misses:      c.stats.misses.Load(),
+		MissingHits: c.stats.missinghits.Load(),
+		ErrorHits:   c.stats.errorhits.Load(),
+		Expired:     c.stats.expired.Load(),
+		Capacity:    c.stats.capacity.Load(),
+		Adds:        c.stats.adds.Load(),
+		Updates:     c.stats.updates.Load(),
+		Deletes:     c.stats.deletes.Load(),
+		Errors:      c.stats.errors.Load(),
+		Size:        size,
+		MaxSize:     maxsize,
+	}
+	st.Evictions = st.Expired + st.Capacity
+
+	if hits := st.Hits + st.MissingHits + st.ErrorHits; hits+st.Misses > 0 {
+		st.HitRatio = float64(hits) / float64(hits+st.Misses)
+	}
+
+	st.HitRate, st.MissRate = c.stats.rates(time.Now(), st.Hits+st.MissingHits+st.ErrorHits, st.Misses)
+
+	return st
+}
+
+func (c *Cache[K, V]) trackhit() {
+	c.stats.hits.Add(1)
+	c.metrics.Hit()
+}
+
+func (c *Cache[K, V]) trackmiss() {
+	c.stats.misses.Add(1)
+	c.metrics.Miss()
+}
+
+func (c *Cache[K, V]) trackmissinghit() {
+	c.stats.missinghits.Add(1)
+	c.negative.MissingHit()
+}
+
+func (c *Cache[K, V]) trackerrorhit() {
+	c.stats.errorhits.Add(1)
+	c.negative.ErrorHit()
+}
+
+func (c *Cache[K, V]) trackerror() {
+	c.stats.errors.Add(1)
+	c.metrics.Error()
+}
+
+func (c *Cache[K, V]) trackadd() {
+	c.stats.adds.Add(1)
+	c.metrics.Add()
+}
+
+func (c *Cache[K, V]) trackupdate() {
+	c.stats.updates.Add(1)
+	c.metrics.Update()
+}
+
+func (c *Cache[K, V]) trackevict(reason EvictReason, created time.Time, cost uint64) {
+	if reason == EvictExpired {
+		c.stats.expired.Add(1)
+	} else {
+		c.stats.capacity.Add(1)
+	}
+	c.metrics.Evict()
+	if c.extended != nil {
+		c.extended.Evicted(reason, time.Since(created), cost)
+	}
+}
+
+// tracklatency reports the duration of the operation started at the given time.
+func (c *Cache[K, V]) tracklatency(op Op, start time.Time) {
+	if c.extended != nil {
+		c.extended.Latency(op, time.Since(start))
+	}
+}
+
+func (c *Cache[K, V]) trackdelete() {
+	c.stats.deletes.Add(1)
+	c.metrics.Delete()
+}
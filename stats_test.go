@@ -0,0 +1,87 @@
+package prehit
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCacheStats(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(2))
+
+	c.Set("test1", 1, time.Second)
+	c.Set("test1", 1, time.Second)
+	c.Set("test2", 2, 0)
+	c.Set("test3", 3, time.Second) // evicts test1
+	c.Get("test3")
+	c.Get("test2") // expired
+	c.Get("test1") // miss
+	c.SetMissing("test4", time.Second)
+	c.Lookup("test4")
+	c.Delete("test3")
+
+	st := c.Stats()
+	expected := Stats{
+		Hits:        1,
+		Misses:      2,
+		MissingHits: 1,
+		Evictions:   2,
+		Expired:     1,
+		Capacity:    1,
+		Adds:        4,
+		Updates:     1,
+		Deletes:     3,
+		Size:        1,
+		MaxSize:     2,
+		HitRatio:    0.5,
+	}
+	st.HitRate, st.MissRate = Rate{}, Rate{}
+	if st != expected {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
+
+func TestCacheStatsRates(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20))
+	c.Set("test", 1, time.Minute)
+
+	if st := c.Stats(); st.HitRate != (Rate{}) || st.HitRatio != 0 {
+		t.Error("Unexpected rates without lookups")
+	}
+
+	// 60 hits per 5 seconds during one minute
+	for tick := 0; tick < 12; tick++ {
+		for i := 0; i < 60; i++ {
+			c.Get("test")
+		}
+		c.stats.lasttick = c.stats.lasttick.Add(-ratetick)
+		c.Stats()
+	}
+
+	st := c.Stats()
+	if st.HitRate.M1 < 7 || st.HitRate.M1 > 12 {
+		t.Errorf("Unexpected 1 minute rate %f", st.HitRate.M1)
+	}
+	if !(st.HitRate.M1 > st.HitRate.M5 && st.HitRate.M5 > st.HitRate.M15 && st.HitRate.M15 > 0) {
+		t.Errorf("Unexpected rates %+v", st.HitRate)
+	}
+	if st.MissRate != (Rate{}) {
+		t.Error("Unexpected miss rate")
+	}
+
+	// a long pause decays the rates
+	c.stats.lasttick = c.stats.lasttick.Add(-time.Hour)
+	if st := c.Stats(); st.HitRate.M1 > 0.001 || st.HitRate.M15 > 0.1 {
+		t.Errorf("Unexpected rates after pause %+v", st.HitRate)
+	}
+}
+
+func TestMeterTick(t *testing.T) {
+	m := &meter{}
+	m.tick(uint64(ratemaxticks*5), ratemaxticks*10)
+
+	// the rate converges to the instant rate
+	if r := m.rate(); math.Abs(r.M1-0.1) > 1e-6 {
+		t.Errorf("Unexpected rate %+v", r)
+	}
+}
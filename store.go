@@ -0,0 +1,282 @@
+package prehit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	storetimeout = 10 * time.Second // limits a single write started by the cache
+	storeretries = 3                // attempts of the final flush on Close
+	storestripes = 64               // locks serializing write-through of keys
+)
+
+// ErrPendingLimit is reported to the store error handler for changes rejected
+// because the number of changes waiting for write-behind reached WithMaxPending.
+var ErrPendingLimit = errors.New("too many changes waiting for write-behind")
+
+// Entry is a change of a key written to a Store.
+type Entry[K comparable, V any] struct {
+	Key        K
+	Value      V
+	Expiration time.Time // expiration of the value in the cache
+	Deleted    bool      // the key is deleted, the value is not set
+}
+
+// Store is a backing store behind the cache set by WithWriteThrough or WithWriteBehind.
+// Negative entries (SetMissing, SetError) are not written.
+type Store[K comparable, V any] interface {
+	Write(ctx context.Context, entries []Entry[K, V]) error
+}
+
+// pendingwrite is a coalesced change of a key waiting for write-behind.
+type pendingwrite struct {
+	seq     uint64
+	deleted bool
+}
+
+// writebehind is the state of asynchronous writes, pending and seq are guarded by the cache lock.
+type writebehind[K comparable] struct {
+	interval time.Duration
+	batch    int
+	max      uint // max pending changes, zero means the max size of the cache
+	pending  map[K]pendingwrite
+	seq      uint64
+	signal   chan struct{}
+	flushing sync.Mutex // serializes flushes
+	wg       sync.WaitGroup
+}
+
+// storeconfig is a configuration of the store set by options.
+type storeconfig struct {
+	store    any
+	behind   bool
+	interval time.Duration
+	batch    int
+}
+
+// keylocks serializes write-through of keys, so the store and the cache get concurrent
+// changes of a key in the same order.
+type keylocks [storestripes]sync.Mutex
+
+// lock locks the stripes of the keys in order and returns the unlock function.
+func (l *keylocks) lock(hashes ...uint64) func() {
+	stripes := make([]int, 0, len(hashes))
+	for _, hash := range hashes {
+		stripes = append(stripes, int(hash%storestripes))
+	}
+	sort.Ints(stripes)
+
+	locked := stripes[:0]
+	for i, stripe := range stripes {
+		if i == 0 || stripe != stripes[i-1] {
+			l[stripe].Lock()
+			locked = append(locked, stripe)
+		}
+	}
+	return func() {
+		for _, stripe := range locked {
+			l[stripe].Unlock()
+		}
+	}
+}
+
+// lockkeys serializes write-through of the keys, it returns a no-op without write-through.
+func (c *Cache[K, V]) lockkeys(keys ...K) func() {
+	if c.writes == nil {
+		return func() {}
+	}
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i] = hashkey(key)
+	}
+	return c.writes.lock(hashes...)
+}
+
+// writethrough writes entries synchronously in the write-through mode.
+func (c *Cache[K, V]) writethrough(entries []Entry[K, V]) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storetimeout)
+	defer cancel()
+
+	err := c.store.Write(ctx, entries)
+	if err != nil {
+		c.logger.Warning(fmt.Sprintf("Write to the store failed: %v", err))
+		keys := make([]K, len(entries))
+		for i, e := range entries {
+			keys[i] = e.Key
+		}
+		c.storefailed(keys, err)
+	}
+	return err
+}
+
+// storefailed reports the failed change of the keys, the caller does not hold the lock.
+func (c *Cache[K, V]) storefailed(keys []K, err error) {
+	c.trackerror()
+	if c.storeerrors != nil {
+		c.storeerrors(keys, err)
+	}
+}
+
+// admitspending reports whether a change of the key fits into the pending limit,
+// the caller holds the write lock.
+func (c *Cache[K, V]) admitspending(key K) bool {
+	b := c.behind
+	max := b.max
+	if max == 0 {
+		max = c.maxsize
+	}
+	_, pending := b.pending[key]
+	return pending || uint(len(b.pending)) < max
+}
+
+// markdirty records the change of the key for write-behind, the caller holds the write lock.
+func (c *Cache[K, V]) markdirty(key K, deleted bool) uint64 {
+	b := c.behind
+	b.seq++
+	b.pending[key] = pendingwrite{seq: b.seq, deleted: deleted}
+	if len(b.pending) >= b.batch {
+		c.signalflush()
+	}
+	return b.seq
+}
+
+// signalflush wakes up the write-behind worker without blocking.
+func (c *Cache[K, V]) signalflush() {
+	select {
+	case c.behind.signal <- struct{}{}:
+	default:
+	}
+}
+
+// writebehind flushes dirty entries every interval or when a batch is collected.
+// Failed writes are retried on the next interval.
+func (c *Cache[K, V]) writebehind() {
+	defer c.behind.wg.Done()
+
+	ticker := time.NewTicker(c.behind.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		case <-c.behind.signal:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), storetimeout)
+		if err := c.Flush(ctx); err != nil {
+			c.logger.Warning(fmt.Sprintf("Write-behind flush failed, it is retried later: %v", err))
+		}
+		cancel()
+	}
+}
+
+// Flush writes pending changes to the store in the write-behind mode.
+func (c *Cache[K, V]) Flush(ctx context.Context) error {
+	if c.behind == nil {
+		return nil
+	}
+
+	c.behind.flushing.Lock()
+	defer c.behind.flushing.Unlock()
+
+	for {
+		n, err := c.flushbatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n < c.behind.batch { // nothing left
+			return nil
+		}
+	}
+}
+
+// flushbatch writes one batch of pending changes and returns the number of processed keys.
+func (c *Cache[K, V]) flushbatch(ctx context.Context) (int, error) {
+	type sent struct {
+		key K
+		seq uint64
+	}
+
+	c.mutex.RLock()
+	entries := make([]Entry[K, V], 0, c.behind.batch)
+	batch := make([]sent, 0, c.behind.batch)
+	for key, p := range c.behind.pending {
+		if len(batch) == c.behind.batch {
+			break
+		}
+		batch = append(batch, sent{key: key, seq: p.seq})
+		if p.deleted {
+			entries = append(entries, Entry[K, V]{Key: key, Deleted: true})
+		} else if item, found := c.index[key]; found && item != nil && item.dirty() == p.seq && item.status() == Found {
+			entries = append(entries, Entry[K, V]{Key: key, Value: item.value, Expiration: item.expiration})
+		} // else the value is replaced by a negative entry and there is nothing to write
+	}
+	c.mutex.RUnlock()
+
+	if len(entries) > 0 {
+		if err := c.store.Write(ctx, entries); err != nil {
+			keys := make([]K, len(entries))
+			for i, e := range entries {
+				keys[i] = e.Key
+			}
+			c.storefailed(keys, err)
+			return 0, err
+		}
+	}
+
+	c.mutex.Lock()
+	for _, s := range batch {
+		if c.behind.pending[s.key].seq == s.seq { // not changed during the write
+			delete(c.behind.pending, s.key)
+		}
+		if item, found := c.index[s.key]; found && item != nil && item.dirty() == s.seq {
+			item.extra.dirty = 0
+		}
+	}
+	c.mutex.Unlock()
+
+	return len(batch), nil
+}
+
+// Pending returns the number of changes waiting for write-behind.
+func (c *Cache[K, V]) Pending() int {
+	if c.behind == nil {
+		return 0
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return len(c.behind.pending)
+}
+
+// closestore stops the write-behind worker and flushes pending changes.
+func (c *Cache[K, V]) closestore() error {
+	if c.behind == nil {
+		return nil
+	}
+	c.behind.wg.Wait()
+
+	var err error
+	for attempt := 0; attempt < storeretries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.behind.interval)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), storetimeout)
+		err = c.Flush(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+
+	c.logger.Warning(fmt.Sprintf("Final write-behind flush failed, %d changes are lost: %v", c.Pending(), err))
+	return err
+}
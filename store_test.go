@@ -0,0 +1,364 @@
+package prehit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorystore is a Store keeping the last written values.
+type memorystore[K comparable, V any] struct {
+	mutex  sync.Mutex
+	values map[K]V
+	writes int
+	fail   bool
+}
+
+func (m *memorystore[K, V]) Write(_ context.Context, entries []Entry[K, V]) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.fail {
+		return errors.New("store is down")
+	}
+	if m.values == nil {
+		m.values = make(map[K]V)
+	}
+	m.writes++
+	for _, e := range entries {
+		if e.Deleted {
+			delete(m.values, e.Key)
+		} else {
+			m.values[e.Key] = e.Value
+		}
+	}
+	return nil
+}
+
+func (m *memorystore[K, V]) get(key K) (V, bool, int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	v, found := m.values[key]
+	return v, found, m.writes
+}
+
+func (m *memorystore[K, V]) setfail(fail bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.fail = fail
+}
+
+func TestWriteThrough(t *testing.T) {
+	store := &memorystore[string, int]{}
+	c := NewCache[string, int](WithWriteThrough[string, int](store))
+
+	c.Set("a", 1, time.Hour)
+	if v, found, _ := store.get("a"); !found || v != 1 {
+		t.Error("Value must be written synchronously")
+	}
+
+	// negative entries are not written
+	c.SetMissing("b", time.Hour)
+	if _, found, writes := store.get("b"); found || writes != 1 {
+		t.Error("Negative entries must not be written")
+	}
+
+	c.Delete("a")
+	if _, found, _ := store.get("a"); found {
+		t.Error("Delete must be written synchronously")
+	}
+
+	// failed write does not change the cache
+	c.Set("c", 1, time.Hour)
+	store.setfail(true)
+	c.Set("c", 2, time.Hour)
+	if v, _ := c.Get("c"); v != 1 {
+		t.Error("Cache must not be changed when the write fails")
+	}
+	if st := c.Stats(); st.Errors != 1 {
+		t.Errorf("Expected one error, got %d", st.Errors)
+	}
+
+	// conditional sets write only stored values and write before inserting
+	store.setfail(false)
+	if c.Add("c", 3, time.Hour) {
+		t.Error("Add must not store an existing key")
+	}
+	if v, _, _ := store.get("c"); v != 1 {
+		t.Error("Rejected add must not be written")
+	}
+	store.setfail(true)
+	if c.Add("d", 1, time.Hour) || c.Replace("c", 3, time.Hour) {
+		t.Error("Conditional sets must fail when the write fails")
+	}
+	if _, ok := c.Get("d"); ok {
+		t.Error("Failed add must not change the cache")
+	}
+	if v, _ := c.Get("c"); v != 1 {
+		t.Error("Failed replace must not change the cache")
+	}
+	store.setfail(false)
+	if !c.Replace("c", 3, time.Hour) {
+		t.Error("Replace must store an existing key")
+	}
+	if v, _, _ := store.get("c"); v != 3 {
+		t.Error("Replaced value must be written")
+	}
+
+	// mismatched store is ignored
+	NewCache[int, int](WithWriteThrough[string, int](store)).Set(1, 1, time.Hour)
+}
+
+func TestWriteBehind(t *testing.T) {
+	store := &memorystore[string, int]{}
+	c := NewCache[string, int](WithWriteBehind[string, int](store, time.Hour, 100))
+
+	// changes are coalesced
+	for i := 0; i < 10; i++ {
+		c.Set("a", i, time.Hour)
+	}
+	c.Set("b", 1, time.Hour)
+	c.Set("c", 1, time.Hour)
+	c.Delete("c")
+
+	if _, found, _ := store.get("a"); found {
+		t.Error("Value must not be written synchronously")
+	}
+	if c.Pending() != 3 {
+		t.Errorf("Expected 3 pending changes, got %d", c.Pending())
+	}
+
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v, found, writes := store.get("a"); !found || v != 9 || writes != 1 {
+		t.Errorf("Unexpected store state %d %v %d", v, found, writes)
+	}
+	if _, found, _ := store.get("c"); found {
+		t.Error("Deleted key must not be written")
+	}
+	if c.Pending() != 0 {
+		t.Error("No changes must be pending")
+	}
+
+	// Close flushes the rest
+	c.Set("d", 4, time.Hour)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v, found, _ := store.get("d"); !found || v != 4 {
+		t.Error("Close must flush pending changes")
+	}
+}
+
+func TestWriteBehindBatch(t *testing.T) {
+	store := &memorystore[int, int]{}
+	c := NewCache[int, int](WithWriteBehind[int, int](store, time.Hour, 5))
+	defer c.Close()
+
+	// a full batch wakes up the worker
+	for i := 0; i < 5; i++ {
+		c.Set(i, i, time.Hour)
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, found, _ := store.get(4); !found {
+		t.Error("Full batch must be written")
+	}
+}
+
+func TestWriteBehindRetry(t *testing.T) {
+	store := &memorystore[string, int]{fail: true}
+	c := NewCache[string, int](WithWriteBehind[string, int](store, 5*time.Millisecond, 10))
+
+	c.Set("a", 1, time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	if c.Pending() != 1 || c.Stats().Errors == 0 {
+		t.Error("Failed write must stay pending")
+	}
+
+	// Reset keeps the cache when pending changes cannot be written
+	if err := c.Reset(); err == nil {
+		t.Error("Expected error from Reset")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Cache must not be cleared")
+	}
+
+	store.setfail(false)
+	deadline := time.Now().Add(time.Second)
+	for c.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if v, found, _ := store.get("a"); !found || v != 1 {
+		t.Error("Failed write must be retried")
+	}
+	c.Close()
+
+	// final flush failure is reported by Close
+	store = &memorystore[string, int]{fail: true}
+	c = NewCache[string, int](WithWriteBehind[string, int](store, time.Millisecond, 10))
+	c.Set("a", 1, time.Hour)
+	if err := c.Close(); err == nil {
+		t.Error("Expected error from Close")
+	}
+}
+
+func TestWriteBehindDirtyEntries(t *testing.T) {
+	store := &memorystore[int, int]{fail: true}
+	c := NewCache[int, int](WithMaxSize(2), WithWriteBehind[int, int](store, time.Hour, 100), WithMaxPending(4), WithValidation(true))
+
+	// dirty entries are not evicted
+	c.Set(1, 1, time.Hour)
+	c.Set(2, 2, time.Hour)
+	c.Set(3, 3, time.Hour)
+	for i := 1; i <= 3; i++ {
+		if _, ok := c.Get(i); !ok {
+			t.Errorf("Dirty key %d must not be evicted", i)
+		}
+	}
+
+	// expired dirty entries wait for the write
+	c.Set(4, 4, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := c.Get(4); ok {
+		t.Error("Expired key must not be found")
+	}
+	if c.Pending() != 4 {
+		t.Errorf("Expected 4 pending changes, got %d", c.Pending())
+	}
+
+	store.setfail(false)
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v, found, _ := store.get(4); !found || v != 4 {
+		t.Error("Expired dirty value must be written")
+	}
+
+	// clean entries are evicted again
+	c.Set(5, 5, time.Hour)
+	c.Flush(context.Background())
+	c.Set(6, 6, time.Hour)
+	if st := c.Stats(); st.Capacity == 0 {
+		t.Error("Clean entries must be evicted")
+	}
+
+	// clear keeps dirty entries changed after the flush of Reset
+	c.Flush(context.Background())
+	store.setfail(true)
+	c.Set(8, 8, time.Hour)
+	c.mutex.Lock()
+	c.clear()
+	c.mutex.Unlock()
+	if _, ok := c.Get(8); !ok || c.Len() != 1 || c.Pending() != 1 {
+		t.Error("Dirty entry must be kept by clear")
+	}
+	store.setfail(false)
+	c.Flush(context.Background())
+	if v, found, _ := store.get(8); !found || v != 8 {
+		t.Error("Dirty entry kept by clear must be written")
+	}
+
+	// negative entries replacing dirty values are not written
+	store.setfail(true)
+	c.Set(7, 7, time.Hour)
+	c.SetMissing(7, time.Hour)
+	store.setfail(false)
+	c.Flush(context.Background())
+	if _, found, _ := store.get(7); found {
+		t.Error("Negative entry must not be written")
+	}
+	c.Close()
+}
+
+func TestStoreErrors(t *testing.T) {
+	type failure struct {
+		keys []int
+		err  error
+	}
+	var failures []failure
+	handler := WithStoreErrorHandler(func(keys []int, err error) {
+		failures = append(failures, failure{keys, err})
+	})
+
+	// write-through failures are reported
+	store := &memorystore[int, int]{fail: true}
+	c := NewCache[int, int](WithWriteThrough[int, int](store), handler)
+	c.Set(1, 1, time.Hour)
+	c.Delete(2, 3)
+	if len(failures) != 2 || failures[0].keys[0] != 1 || len(failures[1].keys) != 2 || failures[1].err == nil {
+		t.Errorf("Unexpected failures %v", failures)
+	}
+
+	// pending changes are limited by the max size, the cache does not grow
+	failures = nil
+	c = NewCache[int, int](WithMaxSize(2), WithWriteBehind[int, int](store, time.Hour, 100), handler)
+	defer c.Close()
+	c.Set(1, 1, time.Hour)
+	c.Set(2, 2, time.Hour)
+	c.Set(1, 10, time.Hour) // pending key is changed
+	c.Set(3, 3, time.Hour)
+	c.Delete(4)
+	if c.Len() != 2 || c.Pending() != 2 {
+		t.Errorf("Unexpected size %d with %d pending changes", c.Len(), c.Pending())
+	}
+	if len(failures) != 2 || failures[0].err != ErrPendingLimit || failures[1].keys[0] != 4 {
+		t.Errorf("Unexpected failures %v", failures)
+	}
+
+	// failed flushes are reported
+	failures = nil
+	if c.Flush(context.Background()) == nil || len(failures) != 1 || len(failures[0].keys) != 2 {
+		t.Errorf("Unexpected failures %v", failures)
+	}
+	store.setfail(false)
+
+	// mismatched handler is ignored
+	NewCache[string, int](WithWriteThrough[string, int](&memorystore[string, int]{fail: true}), handler).Set("a", 1, time.Hour)
+}
+
+// slowstore delays returns from writes.
+type slowstore struct {
+	*memorystore[int, int]
+}
+
+func (s slowstore) Write(ctx context.Context, entries []Entry[int, int]) error {
+	err := s.memorystore.Write(ctx, entries)
+	time.Sleep(time.Duration(entries[0].Value%3) * 100 * time.Microsecond)
+	return err
+}
+
+func TestWriteThroughOrder(t *testing.T) {
+	store := &memorystore[int, int]{}
+	c := NewCache[int, int](WithWriteThrough[int, int](slowstore{store}))
+
+	// concurrent writes of a key land in the store and the cache in the same order
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c.Set(1, w*1000+i, time.Hour)
+				c.Add(2, w, time.Hour)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	cached, _ := c.Get(1)
+	if stored, _, _ := store.get(1); stored != cached {
+		t.Errorf("Store has %d, cache has %d", stored, cached)
+	}
+	cached, _ = c.Get(2)
+	if stored, _, _ := store.get(2); stored != cached {
+		t.Errorf("Add: store has %d, cache has %d", stored, cached)
+	}
+}
@@ -0,0 +1,236 @@
+package prehit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by L2 implementations for unknown keys.
+var ErrNotFound = errors.New("key not found")
+
+// L2 is a shared (usually remote) cache tier behind the local cache.
+type L2 interface {
+	// Get returns the value of the key with its remaining TTL or ErrNotFound.
+	// Zero TTL means the TTL is unknown.
+	Get(ctx context.Context, key string) ([]byte, time.Duration, error)
+	// Set stores the value of the key for the TTL.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the key, unknown keys are not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Codec converts values to bytes stored in L2 and back.
+type Codec[V any] interface {
+	Encode(v V) ([]byte, error)
+	Decode(data []byte) (V, error)
+}
+
+// JSONCodec is a Codec encoding values as JSON.
+type JSONCodec[V any] struct{}
+
+// Encode encodes the value as JSON.
+func (JSONCodec[V]) Encode(v V) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode decodes the value from JSON.
+func (JSONCodec[V]) Decode(data []byte) (V, error) {
+	var v V
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// TieredCache is a two-level cache: the local Cache as L1 and a shared L2.
+// L1 misses are read through from L2, writes go through to both levels.
+type TieredCache[V any] struct {
+	l1         *Cache[string, V]
+	l2         L2
+	codec      Codec[V]
+	ttl        time.Duration
+	missingttl time.Duration
+}
+
+// Tiered cache options
+type tieredoptions struct {
+	missingttl time.Duration
+}
+
+// TieredOption is an option of the tiered cache.
+type TieredOption interface {
+	apply(*tieredoptions)
+}
+
+type missingttlOption time.Duration
+
+func (o missingttlOption) apply(opts *tieredoptions) {
+	opts.missingttl = time.Duration(o)
+}
+
+// WithMissingTTL sets the time keys missing in L2 are remembered in L1.
+// By default it is the TTL of the tiered cache.
+func WithMissingTTL(ttl time.Duration) TieredOption {
+	return missingttlOption(ttl)
+}
+
+// NewTieredCache creates a two-level cache.
+// The TTL limits the lifetime of values in L1, so changes made by other instances in L2
+// become visible after it. Values read from L2 are kept in L1 not longer than their remaining
+// TTL in L2. Keys missing in L2 are remembered in L1 by SetMissing (see WithMissingTTL),
+// and L2 errors are cached by SetError when the L1 cache has WithErrorTTL.
+func NewTieredCache[V any](l1 *Cache[string, V], l2 L2, codec Codec[V], ttl time.Duration, o ...TieredOption) *TieredCache[V] {
+	local := &tieredoptions{
+		missingttl: ttl, // default TTL of missing keys
+	}
+
+	for _, option := range o {
+		option.apply(local)
+	}
+
+	return &TieredCache[V]{l1: l1, l2: l2, codec: codec, ttl: ttl, missingttl: local.missingttl}
+}
+
+// L1 returns the local cache.
+func (t *TieredCache[V]) L1() *Cache[string, V] {
+	return t.l1
+}
+
+// Get returns a value for a key from L1, or from L2 on L1 miss.
+// A key missing in both levels is reported as not found without an error.
+// L2 errors are cached in L1 (see WithErrorTTL), except cancellation and deadline errors of ctx.
+func (t *TieredCache[V]) Get(ctx context.Context, key string) (V, bool, error) {
+	value, status, err := t.l1.Lookup(key)
+	switch status {
+	case Found:
+		return value, true, nil
+	case Missing:
+		return value, false, nil
+	case Failed:
+		return value, false, err
+	}
+
+	data, remaining, err := t.l2.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		t.l1.SetMissing(key, t.missingttl)
+		return *new(V), false, nil
+	}
+	if err != nil {
+		// a cancelled caller does not make the key fail for others
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			t.l1.SetError(key, err)
+		}
+		return *new(V), false, err
+	}
+
+	value, err = t.codec.Decode(data)
+	if err != nil {
+		return *new(V), false, err
+	}
+
+	ttl := t.ttl
+	if remaining > 0 && remaining < ttl { // L1 does not outlive L2
+		ttl = remaining
+	}
+	t.l1.Set(key, value, ttl)
+	return value, true, nil
+}
+
+// Set stores a value for a key in L2 and L1.
+// If L2 fails, the key is removed from L1 to avoid serving a value other instances do not see.
+func (t *TieredCache[V]) Set(ctx context.Context, key string, v V, ttl time.Duration) error {
+	data, err := t.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	if err := t.l2.Set(ctx, key, data, ttl); err != nil {
+		t.l1.Delete(key)
+		return err
+	}
+
+	if ttl > t.ttl {
+		ttl = t.ttl
+	}
+	t.l1.Set(key, v, ttl)
+	return nil
+}
+
+// Delete removes a key from both levels.
+func (t *TieredCache[V]) Delete(ctx context.Context, key string) error {
+	t.l1.Delete(key)
+	return t.l2.Delete(ctx, key)
+}
+
+// memoryitem is a value stored in MemoryL2.
+type memoryitem struct {
+	value      []byte
+	expiration time.Time
+}
+
+// MemoryL2 is an in-memory L2 implementation for tests.
+type MemoryL2 struct {
+	mutex sync.Mutex
+	items map[string]memoryitem
+}
+
+// NewMemoryL2 creates an empty in-memory L2.
+func NewMemoryL2() *MemoryL2 {
+	return &MemoryL2{items: make(map[string]memoryitem)}
+}
+
+// Get returns a copy of the value of the key with its remaining TTL or ErrNotFound.
+func (m *MemoryL2) Get(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item, found := m.items[key]
+	if !found {
+		return nil, 0, ErrNotFound
+	}
+	remaining := time.Until(item.expiration)
+	if remaining <= 0 {
+		delete(m.items, key)
+		return nil, 0, ErrNotFound
+	}
+	return append([]byte(nil), item.value...), remaining, nil
+}
+
+// Set stores a copy of the value of the key for the TTL.
+func (m *MemoryL2) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.items[key] = memoryitem{value: append([]byte(nil), value...), expiration: time.Now().Add(ttl)}
+	return nil
+}
+
+// Delete removes the key.
+func (m *MemoryL2) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.items, key)
+	return nil
+}
+
+// Len returns the number of stored keys including expired ones not yet removed.
+func (m *MemoryL2) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.items)
+}
@@ -0,0 +1,175 @@
+package prehit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+// failingl2 fails all operations.
+type failingl2 struct {
+	err error
+}
+
+func (f failingl2) Get(context.Context, string) ([]byte, time.Duration, error) { return nil, 0, f.err }
+func (f failingl2) Set(context.Context, string, []byte, time.Duration) error   { return f.err }
+func (f failingl2) Delete(context.Context, string) error                       { return f.err }
+
+func TestTieredCache(t *testing.T) {
+	ctx := context.Background()
+	l2 := NewMemoryL2()
+	a := NewTieredCache[user](NewCache[string, user](), l2, JSONCodec[user]{}, time.Minute)
+	b := NewTieredCache[user](NewCache[string, user](), l2, JSONCodec[user]{}, time.Minute)
+
+	if err := a.Set(ctx, "alice", user{"Alice", 30}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// write-through to L1 and L2
+	if _, ok := a.L1().Get("alice"); !ok || l2.Len() != 1 {
+		t.Error("Value must be written to both levels")
+	}
+
+	// read-through from L2 fills L1
+	v, ok, err := b.Get(ctx, "alice")
+	if err != nil || !ok || v.Name != "Alice" || v.Age != 30 {
+		t.Errorf("Unexpected value %v %v %v", v, ok, err)
+	}
+	if _, ok := b.L1().Get("alice"); !ok {
+		t.Error("L1 must be filled from L2")
+	}
+
+	// missing keys are remembered in L1
+	if _, ok, err := b.Get(ctx, "bob"); ok || err != nil {
+		t.Error("Unknown key must not be found")
+	}
+	if _, status, _ := b.L1().Lookup("bob"); status != Missing {
+		t.Error("Missing key must be remembered in L1")
+	}
+	if _, ok, _ := b.Get(ctx, "bob"); ok {
+		t.Error("Missing key must not be found")
+	}
+
+	if err := a.Delete(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.L1().Get("alice"); ok || l2.Len() != 0 {
+		t.Error("Key must be removed from both levels")
+	}
+}
+
+func TestTieredCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	tc := NewTieredCache[int](NewCache[string, int](), NewMemoryL2(), JSONCodec[int]{}, time.Hour)
+
+	// L1 lifetime is limited by the shorter TTL
+	tc.Set(ctx, "a", 1, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := tc.Get(ctx, "a"); ok {
+		t.Error("Expired key must not be found")
+	}
+
+	// L1 does not keep values read from L2 longer than L2
+	l2 := NewMemoryL2()
+	l2.Set(ctx, "b", []byte("2"), 10*time.Millisecond)
+	tc = NewTieredCache[int](NewCache[string, int](), l2, JSONCodec[int]{}, time.Hour, WithMissingTTL(time.Minute))
+	if v, ok, _ := tc.Get(ctx, "b"); !ok || v != 2 {
+		t.Errorf("Unexpected value %d", v)
+	}
+	if ttl, found := tc.L1().TTL("b"); !found || ttl > 10*time.Millisecond {
+		t.Errorf("Unexpected L1 TTL %v", ttl)
+	}
+
+	// missing keys have their own TTL
+	tc.Get(ctx, "c")
+	if ttl, found := tc.L1().TTL("c"); !found || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Unexpected TTL of the missing key %v", ttl)
+	}
+}
+
+func TestTieredCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("l2 is down")
+	tc := NewTieredCache[int](NewCache[string, int](WithErrorTTL(time.Minute)), failingl2{failure}, JSONCodec[int]{}, time.Minute)
+
+	if _, _, err := tc.Get(ctx, "a"); err != failure {
+		t.Errorf("Expected L2 error, got %v", err)
+	}
+	// the error is cached in L1
+	if _, status, err := tc.L1().Lookup("a"); status != Failed || err != failure {
+		t.Error("L2 error must be cached")
+	}
+	if _, _, err := tc.Get(ctx, "a"); err != failure {
+		t.Errorf("Expected cached error, got %v", err)
+	}
+
+	// errors of cancelled callers are not cached
+	for _, cancelled := range []error{context.Canceled, fmt.Errorf("get: %w", context.DeadlineExceeded)} {
+		tc := NewTieredCache[int](NewCache[string, int](WithErrorTTL(time.Minute)), failingl2{cancelled}, JSONCodec[int]{}, time.Minute)
+		if _, _, err := tc.Get(ctx, "a"); err != cancelled {
+			t.Errorf("Expected %v, got %v", cancelled, err)
+		}
+		if _, status, _ := tc.L1().Lookup("a"); status != Unknown {
+			t.Errorf("Error %v must not be cached", cancelled)
+		}
+	}
+
+	// failed write removes the stale L1 value
+	tc.L1().Set("b", 1, time.Minute)
+	if err := tc.Set(ctx, "b", 2, time.Minute); err != failure {
+		t.Errorf("Expected L2 error, got %v", err)
+	}
+	if _, ok := tc.L1().Get("b"); ok {
+		t.Error("L1 value must be removed on failed write")
+	}
+
+	if err := tc.Delete(ctx, "b"); err != failure {
+		t.Errorf("Expected L2 error, got %v", err)
+	}
+
+	// undecodable L2 value
+	l2 := NewMemoryL2()
+	l2.Set(ctx, "c", []byte("not json"), time.Minute)
+	tc = NewTieredCache[int](NewCache[string, int](), l2, JSONCodec[int]{}, time.Minute)
+	if _, ok, err := tc.Get(ctx, "c"); ok || err == nil {
+		t.Error("Expected decode error")
+	}
+}
+
+func TestMemoryL2(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryL2()
+
+	value := []byte("value")
+	m.Set(ctx, "a", value, time.Hour)
+	value[0] = 'V'
+	if v, ttl, err := m.Get(ctx, "a"); err != nil || string(v) != "value" || ttl <= 0 || ttl > time.Hour {
+		t.Error("Stored value must be a copy with the remaining TTL")
+	}
+
+	m.Set(ctx, "b", value, -time.Second)
+	if _, _, err := m.Get(ctx, "b"); err != ErrNotFound || m.Len() != 1 {
+		t.Error("Expired key must be removed")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := m.Get(canceled, "a"); err != context.Canceled {
+		t.Error("Expected context error")
+	}
+	if m.Set(canceled, "a", value, time.Hour) != context.Canceled || m.Delete(canceled, "a") != context.Canceled {
+		t.Error("Expected context error")
+	}
+
+	m.Delete(ctx, "a")
+	if _, _, err := m.Get(ctx, "a"); err != ErrNotFound {
+		t.Error("Deleted key must not be found")
+	}
+}
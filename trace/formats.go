@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.melnyk.org/prehit/internal/hashing"
+)
+
+// lines reads non-empty trimmed lines.
+type lines struct {
+	scanner *bufio.Scanner
+}
+
+func newlines(r io.Reader) lines {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return lines{scanner: scanner}
+}
+
+func (l lines) next() (string, error) {
+	for l.scanner.Scan() {
+		if line := strings.TrimSpace(l.scanner.Text()); line != "" {
+			return line, nil
+		}
+	}
+	if err := l.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+// ARCReader reads block traces used in the ARC paper.
+// Every line is "start count ignored request" and means accesses of count blocks
+// starting from the start block. Blocks are returned as Get events with block numbers as keys.
+type ARCReader struct {
+	lines lines
+	next  uint64
+	left  uint64
+}
+
+// NewARCReader creates an ARC trace reader.
+func NewARCReader(r io.Reader) *ARCReader {
+	return &ARCReader{lines: newlines(r)}
+}
+
+// Read returns the next event.
+func (r *ARCReader) Read() (Event, error) {
+	for r.left == 0 {
+		line, err := r.lines.next()
+		if err != nil {
+			return Event{}, err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return Event{}, ErrFormat
+		}
+		start, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return Event{}, ErrFormat
+		}
+		count, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return Event{}, ErrFormat
+		}
+		r.next, r.left = start, count
+	}
+
+	e := Event{Op: Get, Key: r.next}
+	r.next++
+	r.left--
+	return e, nil
+}
+
+// LIRSReader reads block traces used in the LIRS paper: one block number per line.
+// Lines which are not numbers (like "*" separators) are skipped.
+type LIRSReader struct {
+	lines lines
+}
+
+// NewLIRSReader creates a LIRS trace reader.
+func NewLIRSReader(r io.Reader) *LIRSReader {
+	return &LIRSReader{lines: newlines(r)}
+}
+
+// Read returns the next event.
+func (r *LIRSReader) Read() (Event, error) {
+	for {
+		line, err := r.lines.next()
+		if err != nil {
+			return Event{}, err
+		}
+		if block, err := strconv.ParseUint(line, 10, 64); err == nil {
+			return Event{Op: Get, Key: block}, nil
+		}
+	}
+}
+
+// TwitterReader reads Twitter cache traces (twitter/cache-trace) in CSV format:
+// "timestamp,key,key size,value size,client id,operation,ttl".
+// Reads (get, gets) are Get events, writes (set, add, replace, cas, append, prepend,
+// incr, decr) are Set events and delete is a Delete event. Keys are hashed with FNV-1a.
+type TwitterReader struct {
+	lines lines
+}
+
+// NewTwitterReader creates a Twitter trace reader.
+func NewTwitterReader(r io.Reader) *TwitterReader {
+	return &TwitterReader{lines: newlines(r)}
+}
+
+// Read returns the next event.
+func (r *TwitterReader) Read() (Event, error) {
+	for {
+		line, err := r.lines.next()
+		if err != nil {
+			return Event{}, err
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 7 {
+			return Event{}, ErrFormat
+		}
+
+		timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return Event{}, ErrFormat
+		}
+		e := Event{Time: time.Unix(timestamp, 0), Key: hashing.FNV64a(fields[1])}
+
+		switch fields[5] {
+		case "get", "gets":
+			e.Op = Get
+		case "set", "add", "replace", "cas", "append", "prepend", "incr", "decr":
+			e.Op = Set
+			ttl, err := strconv.ParseInt(fields[6], 10, 64)
+			if err != nil {
+				return Event{}, ErrFormat
+			}
+			e.TTL = time.Duration(ttl) * time.Second
+		case "delete":
+			e.Op = Delete
+		default: // unknown operations are skipped
+			continue
+		}
+
+		return e, nil
+	}
+}
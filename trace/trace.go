@@ -0,0 +1,204 @@
+// Package trace records and reads cache access traces.
+//
+// The native format is compact binary: a header with the magic "PHTR", the version and
+// the start time, followed by records of an operation byte, the time delta since the
+// previous record (uvarint nanoseconds), the hashed key (8 bytes) and, for Set, the TTL
+// (uvarint nanoseconds plus one, zero for values stored already expired). Readers of ARC,
+// LIRS and Twitter cache traces produce the same events, so all formats can be replayed
+// in the same way.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Op is a traced cache operation.
+type Op byte
+
+const (
+	Get Op = iota + 1
+	Set
+	Delete
+)
+
+// String returns the name of the operation.
+func (o Op) String() string {
+	switch o {
+	case Get:
+		return "get"
+	case Set:
+		return "set"
+	case Delete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a single traced access.
+type Event struct {
+	Time time.Time
+	Op   Op
+	Key  uint64        // hashed key
+	TTL  time.Duration // for Set only, zero means no expiration
+	// Expired is set for Set events of values stored with a non-positive TTL,
+	// which expire at once. TTL is zero then.
+	Expired bool
+}
+
+// Source is a stream of events, Read returns io.EOF at the end of the stream.
+type Source interface {
+	Read() (Event, error)
+}
+
+var magic = [4]byte{'P', 'H', 'T', 'R'}
+
+const version = 1
+
+// ErrFormat is returned for malformed traces.
+var ErrFormat = errors.New("trace: malformed trace")
+
+// Writer writes events in the native format. It is safe for concurrent use.
+// The first write error is kept and returned by Flush, later events are dropped.
+type Writer struct {
+	mutex  sync.Mutex
+	out    *bufio.Writer
+	header bool
+	last   time.Time
+	buf    [1 + 2*binary.MaxVarintLen64 + 8]byte
+	err    error
+}
+
+// NewWriter creates a writer. The header is written with the first event.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{out: bufio.NewWriter(w)}
+}
+
+// Write appends the event to the trace.
+func (w *Writer) Write(e Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	if !w.header {
+		var header [13]byte
+		copy(header[:], magic[:])
+		header[4] = version
+		binary.LittleEndian.PutUint64(header[5:], uint64(e.Time.UnixNano()))
+		_, w.err = w.out.Write(header[:])
+		w.header = true
+		w.last = e.Time
+	}
+
+	delta := e.Time.Sub(w.last)
+	if delta < 0 { // concurrent callers can race between taking time and the mutex
+		delta = 0
+	} else {
+		w.last = e.Time
+	}
+
+	n := 0
+	w.buf[n] = byte(e.Op)
+	n++
+	n += binary.PutUvarint(w.buf[n:], uint64(delta))
+	binary.LittleEndian.PutUint64(w.buf[n:], e.Key)
+	n += 8
+	if e.Op == Set {
+		var ttl uint64 // zero for expired values
+		if !e.Expired && e.TTL >= 0 {
+			ttl = uint64(e.TTL) + 1
+		}
+		n += binary.PutUvarint(w.buf[n:], ttl)
+	}
+
+	if w.err == nil {
+		_, w.err = w.out.Write(w.buf[:n])
+	}
+}
+
+// Flush writes buffered events to the underlying writer and returns the first error.
+func (w *Writer) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.out.Flush()
+	return w.err
+}
+
+// Reader reads events in the native format.
+type Reader struct {
+	in   *bufio.Reader
+	last time.Time
+}
+
+// NewReader creates a reader and checks the header of the trace.
+// An empty input is a valid trace without events.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{in: bufio.NewReader(r)}
+
+	var header [13]byte
+	if _, err := io.ReadFull(reader.in, header[:]); err != nil {
+		if err == io.EOF {
+			return reader, nil
+		}
+		return nil, ErrFormat
+	}
+
+	if [4]byte(header[:4]) != magic || header[4] != version {
+		return nil, ErrFormat
+	}
+	reader.last = time.Unix(0, int64(binary.LittleEndian.Uint64(header[5:])))
+
+	return reader, nil
+}
+
+// Read returns the next event.
+func (r *Reader) Read() (Event, error) {
+	op, err := r.in.ReadByte()
+	if err != nil {
+		return Event{}, err // io.EOF at the end of the trace
+	}
+
+	e := Event{Op: Op(op)}
+	if e.Op != Get && e.Op != Set && e.Op != Delete {
+		return Event{}, ErrFormat
+	}
+
+	delta, err := binary.ReadUvarint(r.in)
+	if err != nil {
+		return Event{}, ErrFormat
+	}
+	r.last = r.last.Add(time.Duration(delta))
+	e.Time = r.last
+
+	var key [8]byte
+	if _, err := io.ReadFull(r.in, key[:]); err != nil {
+		return Event{}, ErrFormat
+	}
+	e.Key = binary.LittleEndian.Uint64(key[:])
+
+	if e.Op == Set {
+		ttl, err := binary.ReadUvarint(r.in)
+		if err != nil {
+			return Event{}, ErrFormat
+		}
+		if ttl == 0 {
+			e.Expired = true
+		} else {
+			e.TTL = time.Duration(ttl - 1)
+		}
+	}
+
+	return e, nil
+}
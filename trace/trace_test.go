@@ -0,0 +1,164 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit/internal/hashing"
+)
+
+func readall(t *testing.T, s Source) []Event {
+	var events []Event
+	for {
+		e, err := s.Read()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	events := []Event{
+		{Time: start, Op: Get, Key: 1},
+		{Time: start.Add(time.Millisecond), Op: Set, Key: 1, TTL: time.Minute},
+		{Time: start.Add(time.Second), Op: Delete, Key: 1<<64 - 1},
+		{Time: start.Add(time.Second), Op: Set, Key: 2},
+		{Time: start.Add(time.Second), Op: Set, Key: 3, Expired: true},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, e := range events {
+		w.Write(e)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read := readall(t, r); !reflect.DeepEqual(read, events) {
+		t.Errorf("Unexpected events %v", read)
+	}
+
+	// the whole trace is consumed
+	if buf.Len() != 0 {
+		t.Error("Unexpected data left")
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	if r, err := NewReader(strings.NewReader("")); err != nil || r == nil {
+		t.Error("Empty trace must be valid")
+	}
+
+	if _, err := NewReader(strings.NewReader("NOPE123456789")); err != ErrFormat {
+		t.Error("Expected format error for wrong magic")
+	}
+
+	if _, err := NewReader(strings.NewReader("PHT")); err != ErrFormat {
+		t.Error("Expected format error for short header")
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(Event{Op: Set, Key: 1, TTL: time.Second})
+	w.Flush()
+	data := buf.Bytes()
+
+	r, _ := NewReader(bytes.NewReader(data[:len(data)-1]))
+	if _, err := r.Read(); err != ErrFormat {
+		t.Error("Expected format error for truncated record")
+	}
+
+	data[13] = 42
+	r, _ = NewReader(bytes.NewReader(data))
+	if _, err := r.Read(); err != ErrFormat {
+		t.Error("Expected format error for unknown operation")
+	}
+}
+
+type failingwriter struct{}
+
+func (failingwriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestWriterError(t *testing.T) {
+	w := NewWriter(failingwriter{})
+	for i := 0; i < 10000; i++ {
+		w.Write(Event{Op: Get, Key: uint64(i)})
+	}
+	if err := w.Flush(); err != io.ErrClosedPipe {
+		t.Error("Expected write error")
+	}
+}
+
+func TestARCReader(t *testing.T) {
+	events := readall(t, NewARCReader(strings.NewReader("10 3 0 1\n\n5 1 0 2\n")))
+	keys := []uint64{}
+	for _, e := range events {
+		if e.Op != Get {
+			t.Error("Expected get events")
+		}
+		keys = append(keys, e.Key)
+	}
+	if !reflect.DeepEqual(keys, []uint64{10, 11, 12, 5}) {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	if _, err := NewARCReader(strings.NewReader("x 1 0 0\n")).Read(); err != ErrFormat {
+		t.Error("Expected format error")
+	}
+}
+
+func TestLIRSReader(t *testing.T) {
+	events := readall(t, NewLIRSReader(strings.NewReader("1\n*\n2\n1\n")))
+	if len(events) != 3 || events[0].Key != 1 || events[1].Key != 2 || events[2].Key != 1 {
+		t.Errorf("Unexpected events %v", events)
+	}
+}
+
+func TestTwitterReader(t *testing.T) {
+	input := strings.Join([]string{
+		"0,key1,4,100,1,get,0",
+		"1,key1,4,100,1,set,3600",
+		"2,key1,4,0,1,delete,0",
+		"3,key2,4,0,1,unknown,0",
+		"4,key2,4,0,1,gets,0",
+	}, "\n")
+
+	events := readall(t, NewTwitterReader(strings.NewReader(input)))
+	expected := []Event{
+		{Time: time.Unix(0, 0), Op: Get, Key: hashing.FNV64a("key1")},
+		{Time: time.Unix(1, 0), Op: Set, Key: hashing.FNV64a("key1"), TTL: time.Hour},
+		{Time: time.Unix(2, 0), Op: Delete, Key: hashing.FNV64a("key1")},
+		{Time: time.Unix(4, 0), Op: Get, Key: hashing.FNV64a("key2")},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Unexpected events %v", events)
+	}
+
+	if _, err := NewTwitterReader(strings.NewReader("0,key1,get\n")).Read(); err != ErrFormat {
+		t.Error("Expected format error")
+	}
+}
+
+func TestOpString(t *testing.T) {
+	for op, name := range map[Op]string{Get: "get", Set: "set", Delete: "delete", Op(0): "unknown"} {
+		if op.String() != name {
+			t.Error("Op string failed")
+		}
+	}
+}
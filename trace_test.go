@@ -0,0 +1,77 @@
+package prehit
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"go.melnyk.org/prehit/trace"
+)
+
+func TestCacheTrace(t *testing.T) {
+	var buf bytes.Buffer
+	w := trace.NewWriter(&buf)
+	c := NewCache[string, int](WithTrace(w))
+
+	c.Get("a")
+	c.Set("a", 1, time.Minute)
+	c.Lookup("a")
+	c.Delete("a", "b")
+	c.Set("c", 1, -time.Minute)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := trace.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []trace.Event{
+		{Op: trace.Get, Key: hashkey("a")},
+		{Op: trace.Set, Key: hashkey("a"), TTL: time.Minute},
+		{Op: trace.Get, Key: hashkey("a")},
+		{Op: trace.Delete, Key: hashkey("a")},
+		{Op: trace.Delete, Key: hashkey("b")},
+		{Op: trace.Set, Key: hashkey("c"), Expired: true},
+	}
+	for _, exp := range expected {
+		e, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Op != exp.Op || e.Key != exp.Key || e.TTL != exp.TTL || e.Expired != exp.Expired {
+			t.Errorf("Unexpected event %v", e)
+		}
+	}
+
+	if _, err := r.Read(); err != io.EOF {
+		t.Error("Unexpected events")
+	}
+}
+
+func TestCacheTraceConditional(t *testing.T) {
+	var buf bytes.Buffer
+	w := trace.NewWriter(&buf)
+	c := NewCache[string, int](WithTrace(w))
+
+	c.Add("a", 1, time.Minute)
+	c.Add("a", 2, time.Minute)     // rejected
+	c.Replace("b", 1, time.Minute) // rejected
+	c.Replace("a", 3, time.Minute)
+	w.Flush()
+
+	r, err := trace.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if e, err := r.Read(); err != nil || e.Op != trace.Set || e.Key != hashkey("a") {
+			t.Errorf("Unexpected event %v %v", e, err)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Error("Rejected sets must not be traced")
+	}
+}
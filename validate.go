@@ -0,0 +1,126 @@
+package prehit
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCorrupted is returned by Validate when the cache structure is inconsistent.
+var ErrCorrupted = errors.New("cache structure is corrupted")
+
+// Validate checks that the index, the size and the links of the list agree.
+func (c *Cache[K, V]) Validate() error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.validate()
+}
+
+func (c *Cache[K, V]) validate() error {
+	if (c.head == nil) != (c.tail == nil) {
+		return fmt.Errorf("%w: head and tail disagree", ErrCorrupted)
+	}
+	if c.head != nil && c.head.prev != nil {
+		return fmt.Errorf("%w: head has previous item", ErrCorrupted)
+	}
+	if c.tail != nil && c.tail.next != nil {
+		return fmt.Errorf("%w: tail has next item", ErrCorrupted)
+	}
+
+	count := 0
+	var last *cacheItem[K, V]
+	for item := c.head; item != nil; item = item.next {
+		if count++; count > len(c.index) {
+			return fmt.Errorf("%w: list is longer than index (or has a cycle)", ErrCorrupted)
+		}
+		if item.prev != last {
+			return fmt.Errorf("%w: broken previous link of %v", ErrCorrupted, item.key)
+		}
+		if c.index[item.key] != item {
+			return fmt.Errorf("%w: item %v is not indexed", ErrCorrupted, item.key)
+		}
+		last = item
+	}
+
+	if last != c.tail {
+		return fmt.Errorf("%w: list does not end at tail", ErrCorrupted)
+	}
+	if count != len(c.index) {
+		return fmt.Errorf("%w: list has %d items, index has %d", ErrCorrupted, count, len(c.index))
+	}
+	if c.size != uint(count) {
+		return fmt.Errorf("%w: size is %d, list has %d items", ErrCorrupted, c.size, count)
+	}
+
+	return nil
+}
+
+// check validates the structure after a mutation when WithValidation is set.
+// The caller holds the write lock.
+func (c *Cache[K, V]) check() {
+	if c.validation {
+		if err := c.validate(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Repair rebuilds the list from the index when the structure is corrupted.
+// The order of the consistent part of the list from the head is kept,
+// other indexed items are appended to the tail.
+func (c *Cache[K, V]) Repair() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.repair()
+}
+
+// repair rebuilds the list, the caller holds the write lock.
+func (c *Cache[K, V]) repair() {
+	if c.validate() == nil {
+		return
+	}
+
+	// consistent prefix of the list, cycles and unindexed items are cut off
+	visited := make(map[*cacheItem[K, V]]bool, len(c.index))
+	order := make([]*cacheItem[K, V], 0, len(c.index))
+	for item := c.head; item != nil && !visited[item] && c.index[item.key] == item; item = item.next {
+		visited[item] = true
+		order = append(order, item)
+	}
+
+	// the rest of the index, nil items and items shared by several keys are dropped
+	dropped := 0
+	for key, item := range c.index {
+		if item == nil {
+			delete(c.index, key)
+			dropped++
+			continue
+		}
+		if visited[item] {
+			if item.key != key {
+				delete(c.index, key)
+				dropped++
+			}
+			continue
+		}
+		item.key = key
+		visited[item] = true
+		order = append(order, item)
+	}
+
+	c.head, c.tail = nil, nil
+	for i, item := range order {
+		item.prev, item.next = nil, nil
+		if i > 0 {
+			item.prev = order[i-1]
+			order[i-1].next = item
+		}
+	}
+	if len(order) > 0 {
+		c.head, c.tail = order[0], order[len(order)-1]
+	}
+	c.size = uint(len(order))
+
+	c.logger.Warning(fmt.Sprintf("Cache structure is repaired - %d items are kept, %d index entries are dropped", len(order), dropped))
+}
@@ -0,0 +1,128 @@
+package prehit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func filled(n int, o ...Option) *Cache[int, int] {
+	c := NewCache[int, int](o...)
+	for i := 0; i < n; i++ {
+		c.Set(i, i, time.Hour)
+	}
+	return c
+}
+
+// listkeys returns keys of the list from the head.
+func listkeys(c *Cache[int, int]) []int {
+	var list []int
+	for item := c.head; item != nil; item = item.next {
+		list = append(list, item.key)
+	}
+	return list
+}
+
+func TestValidate(t *testing.T) {
+	if err := NewCache[int, int]().Validate(); err != nil {
+		t.Errorf("Empty cache must be valid: %v", err)
+	}
+	if err := filled(5).Validate(); err != nil {
+		t.Errorf("Cache must be valid: %v", err)
+	}
+
+	corruptions := map[string]func(c *Cache[int, int]){
+		"tail":      func(c *Cache[int, int]) { c.tail = nil },
+		"head prev": func(c *Cache[int, int]) { c.head.prev = c.tail },
+		"tail next": func(c *Cache[int, int]) { c.tail.next = c.head },
+		"prev link": func(c *Cache[int, int]) { c.head.next.prev = nil },
+		"cycle":     func(c *Cache[int, int]) { c.head.next.next = c.head },
+		"unindexed": func(c *Cache[int, int]) { delete(c.index, 2) },
+		"nil item":  func(c *Cache[int, int]) { c.index[10] = nil },
+		"size":      func(c *Cache[int, int]) { c.size++ },
+		"short":     func(c *Cache[int, int]) { c.tail = c.tail.prev; c.tail.next = nil },
+	}
+
+	for name, corrupt := range corruptions {
+		c := filled(5)
+		corrupt(c)
+		if err := c.Validate(); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("Expected corruption for %s, got %v", name, err)
+		}
+
+		c.Repair()
+		if err := c.Validate(); err != nil {
+			t.Errorf("Cache must be valid after repair of %s: %v", name, err)
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	c := filled(5)
+
+	// valid cache is not changed
+	c.Repair()
+	if list := listkeys(c); len(list) != 5 || list[0] != 4 || list[4] != 0 {
+		t.Errorf("Unexpected keys %v", list)
+	}
+
+	// the consistent prefix keeps its order, the rest is appended
+	c.head.next.next.next = nil // 4, 3, 2
+	c.Repair()
+	list := listkeys(c)
+	if len(list) != 5 || list[0] != 4 || list[1] != 3 || list[2] != 2 || c.size != 5 {
+		t.Errorf("Unexpected keys %v", list)
+	}
+	for i := 0; i < 5; i++ {
+		if v, ok := c.Get(i); !ok || v != i {
+			t.Errorf("Key %d must survive the repair", i)
+		}
+	}
+}
+
+func TestSelfHealing(t *testing.T) {
+	c := filled(3)
+	c.index[10] = nil
+
+	if _, ok := c.Get(10); ok {
+		t.Error("Nil item must not be found")
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Cache must be repaired by Get: %v", err)
+	}
+	if st := c.Stats(); st.Errors != 1 {
+		t.Errorf("Expected one error, got %d", st.Errors)
+	}
+
+	c.index[10] = nil
+	c.Delete(10)
+	if err := c.Validate(); err != nil {
+		t.Errorf("Cache must be repaired by Delete: %v", err)
+	}
+
+	c.size = 0
+	c.Delete(1)
+	if err := c.Validate(); err != nil || c.size != 2 {
+		t.Errorf("Cache must be repaired by Delete: %v", err)
+	}
+}
+
+func TestWithValidationPanics(t *testing.T) {
+	c := filled(3, WithValidation(true))
+	c.Set(3, 3, time.Hour)
+	c.Get(0)
+	c.Delete(1)
+	c.Resize(2)
+	if err := c.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = filled(3, WithValidation(true))
+	c.size++
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrCorrupted) {
+			t.Error("Expected panic with ErrCorrupted")
+		}
+	}()
+	c.Set(3, 3, time.Hour)
+}
@@ -0,0 +1,98 @@
+package workload
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Spec describes a workload in a form convenient for command line flags.
+//
+// Distributions:
+//   - "uniform" - all keys have the same probability;
+//   - "zipf" - Zipfian distribution with the skew;
+//   - "scan" - uniform hot set of 1% of keys with sequential scans of 10% of keys;
+//   - "shifting" - Zipfian distribution with the hot spot shifted by 10% of keys every Keys operations.
+//
+// TTL is "fixed:1m", "uniform:10s-1m" or "exp:30s".
+type Spec struct {
+	Distribution string
+	Keys         uint64
+	Skew         float64
+	Reads        float64
+	TTL          string
+}
+
+// New creates a workload with the seed. Workers use distinct seeds.
+func (s Spec) New(seed int64) (*Workload, error) {
+	if s.Keys < 2 {
+		return nil, fmt.Errorf("workload: at least 2 keys are needed")
+	}
+	if s.Reads < 0 || s.Reads > 1 {
+		return nil, fmt.Errorf("workload: reads must be in [0, 1]")
+	}
+
+	random := rand.New(rand.NewSource(seed))
+
+	var keys Keys
+	switch s.Distribution {
+	case "uniform":
+		keys = NewUniform(random, s.Keys)
+	case "zipf", "shifting":
+		if s.Skew <= 1 {
+			return nil, fmt.Errorf("workload: zipf skew must be greater than 1")
+		}
+		keys = NewZipf(random, s.Skew, s.Keys)
+		if s.Distribution == "shifting" {
+			keys = NewShifting(keys, s.Keys, s.Keys/10+1, s.Keys)
+		}
+	case "scan":
+		keys = NewScan(random, s.Keys, s.Keys/100+1, s.Keys/10+1, 0.001)
+	default:
+		return nil, fmt.Errorf("workload: unknown distribution %q", s.Distribution)
+	}
+
+	ttl, err := ParseTTL(random, s.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(random, keys, s.Reads, ttl), nil
+}
+
+// ParseTTL parses a TTL distribution: "fixed:1m", "uniform:10s-1m" or "exp:30s".
+func ParseTTL(random *rand.Rand, spec string) (TTL, error) {
+	kind, value, found := strings.Cut(spec, ":")
+	if !found {
+		return nil, fmt.Errorf("workload: invalid TTL %q", spec)
+	}
+
+	switch kind {
+	case "fixed", "exp":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("workload: invalid TTL %q", spec)
+		}
+		if kind == "fixed" {
+			return NewFixedTTL(d), nil
+		}
+		return NewExponentialTTL(random, d), nil
+	case "uniform":
+		low, high, found := strings.Cut(value, "-")
+		if !found {
+			return nil, fmt.Errorf("workload: invalid TTL %q", spec)
+		}
+		min, err := time.ParseDuration(low)
+		if err != nil {
+			return nil, fmt.Errorf("workload: invalid TTL %q", spec)
+		}
+		max, err := time.ParseDuration(high)
+		if err != nil {
+			return nil, fmt.Errorf("workload: invalid TTL %q", spec)
+		}
+		return NewUniformTTL(random, min, max), nil
+	default:
+		return nil, fmt.Errorf("workload: invalid TTL %q", spec)
+	}
+}
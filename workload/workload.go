@@ -0,0 +1,220 @@
+// Package workload generates synthetic cache workloads: key streams with realistic skew
+// (Zipfian, uniform, scan plus hot set, shifting hotspot), read/write mixes and TTL
+// distributions.
+//
+// Generators are not safe for concurrent use, every worker creates its own workload
+// from a Spec with a distinct seed.
+package workload
+
+import (
+	"math/bits"
+	"math/rand"
+	"time"
+)
+
+// Keys is a stream of keys in the range [0, n).
+type Keys interface {
+	Next() uint64
+}
+
+// uniform picks every key with the same probability.
+type uniform struct {
+	random *rand.Rand
+	n      uint64
+}
+
+// NewUniform creates a uniform key stream over n keys, zero n is raised to one key.
+func NewUniform(random *rand.Rand, n uint64) Keys {
+	if n == 0 {
+		n = 1
+	}
+	return &uniform{random: random, n: n}
+}
+
+func (u *uniform) Next() uint64 {
+	return uint64(u.random.Int63n(int64(u.n)))
+}
+
+// zipf picks keys with Zipfian distribution, ranks are scrambled over the key range
+// so hot keys are not neighbours.
+type zipf struct {
+	zipf *rand.Zipf
+	n    uint64
+}
+
+// NewZipf creates a Zipfian key stream over n keys with the skew s > 1.
+// Zero n is raised to one key, skews not greater than 1 are raised to minskew.
+func NewZipf(random *rand.Rand, s float64, n uint64) Keys {
+	if n == 0 {
+		n = 1
+	}
+	if !(s > 1) {
+		s = minskew
+	}
+	return &zipf{zipf: rand.NewZipf(random, s, 1, n-1), n: n}
+}
+
+func (z *zipf) Next() uint64 {
+	return scramble(z.zipf.Uint64(), z.n)
+}
+
+// scramble maps the rank to a key with a bijection over [0, n):
+// multiplication by a large prime modulo n is a bijection when n is not divisible by the prime.
+func scramble(rank uint64, n uint64) uint64 {
+	const prime = 2305843009213693951 // 2^61-1
+	if n%prime == 0 {
+		return rank
+	}
+	hi, lo := bits.Mul64(rank, prime%n)
+	_, rem := bits.Div64(hi%n, lo, n)
+	return rem
+}
+
+// minskew is the smallest skew of Zipfian streams, rand.Zipf needs a skew greater than 1.
+const minskew = 1.01
+
+// scan mixes accesses of a small hot set with long sequential scans over all keys.
+type scan struct {
+	random   *rand.Rand
+	n        uint64
+	hot      uint64
+	scanlen  uint64
+	scanprob float64
+	position uint64
+	left     uint64
+}
+
+// NewScan creates a stream of hot set accesses (uniform over hot keys) interleaved with
+// sequential scans of scanlen keys over the whole range, started with the probability
+// scanprob on every access. Zero n is raised to one key, the hot set is clamped to [1, n].
+func NewScan(random *rand.Rand, n uint64, hot uint64, scanlen uint64, scanprob float64) Keys {
+	if n == 0 {
+		n = 1
+	}
+	if hot > n {
+		hot = n
+	}
+	if hot == 0 {
+		hot = 1
+	}
+	return &scan{random: random, n: n, hot: hot, scanlen: scanlen, scanprob: scanprob}
+}
+
+func (s *scan) Next() uint64 {
+	if s.left == 0 && s.random.Float64() < s.scanprob {
+		s.left = s.scanlen
+	}
+
+	if s.left > 0 {
+		s.left--
+		s.position = (s.position + 1) % s.n
+		return s.position
+	}
+
+	return uint64(s.random.Int63n(int64(s.hot)))
+}
+
+// shifting moves the hot spot of the base stream over the key range.
+type shifting struct {
+	base   Keys
+	n      uint64
+	shift  uint64
+	period uint64
+	count  uint64
+	offset uint64
+}
+
+// NewShifting creates a stream shifting keys of the base stream by shift every period accesses,
+// so the hot set moves and old hot keys cool down. Zero n is raised to one key,
+// zero period never shifts.
+func NewShifting(base Keys, n uint64, shift uint64, period uint64) Keys {
+	if n == 0 {
+		n = 1
+	}
+	return &shifting{base: base, n: n, shift: shift, period: period}
+}
+
+func (s *shifting) Next() uint64 {
+	s.count++
+	if s.period > 0 && s.count%s.period == 0 {
+		s.offset = (s.offset + s.shift) % s.n
+	}
+	return (s.base.Next() + s.offset) % s.n
+}
+
+// TTL is a distribution of TTLs for written keys.
+type TTL interface {
+	Next() time.Duration
+}
+
+type fixed time.Duration
+
+// NewFixedTTL creates a distribution returning the same TTL.
+func NewFixedTTL(ttl time.Duration) TTL {
+	return fixed(ttl)
+}
+
+func (f fixed) Next() time.Duration {
+	return time.Duration(f)
+}
+
+type uniformttl struct {
+	random *rand.Rand
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewUniformTTL creates a distribution of TTLs uniform in [min, max].
+func NewUniformTTL(random *rand.Rand, min time.Duration, max time.Duration) TTL {
+	if min > max {
+		min, max = max, min
+	}
+	return &uniformttl{random: random, min: min, max: max}
+}
+
+func (u *uniformttl) Next() time.Duration {
+	return u.min + time.Duration(u.random.Int63n(int64(u.max-u.min)+1))
+}
+
+type exponential struct {
+	random *rand.Rand
+	mean   time.Duration
+}
+
+// NewExponentialTTL creates an exponential distribution of TTLs with the mean.
+func NewExponentialTTL(random *rand.Rand, mean time.Duration) TTL {
+	return &exponential{random: random, mean: mean}
+}
+
+func (e *exponential) Next() time.Duration {
+	return time.Duration(e.random.ExpFloat64() * float64(e.mean))
+}
+
+// Op is a single operation of a workload.
+type Op struct {
+	Read bool
+	Key  uint64
+	TTL  time.Duration // TTL of the write or of the fill after a missed read
+}
+
+// Workload is a stream of operations.
+type Workload struct {
+	random *rand.Rand
+	keys   Keys
+	reads  float64
+	ttl    TTL
+}
+
+// New creates a workload with the part of reads in [0, 1].
+func New(random *rand.Rand, keys Keys, reads float64, ttl TTL) *Workload {
+	return &Workload{random: random, keys: keys, reads: reads, ttl: ttl}
+}
+
+// Next returns the next operation.
+func (w *Workload) Next() Op {
+	return Op{
+		Read: w.random.Float64() < w.reads,
+		Key:  w.keys.Next(),
+		TTL:  w.ttl.Next(),
+	}
+}
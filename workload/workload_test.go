@@ -0,0 +1,199 @@
+package workload
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func counts(keys Keys, n uint64, samples int) []int {
+	c := make([]int, n)
+	for i := 0; i < samples; i++ {
+		key := keys.Next()
+		if key >= n {
+			panic("key out of range")
+		}
+		c[key]++
+	}
+	return c
+}
+
+func TestUniform(t *testing.T) {
+	c := counts(NewUniform(rand.New(rand.NewSource(1)), 10), 10, 100000)
+	for _, count := range c {
+		if count < 9000 || count > 11000 {
+			t.Errorf("Unexpected counts %v", c)
+			break
+		}
+	}
+}
+
+func TestZipf(t *testing.T) {
+	const n = 1000
+	c := counts(NewZipf(rand.New(rand.NewSource(1)), 1.2, n), n, 100000)
+
+	// the hottest key is the scrambled rank 0, the next is rank 1
+	if c[scramble(0, n)] < c[scramble(1, n)] || c[scramble(1, n)] < c[scramble(100, n)] {
+		t.Error("Unexpected zipf distribution")
+	}
+
+	// ranks are spread over the range
+	if scramble(1, n) == 1 {
+		t.Error("Ranks are not scrambled")
+	}
+}
+
+func TestScramble(t *testing.T) {
+	const n = 1000
+	seen := make(map[uint64]bool, n)
+	for rank := uint64(0); rank < n; rank++ {
+		seen[scramble(rank, n)] = true
+	}
+	if len(seen) != n {
+		t.Error("Scramble must be a bijection")
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := NewScan(rand.New(rand.NewSource(1)), 1000, 10, 100, 1)
+
+	// scans are sequential
+	first := s.Next()
+	for i := 1; i < 100; i++ {
+		if s.Next() != (first+uint64(i))%1000 {
+			t.Fatal("Scan must be sequential")
+		}
+	}
+
+	// hot set only
+	s = NewScan(rand.New(rand.NewSource(1)), 1000, 10, 100, 0)
+	for i := 0; i < 1000; i++ {
+		if s.Next() >= 10 {
+			t.Fatal("Hot set access out of range")
+		}
+	}
+}
+
+type constant uint64
+
+func (c constant) Next() uint64 {
+	return uint64(c)
+}
+
+func TestShifting(t *testing.T) {
+	s := NewShifting(constant(5), 10, 3, 2)
+	keys := []uint64{}
+	for i := 0; i < 6; i++ {
+		keys = append(keys, s.Next())
+	}
+	expected := []uint64{5, 8, 8, 1, 1, 4}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("Unexpected keys %v", keys)
+		}
+	}
+}
+
+func TestDegenerateArguments(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	// degenerate arguments are clamped instead of panicking on Next
+	streams := []Keys{
+		NewUniform(random, 0),
+		NewZipf(random, 1, 0),
+		NewScan(random, 0, 0, 0, 0.5),
+		NewScan(random, 10, 0, 5, 0),
+		NewShifting(NewUniform(random, 0), 0, 1, 1),
+	}
+	for i, keys := range streams {
+		for j := 0; j < 100; j++ {
+			if key := keys.Next(); key != 0 {
+				t.Fatalf("Unexpected key %d of stream %d", key, i)
+			}
+		}
+	}
+}
+
+func TestTTL(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	if NewFixedTTL(time.Second).Next() != time.Second {
+		t.Error("Unexpected fixed TTL")
+	}
+
+	u := NewUniformTTL(random, time.Minute, time.Second)
+	for i := 0; i < 1000; i++ {
+		if ttl := u.Next(); ttl < time.Second || ttl > time.Minute {
+			t.Fatal("Uniform TTL out of range")
+		}
+	}
+
+	e := NewExponentialTTL(random, time.Second)
+	var sum time.Duration
+	for i := 0; i < 100000; i++ {
+		sum += e.Next()
+	}
+	if mean := sum / 100000; math.Abs(float64(mean-time.Second)) > float64(50*time.Millisecond) {
+		t.Errorf("Unexpected exponential mean %v", mean)
+	}
+}
+
+func TestWorkload(t *testing.T) {
+	w := New(rand.New(rand.NewSource(1)), NewUniform(rand.New(rand.NewSource(2)), 10), 0.9, NewFixedTTL(time.Second))
+	reads := 0
+	for i := 0; i < 10000; i++ {
+		op := w.Next()
+		if op.Read {
+			reads++
+		}
+		if op.TTL != time.Second {
+			t.Fatal("Unexpected TTL")
+		}
+	}
+	if reads < 8800 || reads > 9200 {
+		t.Errorf("Unexpected number of reads %d", reads)
+	}
+}
+
+func TestSpec(t *testing.T) {
+	for _, distribution := range []string{"uniform", "zipf", "scan", "shifting"} {
+		spec := Spec{Distribution: distribution, Keys: 100, Skew: 1.1, Reads: 0.5, TTL: "uniform:1s-2s"}
+		w, err := spec.New(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 1000; i++ {
+			if op := w.Next(); op.Key >= 100 {
+				t.Fatalf("Key out of range for %s", distribution)
+			}
+		}
+	}
+
+	for _, spec := range []Spec{
+		{Distribution: "uniform", Keys: 1, TTL: "fixed:1s"},
+		{Distribution: "uniform", Keys: 10, Reads: 2, TTL: "fixed:1s"},
+		{Distribution: "zipf", Keys: 10, Skew: 1, TTL: "fixed:1s"},
+		{Distribution: "unknown", Keys: 10, TTL: "fixed:1s"},
+		{Distribution: "uniform", Keys: 10, TTL: "fixed"},
+	} {
+		if _, err := spec.New(1); err == nil {
+			t.Errorf("Expected error for %+v", spec)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for _, spec := range []string{"fixed:1m", "uniform:10s-1m", "exp:30s"} {
+		if _, err := ParseTTL(random, spec); err != nil {
+			t.Errorf("Unexpected error for %s", spec)
+		}
+	}
+
+	for _, spec := range []string{"", "fixed:x", "exp:-1s", "uniform:1s", "uniform:x-1s", "uniform:1s-x", "normal:1s"} {
+		if _, err := ParseTTL(random, spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package prehit
+
+import (
+	"math"
+	"time"
+)
+
+// SetComputed stores a value for a key together with the time it took to compute the value.
+// The compute time is used by GetEarly to decide about early recomputation.
+func (c *Cache[K, V]) SetComputed(key K, v V, ttl time.Duration, delta time.Duration) {
+	c.logger.Verbose("Set computed cache")
+	c.set(setalways, key, v, ttl, delta, Found, nil)
+}
+
+// GetEarly returns a value for a key and reports whether the value is due for refresh.
+// With WithEarlyExpiration the refresh is reported with increasing probability as the key
+// approaches its expiration, weighted by the compute time recorded by SetComputed
+// (probabilistic early expiration, XFetch), so usually only one caller refreshes the value
+// before it expires. Without the option the refresh is never reported for found values.
+func (c *Cache[K, V]) GetEarly(key K) (V, bool, bool) {
+	now := time.Now()
+	e := c.lookup(key, now)
+	c.tracklatency(OpGet, now)
+	if e.status != Found {
+		return *new(V), false, false
+	}
+
+	return e.value, true, c.early(now, e.expiration, e.delta)
+}
+
+// early implements the XFetch condition: now - delta * beta * ln(rand) >= expiration.
+func (c *Cache[K, V]) early(now time.Time, expiration time.Time, delta time.Duration) bool {
+	if c.beta <= 0 || delta <= 0 {
+		return false
+	}
+
+	gap := -float64(delta) * c.beta * math.Log(1-c.random()) // 1-random is in (0, 1]
+	return float64(expiration.Sub(now)) <= gap
+}
+
+// Fetch returns a value for a key, loading it by the load function when the key is not in
+// the cache or when GetEarly reports it as due for refresh. The load time is recorded for
+// early expiration. If an early refresh fails, the cached value is returned.
+// Negative entries are served without loading: the cached error for errors stored by
+// SetError (see WithErrorTTL) and ErrNotFound for keys stored by SetMissing.
+func (c *Cache[K, V]) Fetch(key K, ttl time.Duration, load func() (V, error)) (V, error) {
+	now := time.Now()
+	e := c.lookup(key, now)
+	c.tracklatency(OpGet, now)
+
+	found := false
+	switch e.status {
+	case Failed:
+		return *new(V), e.err
+	case Missing:
+		return *new(V), ErrNotFound
+	case Found:
+		if !c.early(now, e.expiration, e.delta) {
+			return e.value, nil
+		}
+		found = true
+	}
+
+	start := time.Now()
+	loaded, err := load()
+	if err != nil {
+		if found {
+			c.logger.Warning("Early refresh of the cache item failed - cached value is used")
+			return e.value, nil
+		}
+		c.SetError(key, err)
+		return *new(V), err
+	}
+
+	c.SetComputed(key, loaded, ttl, time.Since(start))
+	return loaded, nil
+}
@@ -0,0 +1,97 @@
+package prehit
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCacheGetEarly(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20), WithEarlyExpiration(1))
+
+	c.SetComputed("test", 1, time.Second, 100*time.Millisecond)
+
+	// 1-random = e^-1 gives the gap equal to delta - too early for refresh
+	c.random = func() float64 { return 1 - 0.36787944117144233 }
+	if v, found, refresh := c.GetEarly("test"); v != 1 || !found || refresh {
+		t.Error("Cache must not refresh far from expiration")
+	}
+
+	// 1-random close to zero gives huge gap
+	c.random = func() float64 { return 1 - 1e-12 }
+	if v, found, refresh := c.GetEarly("test"); v != 1 || !found || !refresh {
+		t.Error("Cache must refresh with small random")
+	}
+
+	// no compute time - no early refresh
+	c.Set("test2", 2, time.Second)
+	if _, found, refresh := c.GetEarly("test2"); !found || refresh {
+		t.Error("Cache must not refresh without compute time")
+	}
+
+	if _, found, refresh := c.GetEarly("unknown"); found || refresh {
+		t.Error("Cache must not find unknown key")
+	}
+
+	// disabled early expiration
+	c = NewCache[string, int](WithMaxSize(20))
+	c.random = func() float64 { return 1 - 1e-12 }
+	c.SetComputed("test", 1, time.Second, time.Second)
+	if _, found, refresh := c.GetEarly("test"); !found || refresh {
+		t.Error("Cache must not refresh without early expiration")
+	}
+}
+
+func TestCacheFetch(t *testing.T) {
+	c := NewCache[string, int](WithMaxSize(20), WithEarlyExpiration(1), WithErrorTTL(time.Second))
+	failure := errors.New("backend failure")
+	calls := 0
+	load := func() (int, error) {
+		calls++
+		time.Sleep(time.Millisecond)
+		return calls, nil
+	}
+	fail := func() (int, error) {
+		calls++
+		return 0, failure
+	}
+
+	if v, err := c.Fetch("test", 20*time.Millisecond, load); v != 1 || err != nil || calls != 1 {
+		t.Error("Cache fetch must load missing key")
+	}
+
+	c.random = func() float64 { return 0 }
+	if v, err := c.Fetch("test", time.Second, load); v != 1 || err != nil || calls != 1 {
+		t.Error("Cache fetch must use cached value")
+	}
+
+	// the largest random gives the gap of about 36 compute times
+	c.random = func() float64 { return math.Nextafter(1, 0) }
+	if v, err := c.Fetch("test", 20*time.Millisecond, load); v != 2 || err != nil || calls != 2 {
+		t.Error("Cache fetch must refresh value early")
+	}
+
+	// failed early refresh keeps the value
+	if v, err := c.Fetch("test", time.Second, fail); v != 2 || err != nil || calls != 3 {
+		t.Error("Cache fetch must return cached value on failed refresh")
+	}
+
+	// failed load is cached
+	if _, err := c.Fetch("test2", time.Second, fail); err != failure {
+		t.Error("Cache fetch must return load error")
+	}
+
+	if _, status, err := c.Lookup("test2"); status != Failed || err != failure {
+		t.Error("Cache fetch must cache load error")
+	}
+
+	// negative entries are served without loading
+	if _, err := c.Fetch("test2", time.Second, load); err != failure || calls != 4 {
+		t.Error("Cache fetch must return cached error")
+	}
+	c.SetMissing("test3", time.Second)
+	if _, err := c.Fetch("test3", time.Second, load); err != ErrNotFound || calls != 4 {
+		t.Error("Cache fetch must return not found for missing key")
+	}
+}